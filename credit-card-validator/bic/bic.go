@@ -0,0 +1,127 @@
+// Package bic validates SWIFT business identifier codes (ISO 9362), which
+// name the bank, and optionally the branch, that a payment goes to.
+package bic
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Reason says why a BIC is invalid
+type Reason string
+
+const (
+	ReasonEmpty     Reason = "empty_input"
+	ReasonCharacter Reason = "invalid_character"
+	ReasonLength    Reason = "invalid_length"
+	ReasonStructure Reason = "invalid_structure"
+	ReasonCountry   Reason = "unknown_country"
+	ReasonBranch    Reason = "invalid_branch"
+)
+
+// Result is the outcome of validating a BIC along with its parts
+type Result struct {
+	Valid  bool   `json:"valid"`
+	Reason Reason `json:"reason,omitempty"`
+	// Rule describes the rule the BIC broke
+	Rule string `json:"rule,omitempty"`
+	BIC  string `json:"bic,omitempty"`
+	// Institution is the four letter code of the bank
+	Institution string `json:"institution,omitempty"`
+	Country     string `json:"country,omitempty"`
+	Location    string `json:"location,omitempty"`
+	// Branch is "XXX" for the head office, which 8 character BICs imply
+	Branch     string `json:"branch,omitempty"`
+	HeadOffice bool   `json:"headOffice,omitempty"`
+	// Test is set for BICs of the SWIFT test and training network, whose
+	// location code ends in 0
+	Test bool `json:"test,omitempty"`
+}
+
+// headOffice is the branch code of the head office
+const headOffice = "XXX"
+
+// Normalize upper cases s and removes spaces
+func Normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// Validate checks the structure, country and branch of s
+func Validate(s string) Result {
+	s = Normalize(s)
+	if s == "" {
+		return Result{Reason: ReasonEmpty, Rule: "a BIC is required"}
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) && !isUpper(s[i]) {
+			return Result{Reason: ReasonCharacter, Rule: "BICs only have letters and digits"}
+		}
+	}
+	res := Result{BIC: s}
+	if len(s) != 8 && len(s) != 11 {
+		res.Reason, res.Rule = ReasonLength, "BICs have 8 or 11 characters"
+		return res
+	}
+	res.Institution, res.Country, res.Location = s[:4], s[4:6], s[6:8]
+	res.Branch = headOffice
+	if len(s) == 11 {
+		res.Branch = s[8:]
+	}
+	for i := 0; i < 6; i++ {
+		if !isUpper(s[i]) {
+			res.Reason, res.Rule = ReasonStructure, "BICs start with a four letter bank code and a two letter country code"
+			return res
+		}
+	}
+	if !countries[res.Country] {
+		res.Reason, res.Rule = ReasonCountry, res.Country+" isn't an ISO 3166 country code"
+		return res
+	}
+	// location codes can't start with 0 or 1, or end in O, which would
+	// read as the 0 of a test BIC
+	if res.Location[0] == '0' || res.Location[0] == '1' || res.Location[1] == 'O' {
+		res.Reason, res.Rule = ReasonStructure, "the location code can't start with 0 or 1 or end in O"
+		return res
+	}
+	// branch codes starting with X are reserved for the head office
+	if res.Branch[0] == 'X' && res.Branch != headOffice {
+		res.Reason, res.Rule = ReasonBranch, "branch codes starting with X are reserved, the head office is XXX"
+		return res
+	}
+	res.HeadOffice = res.Branch == headOffice
+	res.Test = res.Location[1] == '0'
+	res.Valid = true
+	return res
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+
+// countries are the ISO 3166-1 alpha-2 codes, plus XK for Kosovo which
+// SWIFT also assigns
+var countries = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, c := range strings.Fields(`
+		AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ
+		BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ
+		CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ
+		DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR
+		GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY
+		HK HM HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP
+		KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY
+		MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ
+		NA NC NE NF NG NI NL NO NP NR NU NZ OM
+		PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW
+		SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ
+		TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ
+		UA UG UM US UY UZ VA VC VE VG VI VN VU WF WS XK YE YT ZA ZM ZW`) {
+		m[c] = true
+	}
+	return m
+}()
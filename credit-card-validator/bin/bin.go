@@ -0,0 +1,219 @@
+// Package bin resolves the issuer, country and card type of a card from
+// its bank identification number, the first six to eight digits. A dataset
+// is embedded so lookups work without any setup, and tables can be loaded
+// from other sources in the same CSV format.
+package bin
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed data/iin.csv
+var embedded []byte
+
+// Card types
+const (
+	Credit  = "credit"
+	Debit   = "debit"
+	Prepaid = "prepaid"
+)
+
+// Info describes the issuer of a range
+type Info struct {
+	// Name is the issuing bank
+	Name string `json:"name"`
+	// Country is the ISO 3166-1 alpha-2 code of the issuing country
+	Country string `json:"country"`
+	// Type is credit, debit or prepaid
+	Type string `json:"type"`
+	// Program names the card program, e.g. fleet or private label, mostly
+	// for custom ranges
+	Program string `json:"program,omitempty"`
+}
+
+// Range is a range of BINs of one length, from Low to High inclusive
+type Range struct {
+	Low  string `json:"low"`
+	High string `json:"high"`
+	Info
+}
+
+// Table looks up BINs in a set of ranges
+type Table struct {
+	version string
+	// byLength holds the ranges of each prefix length, sorted by Low
+	byLength map[int][]Range
+	size     int
+}
+
+// minDigits and maxDigits bound the prefix lengths of ranges
+const (
+	minDigits = 6
+	maxDigits = 8
+)
+
+// NewTable builds a table from ranges. Overlapping ranges of the same
+// length are rejected; of ranges of different lengths the longest wins.
+func NewTable(version string, ranges []Range) (*Table, error) {
+	t := &Table{version: version, byLength: make(map[int][]Range), size: len(ranges)}
+	for _, r := range ranges {
+		if len(r.Low) != len(r.High) || len(r.Low) < minDigits || len(r.Low) > maxDigits {
+			return nil, fmt.Errorf("bin: range %s-%s must have %d to %d digits on both ends", r.Low, r.High, minDigits, maxDigits)
+		}
+		if !digitsOnly(r.Low) || !digitsOnly(r.High) || r.Low > r.High {
+			return nil, fmt.Errorf("bin: invalid range %s-%s", r.Low, r.High)
+		}
+		switch r.Type {
+		case Credit, Debit, Prepaid:
+		default:
+			return nil, fmt.Errorf("bin: range %s-%s has unknown card type %q", r.Low, r.High, r.Type)
+		}
+		t.byLength[len(r.Low)] = append(t.byLength[len(r.Low)], r)
+	}
+	for n, ranges := range t.byLength {
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].Low < ranges[j].Low })
+		for i := 1; i < len(ranges); i++ {
+			if ranges[i].Low <= ranges[i-1].High {
+				return nil, fmt.Errorf("bin: ranges %s-%s and %s-%s overlap", ranges[i-1].Low, ranges[i-1].High, ranges[i].Low, ranges[i].High)
+			}
+		}
+		t.byLength[n] = ranges
+	}
+	return t, nil
+}
+
+// Load reads a table from CSV with the columns low, high, issuer, country,
+// type and optionally program after a header row. Lines starting with # are
+// comments, and a "# version: ..." comment names the dataset version.
+func Load(r io.Reader) (*Table, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	version := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "# version:"); ok {
+			version = strings.TrimSpace(v)
+			break
+		}
+	}
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("bin: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("bin: no header row")
+	}
+	ranges := make([]Range, 0, len(records)-1)
+	for i, rec := range records[1:] {
+		if len(rec) != 5 && len(rec) != 6 {
+			return nil, fmt.Errorf("bin: row %d has %d columns, want 5 or 6", i+2, len(rec))
+		}
+		r := Range{
+			Low:  rec[0],
+			High: rec[1],
+			Info: Info{Name: rec[2], Country: strings.ToUpper(rec[3]), Type: strings.ToLower(rec[4])},
+		}
+		if len(rec) == 6 {
+			r.Program = rec[5]
+		}
+		ranges = append(ranges, r)
+	}
+	return NewTable(version, ranges)
+}
+
+// LoadJSON reads a table from a JSON object like
+//
+//	{"version": "2026-10", "ranges": [{"low": "700000", "high": "700999",
+//	  "name": "Fleet Bank", "country": "US", "type": "credit", "program": "fleet"}]}
+func LoadJSON(r io.Reader) (*Table, error) {
+	var file struct {
+		Version string  `json:"version"`
+		Ranges  []Range `json:"ranges"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("bin: %w", err)
+	}
+	return NewTable(file.Version, file.Ranges)
+}
+
+// LoadFile reads a table from the JSON file at path when its name ends in
+// .json and from CSV otherwise
+func LoadFile(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return LoadJSON(f)
+	}
+	return Load(f)
+}
+
+// Default is the table of the embedded dataset
+var Default = sync.OnceValue(func() *Table {
+	t, err := Load(bytes.NewReader(embedded))
+	if err != nil {
+		panic(err)
+	}
+	return t
+})
+
+// Lookup finds the issuer of number
+func (t *Table) Lookup(number string) (Info, bool) {
+	r, ok := t.Match(number)
+	return r.Info, ok
+}
+
+// Match finds the range the leading digits of number fall in, trying
+// eight digit prefixes first
+func (t *Table) Match(number string) (Range, bool) {
+	for n := maxDigits; n >= minDigits; n-- {
+		if len(number) < n || !digitsOnly(number[:n]) {
+			continue
+		}
+		prefix := number[:n]
+		ranges := t.byLength[n]
+		// the last range starting at or below prefix is the only candidate
+		i := sort.Search(len(ranges), func(i int) bool { return ranges[i].Low > prefix }) - 1
+		if i >= 0 && prefix <= ranges[i].High {
+			return ranges[i], true
+		}
+	}
+	return Range{}, false
+}
+
+// Version names the dataset the table was loaded from
+func (t *Table) Version() string {
+	return t.version
+}
+
+// Len is the number of ranges in the table
+func (t *Table) Len() int {
+	return t.size
+}
+
+func digitsOnly(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
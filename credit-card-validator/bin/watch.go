@@ -0,0 +1,85 @@
+package bin
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Watcher keeps a table loaded from a file up to date with the file
+type Watcher struct {
+	path  string
+	table atomic.Pointer[Table]
+
+	// modTime and size identify the loaded version of the file
+	modTime time.Time
+	size    int64
+	loaded  atomic.Pointer[time.Time]
+}
+
+// Watch loads the table at path. Call Run to pick up changes.
+func Watch(path string) (*Watcher, error) {
+	w := &Watcher{path: path}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Watcher) load() error {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	t, err := LoadFile(w.path)
+	if err != nil {
+		return err
+	}
+	w.table.Store(t)
+	w.modTime, w.size = fi.ModTime(), fi.Size()
+	now := time.Now()
+	w.loaded.Store(&now)
+	return nil
+}
+
+// Table is the table loaded last
+func (w *Watcher) Table() *Table {
+	return w.table.Load()
+}
+
+// Loaded is when the table was loaded last
+func (w *Watcher) Loaded() time.Time {
+	return *w.loaded.Load()
+}
+
+// Run checks the file for changes every interval until ctx is done and
+// loads it again when it changed. A file that fails to load leaves the
+// previous table in place.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			fi, err := os.Stat(w.path)
+			if err != nil {
+				slog.Warn("checking custom BIN ranges", "path", w.path, "error", err)
+				continue
+			}
+			if fi.ModTime().Equal(w.modTime) && fi.Size() == w.size {
+				continue
+			}
+			if err := w.load(); err != nil {
+				slog.Error("reloading custom BIN ranges, keeping the previous ones", "path", w.path, "error", err)
+				// don't retry until the file changes again
+				w.modTime, w.size = fi.ModTime(), fi.Size()
+				continue
+			}
+			slog.Info("custom BIN ranges reloaded", "path", w.path, "ranges", w.Table().Len())
+		}
+	}
+}
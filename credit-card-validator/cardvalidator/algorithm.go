@@ -0,0 +1,59 @@
+package cardvalidator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+)
+
+// algorithmLengths are the lengths of the numbers of algorithms made for
+// one kind of number. Card numbers have their lengths checked by brand.
+var algorithmLengths = map[checksum.Algorithm][]int{
+	checksum.ISBN10: {10},
+	checksum.ISBN13: {13},
+	checksum.GTIN:   {8, 12, 13, 14},
+}
+
+// requestAlgorithm picks the national ID scheme named by scheme or the
+// algorithm named by name, from the request body, defaulting to Luhn. Luhn
+// mod N takes its alphabet from alphabet. When the body names none of them
+// they're read from the scheme, algorithm and alphabet query parameters.
+func requestAlgorithm(r *http.Request, scheme, name, alphabet string) (checksum.Algorithm, error) {
+	if scheme == "" && name == "" && alphabet == "" {
+		q := r.URL.Query()
+		scheme, name, alphabet = q.Get("scheme"), q.Get("algorithm"), q.Get("alphabet")
+	}
+	return pickAlgorithm(scheme, name, alphabet)
+}
+
+// pickAlgorithm is requestAlgorithm without the query parameters
+func pickAlgorithm(scheme, name, alphabet string) (checksum.Algorithm, error) {
+	if scheme != "" {
+		if name != "" || alphabet != "" {
+			return nil, errors.New("a scheme sets its own algorithm, leave out algorithm and alphabet")
+		}
+		return requestScheme(scheme)
+	}
+	if name == "" {
+		name = checksum.Luhn.Name()
+	}
+	a, ok := checksum.Named(name)
+	if !ok {
+		algorithms := checksum.Algorithms()
+		names := make([]string, len(algorithms))
+		for i, a := range algorithms {
+			names[i] = a.Name()
+		}
+		return nil, fmt.Errorf("unknown algorithm %q, use one of %s", name, strings.Join(names, ", "))
+	}
+	if alphabet == "" {
+		return a, nil
+	}
+	if a != checksum.LuhnModBase36 {
+		return nil, fmt.Errorf("only %s takes an alphabet", checksum.LuhnModBase36.Name())
+	}
+	return checksum.LuhnModN(alphabet)
+}
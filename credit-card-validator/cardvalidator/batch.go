@@ -0,0 +1,178 @@
+package cardvalidator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/codec"
+)
+
+// maxBatch bounds how many numbers one batch request may hold. Bigger
+// files belong in a batch job.
+const maxBatch = 10000
+
+// batchChunk is how many numbers a batch worker takes at a time. Checking
+// one number takes well under a microsecond, so workers taking them one by
+// one would mostly contend on the counter.
+const batchChunk = 256
+
+// BatchResult is the outcome for one number of a batch
+type BatchResult struct {
+	// Index is the position of the number in the request
+	Index int `json:"index"`
+	// DuplicateOf is the index of the first occurrence of a repeated
+	// number, whose verdict it shares
+	DuplicateOf *int `json:"duplicateOf,omitempty"`
+	Verdict
+}
+
+// validateCards checks an array of card numbers in one request with the
+// scheme or algorithm ?scheme=, ?algorithm= and ?alphabet= select and
+// answers with a result per number, in request order, and the number of
+// repeated numbers in the X-Duplicate-Count header. Up to workers numbers
+// are checked at once.
+func validateCards(workers int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var numbers []string
+		if !decodeBody(w, r, &numbers) {
+			return
+		}
+		alg, err := requestAlgorithm(r, "", "", "")
+		if err != nil {
+			codec.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(numbers) > maxBatch {
+			codec.Error(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("a batch holds at most %d numbers, POST bigger ones to /validateCreditCards/jobs", maxBatch))
+			return
+		}
+		results, err := checkAll(r.Context(), numbers, alg, workers)
+		if err != nil {
+			// the client is gone
+			return
+		}
+		w.Header().Set("X-Duplicate-Count", strconv.Itoa(countDuplicates(results)))
+		codec.Respond(w, r, http.StatusOK, results)
+	}
+}
+
+// checkAll checks numbers with alg on up to workers goroutines, or
+// GOMAXPROCS when workers isn't positive, and returns a result per number in
+// their order. Repeated numbers are checked once, their later occurrences
+// pointing at the first. It gives up with ctx's error once ctx is done.
+func checkAll(ctx context.Context, numbers []string, alg checksum.Algorithm, workers int) ([]BatchResult, error) {
+	results := make([]BatchResult, len(numbers))
+	normalized := make([]string, len(numbers))
+	seen := newDuplicates()
+	unique := make([]int, 0, len(numbers))
+	for i, number := range numbers {
+		normalized[i] = checksum.Normalize(number)
+		if j, ok := seen.first(normalized[i], i); ok {
+			results[i] = BatchResult{Index: i, DuplicateOf: &j}
+			continue
+		}
+		unique = append(unique, i)
+	}
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, (len(unique)+batchChunk-1)/batchChunk)
+	var next atomic.Int64
+	check := func() {
+		for ctx.Err() == nil {
+			start := int(next.Add(batchChunk)) - batchChunk
+			if start >= len(unique) {
+				return
+			}
+			for _, i := range unique[start:min(start+batchChunk, len(unique))] {
+				results[i] = BatchResult{Index: i, Verdict: checkCard(ctx, normalized[i], alg)}
+			}
+		}
+	}
+	if workers <= 1 {
+		check()
+	} else {
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				check()
+			}()
+		}
+		wg.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if j := results[i].DuplicateOf; j != nil {
+			results[i].Verdict = results[*j].Verdict
+		}
+	}
+	return results, nil
+}
+
+// countDuplicates counts the results repeating an earlier number
+func countDuplicates(results []BatchResult) int {
+	n := 0
+	for _, r := range results {
+		if r.DuplicateOf != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// maxRemembered bounds how many distinct numbers a batch remembers to spot
+// repeats, so streams of any size still run in bounded memory. Repeats of
+// numbers past it are checked again.
+const maxRemembered = 100000
+
+// duplicates spots the repeated numbers of a batch, so every batch entry
+// point checks a number once and points its repeats at the first
+// occurrence
+type duplicates struct {
+	seen     map[string]int
+	verdicts map[int]Verdict
+	// Count is how many repeats were spotted
+	Count int
+}
+
+func newDuplicates() *duplicates {
+	return &duplicates{seen: make(map[string]int), verdicts: make(map[int]Verdict)}
+}
+
+// first returns the index of the first occurrence of key, reporting false
+// and remembering index for it when key wasn't seen before. Keys are
+// normalized numbers, prefixed with the algorithm when a batch mixes them.
+func (d *duplicates) first(key string, index int) (int, bool) {
+	if j, ok := d.seen[key]; ok {
+		d.Count++
+		return j, true
+	}
+	if len(d.seen) < maxRemembered {
+		d.seen[key] = index
+	}
+	return index, false
+}
+
+// check returns the result of the number at index of a batch checked in
+// order, running check only for the first occurrence of key
+func (d *duplicates) check(key string, index int, check func() Verdict) BatchResult {
+	if j, ok := d.first(key, index); ok {
+		return BatchResult{Index: index, DuplicateOf: &j, Verdict: d.verdicts[j]}
+	}
+	v := check()
+	if _, ok := d.seen[key]; ok {
+		d.verdicts[index] = v
+	}
+	return BatchResult{Index: index, Verdict: v}
+}
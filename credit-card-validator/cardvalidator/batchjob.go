@@ -0,0 +1,192 @@
+package cardvalidator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/vault"
+	"github.com/ixmorrow/go-projects/shared/codec"
+	"github.com/ixmorrow/go-projects/shared/jobs"
+	"github.com/ixmorrow/go-projects/shared/webhook"
+)
+
+// batchJob is the job type that validates a batch of numbers in the
+// background
+const batchJob = "validateCards"
+
+// batchPayload is the payload of a batchJob. The algorithm is kept by name
+// so jobs recovered after a restart check numbers the same way.
+type batchPayload struct {
+	// Numbers is the JSON array of numbers, sealed so the jobs table never
+	// holds card numbers in the clear
+	Numbers   []byte `json:"numbers"`
+	Scheme    string `json:"scheme,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Alphabet  string `json:"alphabet,omitempty"`
+	// Callback is where the BatchEvent goes when the job finishes, and
+	// Origin the scheme and host the job was submitted to, for linking its
+	// results
+	Callback string `json:"callback,omitempty"`
+	Origin   string `json:"origin,omitempty"`
+}
+
+// BatchEvent is POSTed to the callback of a batch job once it's finished
+type BatchEvent struct {
+	Event  string      `json:"event"`
+	Job    string      `json:"job"`
+	Status jobs.Status `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	// Summary counts the results of a job that succeeded
+	Summary *BatchSummary `json:"summary,omitempty"`
+	// Results links the job with its results
+	Results string `json:"results"`
+}
+
+// BatchSummary counts the results of a batch
+type BatchSummary struct {
+	Numbers int `json:"numbers"`
+	// Duplicates counts the numbers repeating an earlier one
+	Duplicates int            `json:"duplicates"`
+	Valid      int            `json:"valid"`
+	Invalid    int            `json:"invalid"`
+	Reasons    map[Reason]int `json:"reasons"`
+}
+
+// runBatch is the jobs.Handler for batchJob, checking up to workers numbers
+// at once, and counts their verdicts in verdicts. Its result is a
+// BatchResult per number, in request order.
+func runBatch(sealer *vault.Sealer, workers int, verdicts *cardMetrics) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) (any, error) {
+		ctx = withCardMetrics(ctx, verdicts)
+		var payload batchPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return nil, err
+		}
+		data, err := sealer.Open(payload.Numbers)
+		if err != nil {
+			// sealed with the random key of an earlier process
+			return nil, fmt.Errorf("reading numbers, batch jobs only survive restarts with a vault key: %w", err)
+		}
+		var numbers []string
+		if err := json.Unmarshal(data, &numbers); err != nil {
+			return nil, err
+		}
+		alg, err := pickAlgorithm(payload.Scheme, payload.Algorithm, payload.Alphabet)
+		if err != nil {
+			return nil, err
+		}
+		return checkAll(ctx, numbers, alg, workers)
+	}
+}
+
+// submitBatch queues a background job validating the array of numbers in
+// the request body, with no limit on their count, and answers 202 with the
+// job at once. ?scheme=, ?algorithm= and ?alphabet= select the algorithm.
+// Callers poll /jobs/{id} for its status and results, or name a URL with
+// ?callback= for a signed BatchEvent once it's done. Callbacks need sender,
+// which is nil when no webhook secret is configured. The numbers are stored
+// sealed by sealer.
+func submitBatch(runner *jobs.Runner, sealer *vault.Sealer, sender *webhook.Sender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var numbers []string
+		if !decodeBody(w, r, &numbers) {
+			return
+		}
+		// fail bad parameters now rather than in the job
+		if _, err := requestAlgorithm(r, "", "", ""); err != nil {
+			codec.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		data, err := json.Marshal(numbers)
+		if err != nil {
+			codec.Error(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		sealed, err := sealer.Seal(data)
+		if err != nil {
+			codec.Error(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		q := r.URL.Query()
+		payload := batchPayload{
+			Numbers:   sealed,
+			Scheme:    q.Get("scheme"),
+			Algorithm: q.Get("algorithm"),
+			Alphabet:  q.Get("alphabet"),
+			Callback:  q.Get("callback"),
+		}
+		if payload.Callback != "" {
+			if sender == nil {
+				codec.Error(w, r, http.StatusBadRequest, "callbacks are off, no webhook secret is configured")
+				return
+			}
+			if err := sender.CheckURL(payload.Callback); err != nil {
+				codec.Error(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			payload.Origin = requestOrigin(r)
+		}
+		job, err := runner.Enqueue(r.Context(), batchJob, payload)
+		if errors.Is(err, jobs.ErrQueueFull) {
+			codec.Error(w, r, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err != nil {
+			codec.Error(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		job.Payload = nil
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		codec.Respond(w, r, http.StatusAccepted, job)
+	}
+}
+
+// notifyBatch is the jobs.Runner finish hook sending batch jobs' callbacks
+func notifyBatch(sender *webhook.Sender) func(jobs.Job) {
+	return func(job jobs.Job) {
+		if job.Type != batchJob {
+			return
+		}
+		var payload batchPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil || payload.Callback == "" {
+			return
+		}
+		event := BatchEvent{
+			Event:   "batch.finished",
+			Job:     job.ID,
+			Status:  job.Status,
+			Error:   job.Error,
+			Results: payload.Origin + "/jobs/" + job.ID,
+		}
+		var results []BatchResult
+		if job.Status == jobs.Succeeded && json.Unmarshal(job.Result, &results) == nil {
+			summary := BatchSummary{Numbers: len(results), Duplicates: countDuplicates(results), Reasons: map[Reason]int{}}
+			for _, result := range results {
+				if result.Valid {
+					summary.Valid++
+					continue
+				}
+				summary.Invalid++
+				summary.Reasons[result.Reason]++
+			}
+			event.Summary = &summary
+		}
+		sender.Deliver(payload.Callback, job.ID, event)
+	}
+}
+
+// requestOrigin is the scheme and host r was sent to, as the client saw
+// them when a proxy in front says so
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
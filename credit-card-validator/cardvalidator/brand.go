@@ -0,0 +1,141 @@
+package cardvalidator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Brand is the card network a number belongs to
+type Brand string
+
+const (
+	Visa       Brand = "Visa"
+	Mastercard Brand = "Mastercard"
+	Amex       Brand = "Amex"
+	Discover   Brand = "Discover"
+	JCB        Brand = "JCB"
+	Diners     Brand = "Diners"
+	UnionPay   Brand = "UnionPay"
+)
+
+// iinRange is a range of issuer identification number prefixes of one
+// length
+type iinRange struct {
+	brand     Brand
+	digits    int
+	low, high int
+}
+
+// iinRanges are checked in order, so the Discover range inside UnionPay's
+// 62 prefix comes first
+var iinRanges = []iinRange{
+	{Amex, 2, 34, 34},
+	{Amex, 2, 37, 37},
+	{Diners, 3, 300, 305},
+	{Diners, 4, 3095, 3095},
+	{Diners, 2, 36, 36},
+	{Diners, 2, 38, 39},
+	{JCB, 4, 3528, 3589},
+	{Visa, 1, 4, 4},
+	{Mastercard, 2, 51, 55},
+	{Mastercard, 4, 2221, 2720},
+	{Discover, 4, 6011, 6011},
+	{Discover, 6, 622126, 622925},
+	{Discover, 3, 644, 649},
+	{Discover, 2, 65, 65},
+	{UnionPay, 2, 62, 62},
+	{UnionPay, 2, 81, 81},
+}
+
+// industries are the Major Industry Identifier categories of ISO/IEC 7812,
+// named by the first digit of card numbers
+var industries = [10]string{
+	"ISO/TC 68 and other industry assignments",
+	"Airlines",
+	"Airlines, financial and other future industry assignments",
+	"Travel and entertainment",
+	"Banking and financial",
+	"Banking and financial",
+	"Merchandising and banking/financial",
+	"Petroleum and other future industry assignments",
+	"Healthcare, telecommunications and other future industry assignments",
+	"For assignment by national standards bodies",
+}
+
+// industry returns the Major Industry Identifier category of number, ""
+// when it doesn't start with a digit
+func industry(number string) string {
+	if number == "" || number[0] < '0' || number[0] > '9' {
+		return ""
+	}
+	return industries[number[0]-'0']
+}
+
+// detectBrand finds the network of number by its leading digits. It
+// returns "" when the prefix belongs to no known network.
+func detectBrand(number string) Brand {
+	for _, r := range iinRanges {
+		if len(number) < r.digits {
+			continue
+		}
+		prefix, err := strconv.Atoi(number[:r.digits])
+		if err != nil {
+			continue
+		}
+		if prefix >= r.low && prefix <= r.high {
+			return r.brand
+		}
+	}
+	return ""
+}
+
+// brandLengths are the lengths each network issues numbers in
+var brandLengths = map[Brand][]int{
+	Visa:       {13, 16, 19},
+	Mastercard: {16},
+	Amex:       {15},
+	Discover:   {16, 17, 18, 19},
+	JCB:        {16, 17, 18, 19},
+	Diners:     {14, 15, 16, 17, 18, 19},
+	UnionPay:   {16, 17, 18, 19},
+}
+
+// checkLength reports whether b issues numbers of length n and, when it
+// doesn't, describes the lengths it does issue
+func (b Brand) checkLength(n int) (bool, string) {
+	lengths, ok := brandLengths[b]
+	if !ok {
+		return true, ""
+	}
+	for _, l := range lengths {
+		if l == n {
+			return true, ""
+		}
+	}
+	return false, fmt.Sprintf("%s numbers have %s digits", b, describeLengths(lengths))
+}
+
+// describeLengths writes lengths as "15", "16 to 19" or "13, 16 or 19"
+func describeLengths(lengths []int) string {
+	first, last := lengths[0], lengths[len(lengths)-1]
+	if len(lengths) == 1 {
+		return strconv.Itoa(first)
+	}
+	if last-first == len(lengths)-1 {
+		return fmt.Sprintf("%d to %d", first, last)
+	}
+	parts := make([]string, len(lengths))
+	for i, l := range lengths {
+		parts[i] = strconv.Itoa(l)
+	}
+	return joinOr(parts)
+}
+
+// joinOr writes parts as "a", "a or b" or "a, b or c"
+func joinOr(parts []string) string {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " or " + parts[len(parts)-1]
+}
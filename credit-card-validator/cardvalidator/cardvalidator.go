@@ -0,0 +1,379 @@
+// Package cardvalidator checks credit card numbers with the Luhn algorithm
+// and serves the check over HTTP. The credit-card-validator command runs it
+// as a standalone server; other programs can embed it with New and Run.
+package cardvalidator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/bin"
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/codec"
+	"github.com/ixmorrow/go-projects/shared/logging"
+)
+
+// scopeValidate lets an API key call the validation endpoints
+const scopeValidate = "validate"
+
+// algorithmVersion identifies the card number check reported by /version
+const algorithmVersion = "luhn-mod10"
+
+// getWithBodyDeprecated is when sending the card in the body of a GET was
+// deprecated in favour of POST, which proxies and caches handle properly
+var getWithBodyDeprecated = time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC)
+
+type CardInfo struct {
+	CardNumber string `json:"cardNumber" schema:"required"`
+	// Scheme names a national ID preset. Otherwise Algorithm names the
+	// check digit algorithm, Luhn by default, and Alphabet sets the
+	// characters of Luhn mod N. Version 2 of the API reads them.
+	Scheme    string `json:"scheme,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Alphabet  string `json:"alphabet,omitempty"`
+	// CVV is the security code on the card, checked against the card's
+	// network by version 2. It's never logged or answered with.
+	CVV string `json:"cvv,omitempty"`
+}
+
+// Card numbers are between 12 and 19 digits long
+const (
+	minLength = 12
+	maxLength = 19
+)
+
+// Reason says why a number is invalid
+type Reason string
+
+const (
+	ReasonEmpty      Reason = "empty_input"
+	ReasonNonNumeric Reason = "non_numeric"
+	// ReasonCharacter marks identifiers with characters outside the
+	// alphabet of Luhn mod N
+	ReasonCharacter Reason = "invalid_character"
+	ReasonLength    Reason = "invalid_length"
+	ReasonChecksum  Reason = "failed_checksum"
+	// ReasonPrefix marks numbers starting with digits their scheme doesn't
+	// issue
+	ReasonPrefix Reason = "invalid_prefix"
+	// ReasonFormat, ReasonMonth and ReasonExpired mark expiry dates that
+	// aren't MM/YY or MM/YYYY, name no month or have passed
+	ReasonFormat  Reason = "invalid_format"
+	ReasonMonth   Reason = "invalid_month"
+	ReasonExpired Reason = "expired"
+)
+
+// Verdict is whether a number is valid and, when it isn't, why
+type Verdict struct {
+	Valid  bool   `json:"valid"`
+	Reason Reason `json:"reason,omitempty"`
+	// Rule describes the rule the number broke, e.g. the lengths its
+	// network issues
+	Rule string `json:"rule,omitempty"`
+}
+
+// checkCard checks the shape of number and its check digit with alg. Card
+// numbers, checked with Luhn, must also have a length their network issues,
+// and their verdicts are counted in the card metrics.
+func checkCard(ctx context.Context, number string, alg checksum.Algorithm) Verdict {
+	v := checkNumber(number, alg)
+	if alg == checksum.Luhn {
+		countResult(ctx, number, v)
+	}
+	return v
+}
+
+// checkNumber is checkCard without the metrics
+func checkNumber(number string, alg checksum.Algorithm) Verdict {
+	if number == "" {
+		return Verdict{Reason: ReasonEmpty, Rule: "a number is required"}
+	}
+	if !checksum.InAlphabet(number, alg) {
+		if alg.Alphabet() == checksum.Digits {
+			return Verdict{Reason: ReasonNonNumeric, Rule: "numbers only have digits"}
+		}
+		return Verdict{Reason: ReasonCharacter, Rule: "identifiers only have characters of the alphabet " + alg.Alphabet()}
+	}
+	if v := checkLength(number, alg); !v.Valid {
+		return v
+	}
+	if s, ok := alg.(*Scheme); ok {
+		if v := s.checkPrefix(number); !v.Valid {
+			return v
+		}
+	}
+	if !alg.Valid(number) {
+		return Verdict{Reason: ReasonChecksum, Rule: fmt.Sprintf("the last digit doesn't match the %s checksum", alg.Name())}
+	}
+	return Verdict{Valid: true}
+}
+
+// checkLength checks number has a length alg's numbers are issued in
+func checkLength(number string, alg checksum.Algorithm) Verdict {
+	if alg == checksum.Luhn {
+		if len(number) < minLength || len(number) > maxLength {
+			return Verdict{Reason: ReasonLength, Rule: fmt.Sprintf("card numbers have %d to %d digits", minLength, maxLength)}
+		}
+		if ok, rule := detectBrand(number).checkLength(len(number)); !ok {
+			return Verdict{Reason: ReasonLength, Rule: rule}
+		}
+	}
+	if s, ok := alg.(*Scheme); ok {
+		return s.checkLength(number)
+	}
+	if lengths, ok := algorithmLengths[alg]; ok && !slices.Contains(lengths, len(number)) {
+		return Verdict{Reason: ReasonLength, Rule: fmt.Sprintf("%s numbers have %s digits", alg.Name(), describeLengths(lengths))}
+	}
+	return Verdict{Valid: true}
+}
+
+// ValidationResult is the verdict on a number and what was learnt about it
+// on the way. It's how version 2 of the API answers a validation.
+type ValidationResult struct {
+	Verdict
+	// LengthValid and ChecksumValid report the length and check digit
+	// rules separately, so a number failing both says so
+	LengthValid   bool `json:"lengthValid"`
+	ChecksumValid bool `json:"checksumValid"`
+	// Normalized is the number without separators. It's never serialized,
+	// to keep full card numbers out of responses.
+	Normalized string `json:"-" xml:"-"`
+	// Number is the card number without separators, masked
+	Number string `json:"number,omitempty"`
+	// Algorithm is the check digit algorithm the number was checked with
+	Algorithm string `json:"algorithm"`
+	// Scheme is the national ID preset the request selected
+	Scheme string `json:"scheme,omitempty"`
+	// Brand is the card network, empty when the prefix is unknown
+	Brand Brand `json:"brand,omitempty"`
+	// Industry is the Major Industry Identifier category of ISO/IEC 7812
+	// the first digit names, for routing and analytics
+	Industry string `json:"industry,omitempty"`
+	// Issuer is who issued the card, when its BIN is in the dataset
+	Issuer *bin.Info `json:"issuer,omitempty"`
+	// CustomRange is the operator configured range the number falls in
+	CustomRange *bin.Range `json:"customRange,omitempty"`
+	// FundingType is credit, debit or prepaid and IssuerCountry the ISO
+	// 3166-1 alpha-2 code of the issuing country, from the custom range or
+	// else the issuer, when either is known
+	FundingType   string `json:"fundingType,omitempty"`
+	IssuerCountry string `json:"issuerCountry,omitempty"`
+	// CVV is the verdict on the security code, when the request had one
+	CVV *Verdict `json:"cvv,omitempty"`
+	// IsTestCard marks numbers published for testing, which never belong to
+	// a real card
+	IsTestCard bool `json:"isTestCard,omitempty"`
+	// Fingerprints are the keyed hashes of card numbers, made with the
+	// current fingerprint key first and then the ones being rotated out
+	Fingerprints []Fingerprint `json:"fingerprints,omitempty"`
+}
+
+// ValidateCard checks a card number, which may be written with spaces,
+// dashes or full-width digits, with Luhn and the lengths of its network.
+// Issuers aren't looked up, that needs the BIN dataset of a running
+// service.
+func ValidateCard(number string) ValidationResult {
+	return validateWith(context.Background(), number, checksum.Luhn)
+}
+
+// validateWith is ValidateCard for any algorithm or scheme
+func validateWith(ctx context.Context, number string, alg checksum.Algorithm) ValidationResult {
+	number = checksum.Normalize(number)
+	result := ValidationResult{
+		Verdict:    checkCard(ctx, number, alg),
+		Normalized: number,
+		Algorithm:  alg.Name(),
+	}
+	if s, ok := alg.(*Scheme); ok {
+		result.Scheme, result.Algorithm = s.Name(), s.Algorithm.Name()
+	}
+	if number == "" || !checksum.InAlphabet(number, alg) {
+		return result
+	}
+	result.LengthValid = checkLength(number, alg).Valid
+	result.ChecksumValid = alg.Valid(number)
+	if alg.Alphabet() == checksum.Digits {
+		result.Number = logging.MaskPAN(number)
+	}
+	if alg == checksum.Luhn {
+		result.Brand = detectBrand(number)
+		result.Industry = industry(number)
+		result.IsTestCard = knownTestCards[number]
+	}
+	return result
+}
+
+// decodeCard reads the card from the request body and normalizes its
+// number, answering the request itself when that fails
+func decodeCard(w http.ResponseWriter, r *http.Request) (CardInfo, bool) {
+	var cardInfo CardInfo
+	if !decodeBody(w, r, &cardInfo) {
+		return cardInfo, false
+	}
+	// logged normalized, since log redaction only spots ASCII digits
+	cardInfo.CardNumber = checksum.Normalize(cardInfo.CardNumber)
+	slog.InfoContext(r.Context(), "card number received", "cardNumber", cardInfo.CardNumber)
+	return cardInfo, true
+}
+
+// cardFromQuery lets requests without a body name the card with
+// ?cardNumber=, for curl one-liners, by passing it on as a form body so it
+// is validated like a posted card. The algorithm is read from the query as
+// usual.
+func cardFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number := r.URL.Query().Get("cardNumber")
+		if number == "" || r.ContentLength > 0 || len(r.TransferEncoding) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body := url.Values{"cardNumber": {number}}.Encode()
+		r = r.Clone(r.Context())
+		r.Body = io.NopCloser(strings.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Type", codec.Form.ContentType())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeBody reads the request body into v in the format its Content-Type
+// names. When that fails it answers 415 with the formats it reads instead,
+// 413 for a body over codec.MaxBodyBytes or 400 for an empty or malformed
+// body, in the format the client accepts, and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := codec.Decode(r, v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &tooLarge):
+		codec.Error(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body over %d bytes", tooLarge.Limit))
+	case errors.Is(err, codec.ErrUnsupportedMediaType):
+		w.Header().Set("Accept-Post", strings.Join(codec.ContentTypes(), ", "))
+		codec.Error(w, r, http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported Content-Type %q, send one of %s",
+			r.Header.Get("Content-Type"), strings.Join(codec.ContentTypes(), ", ")))
+	case errors.Is(err, io.EOF):
+		codec.Error(w, r, http.StatusBadRequest, "request body is required")
+	default:
+		codec.Error(w, r, http.StatusBadRequest, "invalid request body: "+err.Error())
+	}
+	return false
+}
+
+// validateCard answers with whether the number passes the Luhn check
+func validateCard(w http.ResponseWriter, r *http.Request) {
+	cardInfo, ok := decodeCard(w, r)
+	if !ok {
+		return
+	}
+	isValidCardNumber := checksum.Valid(cardInfo.CardNumber)
+	verdict := Verdict{Valid: isValidCardNumber}
+	if !isValidCardNumber {
+		verdict.Reason = ReasonChecksum
+	}
+	countResult(r.Context(), cardInfo.CardNumber, verdict)
+	codec.Respond(w, r, http.StatusOK, isValidCardNumber)
+}
+
+// flagV2Response is the feature flag that answers version 1 validations
+// with the version 2 result, to move callers over a few at a time
+const flagV2Response = "v2-response"
+
+// validateCardV2 is ValidateCard with the algorithm the request selects.
+// Card numbers also get what lookups finds out about them and their CVV
+// checked when there is one.
+func validateCardV2(lookups cardLookups) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cardInfo, ok := decodeCard(w, r)
+		if !ok {
+			return
+		}
+		alg, err := requestAlgorithm(r, cardInfo.Scheme, cardInfo.Algorithm, cardInfo.Alphabet)
+		if err != nil {
+			codec.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		result := lookups.lookup(r.Context(), cardInfo.CardNumber, alg)
+		if cardInfo.CVV != "" && alg == checksum.Luhn {
+			cvv := CheckCVV(cardInfo.CVV, result.Brand)
+			result.CVV = &cvv
+		}
+		codec.Respond(w, r, http.StatusOK, result)
+	}
+}
+
+// addBINInfo copies what the BIN data says about the number to the top
+// level of r, the operator's custom range taking precedence over the
+// dataset
+func (r *ValidationResult) addBINInfo() {
+	var infos []bin.Info
+	if r.CustomRange != nil {
+		infos = append(infos, r.CustomRange.Info)
+	}
+	if r.Issuer != nil {
+		infos = append(infos, *r.Issuer)
+	}
+	for _, info := range infos {
+		if r.FundingType == "" {
+			r.FundingType = info.Type
+		}
+		if r.IssuerCountry == "" {
+			r.IssuerCountry = info.Country
+		}
+	}
+}
+
+// cardLookups are what version 2 finds out about card numbers besides
+// their verdict
+type cardLookups struct {
+	// bins has the issuers and custom, which may be nil, the operator's
+	// ranges
+	bins   *bin.Table
+	custom *bin.Watcher
+	// results caches the verdicts and lookups
+	results *resultCache
+	// prints fingerprints numbers when it has keys
+	prints *fingerprinter
+	// tests are the configured test cards on top of knownTestCards
+	tests testCards
+}
+
+// lookup is validateWith plus, for card numbers, the issuer, custom range,
+// fingerprints and whether it's a configured test card. Results are looked
+// up in and saved to the result cache, without the fingerprints and
+// configured test cards, which change with the configuration.
+func (l cardLookups) lookup(ctx context.Context, number string, alg checksum.Algorithm) ValidationResult {
+	result, ok := l.results.get(ctx, number, alg)
+	switch {
+	case ok && alg == checksum.Luhn:
+		countResult(ctx, result.Normalized, result.Verdict)
+	case !ok:
+		result = validateWith(ctx, number, alg)
+		// issuers only make sense for card numbers
+		if alg == checksum.Luhn {
+			if info, ok := l.bins.Lookup(number); ok {
+				result.Issuer = &info
+			}
+			if l.custom != nil {
+				if rng, ok := l.custom.Table().Match(number); ok {
+					result.CustomRange = &rng
+				}
+			}
+			result.addBINInfo()
+		}
+		l.results.set(ctx, number, alg, result)
+	}
+	if alg == checksum.Luhn && result.Number != "" {
+		result.Fingerprints = l.prints.fingerprints(result.Normalized)
+		result.IsTestCard = isTestCard(result.Normalized, l.tests)
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package cardvalidator
+
+import (
+	"net/http"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/codec"
+)
+
+// CheckDigit computes the Luhn check digit that makes partial a valid
+// number when appended to it.
+//
+// Deprecated: use checksum.CheckDigit.
+func CheckDigit(partial string) (byte, error) {
+	return checksum.CheckDigit(partial)
+}
+
+// PartialNumber is a number waiting for its check digit
+type PartialNumber struct {
+	Number string `json:"number" schema:"required"`
+	// Scheme names a national ID preset. Otherwise Algorithm names the
+	// check digit algorithm, Luhn by default, and Alphabet sets the
+	// characters of Luhn mod N.
+	Scheme    string `json:"scheme,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Alphabet  string `json:"alphabet,omitempty"`
+}
+
+// CheckDigitResult is the check digit of a partial number and the number
+// completed with it
+type CheckDigitResult struct {
+	CheckDigit string `json:"checkDigit"`
+	Number     string `json:"number"`
+}
+
+// completeNumber answers with the check digit of the number in the body,
+// computed with the algorithm the request selects
+func completeNumber(w http.ResponseWriter, r *http.Request) {
+	var partial PartialNumber
+	if !decodeBody(w, r, &partial) {
+		return
+	}
+	alg, err := requestAlgorithm(r, partial.Scheme, partial.Algorithm, partial.Alphabet)
+	if err != nil {
+		codec.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	digit, err := checksum.CheckDigitWith(alg, partial.Number)
+	if err != nil {
+		codec.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	codec.Respond(w, r, http.StatusOK, CheckDigitResult{
+		CheckDigit: string(digit),
+		Number:     checksum.Normalize(partial.Number) + string(digit),
+	})
+}
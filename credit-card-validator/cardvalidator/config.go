@@ -0,0 +1,83 @@
+package cardvalidator
+
+import (
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/config"
+)
+
+// Config is the credit card validator's configuration: the settings every
+// service shares and the validator's own
+type Config struct {
+	config.Base  `yaml:",inline"`
+	BIN          BIN          `yaml:"bin"`
+	Results      Results      `yaml:"results"`
+	Stats        Stats        `yaml:"stats"`
+	Batch        Batch        `yaml:"batch"`
+	Expiry       Expiry       `yaml:"expiry"`
+	Vault        Vault        `yaml:"vault"`
+	Fingerprints Fingerprints `yaml:"fingerprints"`
+	TestCards    TestCards    `yaml:"testCards"`
+}
+
+// BIN configures the issuer lookup
+type BIN struct {
+	// CustomFile holds ranges the public dataset doesn't know, like private
+	// label or fleet cards, as CSV or, when it ends in .json, JSON
+	CustomFile string `yaml:"customFile" env:"BIN_CUSTOM_FILE" flag:"bin-custom-file" usage:"CSV or JSON file of custom BIN ranges, reloaded when it changes"`
+	// CheckEvery is how often CustomFile is checked for changes
+	CheckEvery time.Duration `yaml:"checkEvery" env:"BIN_CHECK_EVERY" flag:"bin-check-every" default:"10s" usage:"how often the custom BIN file is checked for changes"`
+}
+
+// Results configures the cache of validation results
+type Results struct {
+	// TTL is how long results are cached, zero turning the cache off. The
+	// number of results is bounded by the cache's MaxEntries.
+	TTL time.Duration `yaml:"ttl" env:"RESULT_CACHE_TTL" flag:"result-cache-ttl" default:"5m" usage:"how long validation results are cached, 0 to not cache them"`
+	// Salt keys the hashes results are cached under. Replicas sharing a
+	// Redis cache need the same one to share results.
+	Salt string `yaml:"salt" env:"RESULT_CACHE_SALT" usage:"secret the cached card numbers are hashed with, random when empty"`
+}
+
+// Stats configures where the validation statistics are kept
+type Stats struct {
+	// File is a SQLite database for the statistics when the service has no
+	// database of its own. Without either they're kept in memory.
+	File string `yaml:"file" env:"STATS_FILE" flag:"stats-file" usage:"SQLite file the validation statistics are kept in when no database is configured"`
+}
+
+// Batch configures the validation of batches and batch jobs
+type Batch struct {
+	// Workers bounds how many numbers of a batch are checked at once, zero
+	// meaning one per CPU
+	Workers int `yaml:"workers" env:"BATCH_WORKERS" flag:"batch-workers" usage:"numbers of a batch checked at once, one per CPU when 0"`
+}
+
+// Expiry configures the validation of expiry dates
+type Expiry struct {
+	// SoonWithin is how close to their end valid cards are flagged as
+	// expiring soon
+	SoonWithin time.Duration `yaml:"soonWithin" env:"EXPIRY_SOON_WITHIN" flag:"expiry-soon-within" default:"720h" usage:"how close to expiring valid cards are flagged as expiring soon"`
+}
+
+// Vault configures card tokenization
+type Vault struct {
+	// Key encrypts the tokenized card numbers and the numbers of queued
+	// batch jobs. Tokenization is off without one, and tokens can't be read
+	// back once it's lost or changed.
+	Key string `yaml:"key" env:"VAULT_KEY" usage:"base64 encoded 32 byte key encrypting tokenized cards and batch jobs, tokenization is off when empty"`
+}
+
+// Fingerprints configures the keyed hashes of card numbers in results
+type Fingerprints struct {
+	// Keys are id:secret pairs, the current key first. Keys being rotated
+	// out stay after it until callers have moved to the current one.
+	Keys []string `yaml:"keys" env:"FINGERPRINT_KEYS" flag:"fingerprint-keys" usage:"comma separated id:secret keys card fingerprints are made with, the current one first, off when empty"`
+}
+
+// TestCards configures the test card numbers flagged in results
+type TestCards struct {
+	// Numbers are flagged on top of the test cards published by networks
+	// and payment providers, e.g. those of an acquirer's sandbox
+	Numbers []string `yaml:"numbers" env:"TEST_CARDS" flag:"test-cards" usage:"comma separated card numbers flagged as test cards besides the well-known ones"`
+}
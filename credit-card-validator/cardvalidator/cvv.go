@@ -0,0 +1,35 @@
+package cardvalidator
+
+import "fmt"
+
+// cvvLengths are the lengths of the security codes of the networks whose
+// codes aren't 3 digits
+var cvvLengths = map[Brand]int{
+	Amex: 4,
+}
+
+// CheckCVV checks the length of cvv, the security code of a card of brand.
+// Amex codes have 4 digits and the others 3; either is accepted when the
+// brand is unknown. The verdict never repeats the code.
+func CheckCVV(cvv string, brand Brand) Verdict {
+	if cvv == "" {
+		return Verdict{Reason: ReasonEmpty, Rule: "a security code is required"}
+	}
+	if !allDigits(cvv) {
+		return Verdict{Reason: ReasonNonNumeric, Rule: "security codes only have digits"}
+	}
+	if brand == "" {
+		if len(cvv) != 3 && len(cvv) != 4 {
+			return Verdict{Reason: ReasonLength, Rule: "security codes have 3 or 4 digits"}
+		}
+		return Verdict{Valid: true}
+	}
+	want, ok := cvvLengths[brand]
+	if !ok {
+		want = 3
+	}
+	if len(cvv) != want {
+		return Verdict{Reason: ReasonLength, Rule: fmt.Sprintf("%s security codes have %d digits", brand, want)}
+	}
+	return Verdict{Valid: true}
+}
@@ -0,0 +1,171 @@
+package cardvalidator
+
+import (
+	"net/http"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/bic"
+	"github.com/ixmorrow/go-projects/credit-card-validator/iban"
+	"github.com/ixmorrow/go-projects/credit-card-validator/vat"
+	"github.com/ixmorrow/go-projects/shared/jobs"
+	"github.com/ixmorrow/go-projects/shared/openapi"
+)
+
+// apiSpec documents the versioned validation routes for /docs. The
+// unversioned routes are the v1 ones and left out.
+func apiSpec(version string) *openapi.Spec {
+	spec := openapi.New("Credit card validator", version,
+		"Validates card numbers with Luhn and the lengths and prefixes of their network, "+
+			"and IBANs, BICs, ISBNs and EU VAT numbers. Requests take an API key in the X-API-Key header or a bearer token.")
+	algorithmParams := []openapi.Parameter{
+		openapi.Query("scheme", "string", "national ID preset to check with"),
+		openapi.Query("algorithm", "string", "check digit algorithm, luhn by default"),
+		openapi.Query("alphabet", "string", "characters of Luhn mod N"),
+	}
+	add := func(method, path string, op openapi.Operation) {
+		op.Security = openapi.Authenticated()
+		if op.Responses == nil {
+			op.Responses = map[string]openapi.Response{}
+		}
+		op.Responses["400"] = openapi.Error("Malformed request")
+		op.Responses["401"] = openapi.Error("Missing or invalid credentials")
+		op.Responses["429"] = openapi.Error("Rate limit or quota exceeded")
+		spec.Add(method, path, op)
+	}
+	for _, v := range []string{"v1", "v2"} {
+		prefix := "/api/" + v
+		result := openapi.JSON[ValidationResult]("The verdict and what was learnt about the number")
+		if v == "v1" {
+			result = openapi.JSON[bool]("Whether the number passes the Luhn check")
+		}
+		add(http.MethodPost, prefix+"/validateCreditCard", openapi.Operation{
+			Summary:     "Validate a card number",
+			Description: "Version 2 checks with the algorithm or scheme the body names, and gives card numbers their brand, issuer and custom range and checks their CVV. Form-encoded bodies are read too.",
+			Tags:        []string{v},
+			RequestBody: openapi.Body[CardInfo](),
+			Responses:   map[string]openapi.Response{"200": result},
+		})
+		add(http.MethodGet, prefix+"/validateCreditCard", openapi.Operation{
+			Summary:    "Validate a card number given in the query",
+			Tags:       []string{v},
+			Parameters: append([]openapi.Parameter{openapi.Query("cardNumber", "string", "the number to validate")}, algorithmParams...),
+			Responses:  map[string]openapi.Response{"200": result},
+		})
+		add(http.MethodPost, prefix+"/validateCreditCards", openapi.Operation{
+			Summary:     "Validate up to 10000 numbers",
+			Description: "Bodies of application/x-ndjson card records are streamed, answering a line per record.",
+			Tags:        []string{v},
+			Parameters:  algorithmParams,
+			RequestBody: openapi.Body[[]string](),
+			Responses: map[string]openapi.Response{
+				"200": openapi.JSON[[]BatchResult]("A result per number, in request order"),
+				"413": openapi.Error("Too many numbers, submit a job instead"),
+			},
+		})
+		add(http.MethodPost, prefix+"/validateCreditCards/upload", openapi.Operation{
+			Summary:     "Validate a column of an uploaded CSV file",
+			Description: "The file goes in the file field of a multipart/form-data body. Accept: text/csv answers with the file annotated, text/event-stream with progress events.",
+			Tags:        []string{v},
+			Parameters:  append([]openapi.Parameter{openapi.Query("column", "string", "header of the card number column")}, algorithmParams...),
+			Responses:   map[string]openapi.Response{"200": openapi.JSON[UploadSummary]("Counts of the rows and the first invalid ones")},
+		})
+		add(http.MethodPost, prefix+"/validateCreditCards/jobs", openapi.Operation{
+			Summary:     "Validate any number of numbers in the background",
+			Description: "Poll the job for its results, or name a callback for a signed event once it finishes.",
+			Tags:        []string{v},
+			Parameters:  append([]openapi.Parameter{openapi.Query("callback", "string", "URL to POST the finished job's summary to")}, algorithmParams...),
+			RequestBody: openapi.Body[[]string](),
+			Responses: map[string]openapi.Response{
+				"202": openapi.JSON[jobs.Job]("The queued job"),
+				"503": openapi.Error("The job queue is full"),
+			},
+		})
+		add(http.MethodGet, prefix+"/jobs/{id}", openapi.Operation{
+			Summary:   "Get a job with its status and results",
+			Tags:      []string{v},
+			Responses: map[string]openapi.Response{"200": openapi.JSON[jobs.Job]("The job"), "404": openapi.Error("No such job")},
+		})
+		add(http.MethodGet, prefix+"/generateTestCards", openapi.Operation{
+			Summary: "Generate valid test numbers of a brand",
+			Tags:    []string{v},
+			Parameters: []openapi.Parameter{
+				openapi.Query("brand", "string", "card network, e.g. visa"),
+				openapi.Query("length", "integer", "digits per number, 16 by default"),
+				openapi.Query("count", "integer", "how many numbers, 1 by default"),
+			},
+			Responses: map[string]openapi.Response{"200": openapi.JSON[[]string]("The numbers")},
+		})
+		add(http.MethodPost, prefix+"/checkDigit", openapi.Operation{
+			Summary:     "Compute the check digit of a number",
+			Tags:        []string{v},
+			RequestBody: openapi.Body[PartialNumber](),
+			Responses:   map[string]openapi.Response{"200": openapi.JSON[CheckDigitResult]("The check digit and the completed number")},
+		})
+		add(http.MethodPost, prefix+"/validateIBAN", openapi.Operation{
+			Summary:     "Validate an IBAN",
+			Tags:        []string{v},
+			RequestBody: openapi.Body[IBANInfo](),
+			Responses:   map[string]openapi.Response{"200": openapi.JSON[iban.Result]("The verdict and the parts of the IBAN")},
+		})
+		add(http.MethodPost, prefix+"/validateBIC", openapi.Operation{
+			Summary:     "Validate a BIC",
+			Tags:        []string{v},
+			RequestBody: openapi.Body[BICInfo](),
+			Responses:   map[string]openapi.Response{"200": openapi.JSON[bic.Result]("The verdict and the parts of the BIC")},
+		})
+		add(http.MethodPost, prefix+"/validateISBN", openapi.Operation{
+			Summary:     "Validate an ISBN-10 or ISBN-13",
+			Tags:        []string{v},
+			RequestBody: openapi.Body[ISBNInfo](),
+			Responses:   map[string]openapi.Response{"200": openapi.JSON[ISBNResult]("The verdict")},
+		})
+		add(http.MethodPost, prefix+"/validateVAT", openapi.Operation{
+			Summary:     "Validate an EU VAT number",
+			Tags:        []string{v},
+			RequestBody: openapi.Body[VATInfo](),
+			Responses:   map[string]openapi.Response{"200": openapi.JSON[vat.Result]("The verdict")},
+		})
+		add(http.MethodPost, prefix+"/validatePaymentCard", openapi.Operation{
+			Summary:     "Validate the card fields of a checkout form",
+			Description: "Checks the number, expiry date, CVV and cardholder name together and reports on each. The CVV is never answered with.",
+			Tags:        []string{v},
+			RequestBody: openapi.Body[PaymentCard](),
+			Responses:   map[string]openapi.Response{"200": openapi.JSON[PaymentCardReport]("The verdict on every field")},
+		})
+		add(http.MethodPost, prefix+"/tokenize", openapi.Operation{
+			Summary:     "Swap a valid card number for a token",
+			Description: "The same card always gets the same token within a tenant. Only served when the vault has a key.",
+			Tags:        []string{v},
+			RequestBody: openapi.Body[CardInfo](),
+			Responses: map[string]openapi.Response{
+				"200": openapi.JSON[TokenResult]("The token and the masked number"),
+				"422": openapi.Error("The number is invalid"),
+			},
+		})
+		add(http.MethodGet, prefix+"/tokens/{token}", openapi.Operation{
+			Summary:     "Validate the card behind a token",
+			Description: "Needs the detokenize scope.",
+			Tags:        []string{v},
+			Responses: map[string]openapi.Response{
+				"200": openapi.JSON[ValidationResult]("The verdict on the card"),
+				"404": openapi.Error("No such token"),
+			},
+		})
+		add(http.MethodPost, prefix+"/tokens/{token}/detokenize", openapi.Operation{
+			Summary:     "Get the card number behind a token",
+			Description: "Needs the detokenize scope.",
+			Tags:        []string{v},
+			Responses: map[string]openapi.Response{
+				"200": openapi.JSON[Detokenized]("The card number"),
+				"404": openapi.Error("No such token"),
+			},
+		})
+		add(http.MethodPost, prefix+"/validateExpiry", openapi.Operation{
+			Summary:     "Validate a card expiry date",
+			Description: "Dates are MM/YY or MM/YYYY. Cards are valid through the end of their expiry month and flagged when expiring soon.",
+			Tags:        []string{v},
+			RequestBody: openapi.Body[ExpiryInfo](),
+			Responses:   map[string]openapi.Response{"200": openapi.JSON[ExpiryResult]("The verdict and the last day the card is valid")},
+		})
+	}
+	return spec
+}
@@ -0,0 +1,84 @@
+package cardvalidator
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/codec"
+)
+
+// ExpiryInfo is the body of an expiry date validation request
+type ExpiryInfo struct {
+	// Expiry is the date printed on the card, MM/YY or MM/YYYY
+	Expiry string `json:"expiry" schema:"required"`
+}
+
+// ExpiryResult is the verdict on an expiry date
+type ExpiryResult struct {
+	Verdict
+	Month int `json:"month,omitempty"`
+	Year  int `json:"year,omitempty"`
+	// LastValidDay is the last day the card can be used, the end of its
+	// expiry month
+	LastValidDay string `json:"lastValidDay,omitempty"`
+	// ExpiringSoon warns of valid cards expiring within the configured
+	// window
+	ExpiringSoon bool `json:"expiringSoon,omitempty"`
+}
+
+// CheckExpiry checks expiry, given as MM/YY or MM/YYYY, at now. Cards stay
+// valid through the end of their expiry month in UTC, and are flagged as
+// expiring soon when that is less than soon away.
+func CheckExpiry(expiry string, now time.Time, soon time.Duration) ExpiryResult {
+	expiry = strings.ReplaceAll(strings.TrimSpace(expiry), " ", "")
+	if expiry == "" {
+		return ExpiryResult{Verdict: Verdict{Reason: ReasonEmpty, Rule: "an expiry date is required"}}
+	}
+	month, year, ok := strings.Cut(expiry, "/")
+	if !ok || len(month) < 1 || len(month) > 2 || (len(year) != 2 && len(year) != 4) || !allDigits(month) || !allDigits(year) {
+		return ExpiryResult{Verdict: Verdict{Reason: ReasonFormat, Rule: "expiry dates look like MM/YY or MM/YYYY"}}
+	}
+	m, _ := strconv.Atoi(month)
+	y, _ := strconv.Atoi(year)
+	if len(year) == 2 {
+		y += 2000
+	}
+	if m < 1 || m > 12 {
+		return ExpiryResult{Verdict: Verdict{Reason: ReasonMonth, Rule: "months go from 01 to 12"}}
+	}
+
+	res := ExpiryResult{Month: m, Year: y}
+	// the card stops working when the month after its expiry month starts
+	end := time.Date(y, time.Month(m)+1, 1, 0, 0, 0, 0, time.UTC)
+	res.LastValidDay = end.AddDate(0, 0, -1).Format(time.DateOnly)
+	if !now.Before(end) {
+		res.Verdict = Verdict{Reason: ReasonExpired, Rule: "the card expired at the end of " + time.Month(m).String() + " " + strconv.Itoa(y)}
+		return res
+	}
+	res.Valid = true
+	res.ExpiringSoon = end.Sub(now) <= soon
+	return res
+}
+
+func allDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validateExpiry answers with the verdict on the expiry date in the body,
+// warning of cards expiring within soon
+func validateExpiry(soon time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var info ExpiryInfo
+		if !decodeBody(w, r, &info) {
+			return
+		}
+		codec.Respond(w, r, http.StatusOK, CheckExpiry(info.Expiry, time.Now(), soon))
+	}
+}
@@ -0,0 +1,67 @@
+package cardvalidator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Fingerprint is a keyed hash of a card number. Systems given the same key
+// get the same fingerprint for a card, so they can join on cards without
+// keeping the numbers.
+type Fingerprint struct {
+	// KeyID names the key the fingerprint was made with
+	KeyID string `json:"keyId"`
+	Value string `json:"value"`
+}
+
+type fingerprintKey struct {
+	id     string
+	secret []byte
+}
+
+// fingerprinter fingerprints card numbers with every configured key, the
+// current one first, so while keys are rotated callers can still match
+// fingerprints made with the previous ones. A nil fingerprinter makes none.
+type fingerprinter struct {
+	keys []fingerprintKey
+}
+
+// newFingerprinter parses keys given as id:secret, the current key first.
+// It returns nil without keys.
+func newFingerprinter(keys []string) (*fingerprinter, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	f := &fingerprinter{}
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		id, secret, ok := strings.Cut(strings.TrimSpace(k), ":")
+		if !ok || id == "" || secret == "" {
+			return nil, errors.New("fingerprint keys look like id:secret")
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("fingerprint key %s is configured twice", id)
+		}
+		seen[id] = true
+		f.keys = append(f.keys, fingerprintKey{id: id, secret: []byte(secret)})
+	}
+	return f, nil
+}
+
+// fingerprints returns the fingerprints of number, a normalized card number
+func (f *fingerprinter) fingerprints(number string) []Fingerprint {
+	if f == nil {
+		return nil
+	}
+	prints := make([]Fingerprint, len(f.keys))
+	for i, k := range f.keys {
+		h := hmac.New(sha256.New, k.secret)
+		h.Write([]byte(number))
+		prints[i] = Fingerprint{KeyID: k.id, Value: hex.EncodeToString(h.Sum(nil))}
+	}
+	return prints
+}
@@ -0,0 +1,97 @@
+package cardvalidator
+
+import (
+	"context"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/bin"
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/graphql"
+)
+
+// graphQLSchema lets clients validate numbers, detect brands and look up
+// BINs in one request, e.g.
+//
+//	{
+//		validate(number: "4111 1111 1111 1111") { valid reason brand }
+//		bin(number: "411111") { name country }
+//	}
+func graphQLSchema(bins *bin.Table) *graphql.Schema {
+	validation := &graphql.Object{
+		Name: "Validation",
+		Fields: map[string]*graphql.Field{
+			"valid":         {Type: "Boolean!"},
+			"reason":        {Type: "String"},
+			"rule":          {Type: "String"},
+			"lengthValid":   {Type: "Boolean!"},
+			"checksumValid": {Type: "Boolean!"},
+			"number":        {Type: "String"},
+			"algorithm":     {Type: "String!"},
+			"scheme":        {Type: "String"},
+			"brand":         {Type: "String"},
+			"industry":      {Type: "String"},
+			"issuer":        {Type: "Issuer"},
+			"fundingType":   {Type: "String"},
+			"issuerCountry": {Type: "String"},
+		},
+	}
+	issuer := &graphql.Object{
+		Name: "Issuer",
+		Fields: map[string]*graphql.Field{
+			"name":    {Type: "String!"},
+			"country": {Type: "String!"},
+			"type":    {Type: "String!"},
+			"program": {Type: "String"},
+		},
+	}
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: map[string]*graphql.Field{
+			"validate": {
+				Type: "Validation!",
+				Args: map[string]string{"number": "String!", "algorithm": "String", "alphabet": "String", "scheme": "String"},
+				Resolve: func(ctx context.Context, _ any, args map[string]any) (any, error) {
+					alg, err := pickAlgorithm(stringArg(args, "scheme"), stringArg(args, "algorithm"), stringArg(args, "alphabet"))
+					if err != nil {
+						return nil, err
+					}
+					result := validateWith(ctx, stringArg(args, "number"), alg)
+					// issuers only make sense for card numbers
+					if alg == checksum.Luhn {
+						if info, ok := bins.Lookup(result.Normalized); ok {
+							result.Issuer = &info
+						}
+						result.addBINInfo()
+					}
+					return result, nil
+				},
+			},
+			"brand": {
+				Type: "String",
+				Args: map[string]string{"number": "String!"},
+				Resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+					if brand := detectBrand(checksum.Normalize(stringArg(args, "number"))); brand != "" {
+						return brand, nil
+					}
+					return nil, nil
+				},
+			},
+			"bin": {
+				Type: "Issuer",
+				Args: map[string]string{"number": "String!"},
+				Resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+					if info, ok := bins.Lookup(checksum.Normalize(stringArg(args, "number"))); ok {
+						return info, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	}
+	return graphql.NewSchema(query, validation, issuer)
+}
+
+// stringArg is an optional String argument, empty when it's missing or null
+func stringArg(args map[string]any, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
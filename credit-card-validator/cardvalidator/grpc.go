@@ -0,0 +1,292 @@
+package cardvalidator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/credit-card-validator/bin"
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// grpcService is the path prefix of the CardValidator service defined in
+// proto/cardvalidator/v1
+const grpcService = "/cardvalidator.v1.CardValidator"
+
+// maxGRPCMessage bounds request messages, like gRPC's own default
+const maxGRPCMessage = 4 << 20
+
+// gRPC status codes
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcResourceExhaust = 8
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+)
+
+// grpcError is a failed call with its gRPC status code
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string { return e.message }
+
+func invalidArgument(err error) error {
+	return &grpcError{grpcInvalidArgument, err.Error()}
+}
+
+// unaryRPC turns a request message into a response message
+type unaryRPC func(r *http.Request, req []byte) ([]byte, error)
+
+// grpcRoutes adds the CardValidator RPCs to r, which must match the gRPC
+// content type. The methods are plain HTTP/2 routes, so they go through the
+// same middleware as the HTTP API; the protocol's framing is handled here
+// with the messages encoded by hand, which keeps the gRPC runtime out of
+// the dependencies.
+func grpcRoutes(r *mux.Router, bins *bin.Table, cheap, expensive func(http.Handler) http.Handler) {
+	r.Handle("/Validate", cheap(serveUnary(grpcValidate(bins))))
+	r.Handle("/ValidateBatch", expensive(serveUnary(grpcValidateBatch)))
+	r.Handle("/GenerateCheckDigit", cheap(serveUnary(grpcGenerateCheckDigit)))
+}
+
+// serveUnary reads the single message of a unary call, hands it to rpc and
+// writes the response message and status
+func serveUnary(rpc unaryRPC) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			http.Error(w, "gRPC needs HTTP/2", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		req, err := readMessage(r.Body)
+		var resp []byte
+		if err == nil {
+			resp, err = rpc(r, req)
+		}
+		if err != nil {
+			var ge *grpcError
+			if !errors.As(err, &ge) {
+				ge = &grpcError{grpcInternal, err.Error()}
+			}
+			// a trailers-only response carries the status in its headers
+			w.Header().Set("Grpc-Status", strconv.Itoa(ge.code))
+			w.Header().Set("Grpc-Message", grpcEscape(ge.message))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		frame := make([]byte, 5, 5+len(resp))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+		w.Write(append(frame, resp...))
+		w.Header().Set("Grpc-Status", strconv.Itoa(grpcOK))
+	})
+}
+
+// readMessage reads a length-prefixed message, the only one of the body
+func readMessage(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "request message is missing"}
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed messages aren't supported"}
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > maxGRPCMessage {
+		return nil, &grpcError{grpcResourceExhaust, fmt.Sprintf("request message is larger than %d bytes", maxGRPCMessage)}
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "request message is truncated"}
+	}
+	return msg, nil
+}
+
+// grpcEscape percent-encodes a status message as the protocol requires
+func grpcEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// stringFields decodes a message whose fields are all strings, repeated or
+// not, skipping fields of other types
+func stringFields(msg []byte) (map[protowire.Number][]string, error) {
+	fields := make(map[protowire.Number][]string)
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return nil, invalidArgument(protowire.ParseError(n))
+		}
+		msg = msg[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, msg)
+		} else {
+			var s string
+			s, n = protowire.ConsumeString(msg)
+			fields[num] = append(fields[num], s)
+		}
+		if n < 0 {
+			return nil, invalidArgument(protowire.ParseError(n))
+		}
+		msg = msg[n:]
+	}
+	return fields, nil
+}
+
+// singular is the value of a singular field, the last one when it was
+// sent more than once as proto3 has it
+func singular(fields map[protowire.Number][]string, num protowire.Number) string {
+	if v := fields[num]; len(v) > 0 {
+		return v[len(v)-1]
+	}
+	return ""
+}
+
+// fieldAlgorithm picks the algorithm from fields 2 to 4 of a request:
+// algorithm, alphabet and scheme
+func fieldAlgorithm(r *http.Request, fields map[protowire.Number][]string) (checksum.Algorithm, error) {
+	alg, err := requestAlgorithm(r, singular(fields, 4), singular(fields, 2), singular(fields, 3))
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	return alg, nil
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func appendUint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// encodeResult writes result as a ValidateResponse
+func encodeResult(result ValidationResult) []byte {
+	var b []byte
+	b = appendBool(b, 1, result.Valid)
+	b = appendString(b, 2, string(result.Reason))
+	b = appendString(b, 3, result.Rule)
+	b = appendBool(b, 4, result.LengthValid)
+	b = appendBool(b, 5, result.ChecksumValid)
+	b = appendString(b, 6, result.Number)
+	b = appendString(b, 7, result.Algorithm)
+	b = appendString(b, 8, result.Scheme)
+	b = appendString(b, 9, string(result.Brand))
+	if result.Issuer != nil {
+		var issuer []byte
+		issuer = appendString(issuer, 1, result.Issuer.Name)
+		issuer = appendString(issuer, 2, result.Issuer.Country)
+		issuer = appendString(issuer, 3, result.Issuer.Type)
+		issuer = appendString(issuer, 4, result.Issuer.Program)
+		b = appendMessage(b, 10, issuer)
+	}
+	return b
+}
+
+// grpcValidate is the Validate RPC, answering like version 2 of the HTTP
+// API without the custom ranges
+func grpcValidate(bins *bin.Table) unaryRPC {
+	return func(r *http.Request, req []byte) ([]byte, error) {
+		fields, err := stringFields(req)
+		if err != nil {
+			return nil, err
+		}
+		alg, err := fieldAlgorithm(r, fields)
+		if err != nil {
+			return nil, err
+		}
+		result := validateWith(r.Context(), singular(fields, 1), alg)
+		if alg == checksum.Luhn {
+			if info, ok := bins.Lookup(result.Normalized); ok {
+				result.Issuer = &info
+			}
+		}
+		return encodeResult(result), nil
+	}
+}
+
+// grpcValidateBatch is the ValidateBatch RPC
+func grpcValidateBatch(r *http.Request, req []byte) ([]byte, error) {
+	fields, err := stringFields(req)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := fieldAlgorithm(r, fields)
+	if err != nil {
+		return nil, err
+	}
+	numbers := fields[1]
+	if len(numbers) > maxBatch {
+		return nil, &grpcError{grpcResourceExhaust, fmt.Sprintf("a batch holds at most %d numbers, POST bigger ones to /validateCreditCards/jobs", maxBatch)}
+	}
+	// repeated numbers are checked once and share the first one's result
+	seen := newDuplicates()
+	results := make([][]byte, len(numbers))
+	var b []byte
+	for i, number := range numbers {
+		if j, ok := seen.first(checksum.Normalize(number), i); ok {
+			results[i] = results[j]
+		} else {
+			results[i] = encodeResult(validateWith(r.Context(), number, alg))
+		}
+		b = appendMessage(b, 1, results[i])
+	}
+	return appendUint(b, 2, uint64(seen.Count)), nil
+}
+
+// grpcGenerateCheckDigit is the GenerateCheckDigit RPC
+func grpcGenerateCheckDigit(r *http.Request, req []byte) ([]byte, error) {
+	fields, err := stringFields(req)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := fieldAlgorithm(r, fields)
+	if err != nil {
+		return nil, err
+	}
+	digit, err := checksum.CheckDigitWith(alg, singular(fields, 1))
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	var b []byte
+	b = appendString(b, 1, string(digit))
+	b = appendString(b, 2, checksum.Normalize(singular(fields, 1))+string(digit))
+	return b, nil
+}
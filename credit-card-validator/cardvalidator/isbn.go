@@ -0,0 +1,85 @@
+package cardvalidator
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/codec"
+)
+
+// ISBNInfo is the body of an ISBN validation request
+type ISBNInfo struct {
+	ISBN string `json:"isbn" schema:"required"`
+}
+
+// ISBNResult is the verdict on an ISBN along with its other format. ISBNs
+// under the 979 prefix have no ISBN-10.
+type ISBNResult struct {
+	Verdict
+	// Format is the algorithm the ISBN was checked with, isbn-10 or isbn-13
+	Format string `json:"format,omitempty"`
+	ISBN10 string `json:"isbn10,omitempty"`
+	ISBN13 string `json:"isbn13,omitempty"`
+}
+
+// normalizeISBN drops the "ISBN" label and separators and upper cases the
+// X check character
+func normalizeISBN(isbn string) string {
+	isbn = strings.ToUpper(strings.TrimSpace(isbn))
+	isbn = strings.TrimLeft(strings.TrimPrefix(isbn, "ISBN"), ": ")
+	return checksum.Normalize(strings.TrimPrefix(strings.TrimPrefix(isbn, "-10"), "-13"))
+}
+
+// ValidateISBN checks isbn, in either format, and converts it to the other
+func ValidateISBN(isbn string) ISBNResult {
+	isbn = normalizeISBN(isbn)
+	switch len(isbn) {
+	case 0:
+		return ISBNResult{Verdict: Verdict{Reason: ReasonEmpty, Rule: "an ISBN is required"}}
+	case 10:
+		res := ISBNResult{Verdict: checkNumber(isbn, checksum.ISBN10), Format: checksum.ISBN10.Name()}
+		if res.Valid {
+			res.ISBN10 = isbn
+			res.ISBN13 = toISBN13(isbn)
+		}
+		return res
+	case 13:
+		res := ISBNResult{Verdict: checkNumber(isbn, checksum.ISBN13), Format: checksum.ISBN13.Name()}
+		if res.Valid && !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+			res.Verdict = Verdict{Reason: ReasonPrefix, Rule: "ISBN-13s start with 978 or 979"}
+		}
+		if res.Valid {
+			res.ISBN13 = isbn
+			res.ISBN10 = toISBN10(isbn)
+		}
+		return res
+	}
+	return ISBNResult{Verdict: Verdict{Reason: ReasonLength, Rule: "ISBNs have 10 or 13 characters"}}
+}
+
+// toISBN13 converts a valid ISBN-10 by prefixing 978 and computing the new
+// check digit
+func toISBN13(isbn10 string) string {
+	partial := "978" + isbn10[:9]
+	return partial + string(checksum.ISBN13.CheckDigit(partial))
+}
+
+// toISBN10 converts a valid ISBN-13, returning "" for the 979 prefix which
+// has no ISBN-10 equivalent
+func toISBN10(isbn13 string) string {
+	if !strings.HasPrefix(isbn13, "978") {
+		return ""
+	}
+	partial := isbn13[3:12]
+	return partial + string(checksum.ISBN10.CheckDigit(partial))
+}
+
+// validateISBN answers with the verdict on the ISBN in the body
+func validateISBN(w http.ResponseWriter, r *http.Request) {
+	var info ISBNInfo
+	if !decodeBody(w, r, &info) {
+		return
+	}
+	codec.Respond(w, r, http.StatusOK, ValidateISBN(info.ISBN))
+}
@@ -0,0 +1,64 @@
+package cardvalidator
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/stats"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cardMetrics counts the verdicts on card numbers of one Service
+type cardMetrics struct {
+	// results counts them by network, so a spike of invalid numbers stands
+	// out from a spike of traffic
+	results *prometheus.CounterVec
+	// stats counts the same verdicts for the stats store, which keeps them
+	// across restarts
+	stats *stats.Counter
+}
+
+func newCardMetrics() *cardMetrics {
+	return &cardMetrics{
+		results: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "card_validations_total",
+			Help:        "Card numbers validated by brand, result and failure reason.",
+			ConstLabels: prometheus.Labels{"service": Name},
+		}, []string{"brand", "result", "reason"}),
+		stats: stats.NewCounter(),
+	}
+}
+
+type cardMetricsKey struct{}
+
+// withCardMetrics returns a copy of ctx whose verdicts are counted in m
+func withCardMetrics(ctx context.Context, m *cardMetrics) context.Context {
+	return context.WithValue(ctx, cardMetricsKey{}, m)
+}
+
+// Middleware counts the verdicts of the requests it serves in m
+func (m *cardMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(withCardMetrics(r.Context(), m)))
+	})
+}
+
+// countResult records the verdict on number, a normalized card number, in
+// the metrics of the Service serving ctx. Verdicts outside of a Service, like
+// those of ValidateCard, aren't counted.
+func countResult(ctx context.Context, number string, v Verdict) {
+	m, ok := ctx.Value(cardMetricsKey{}).(*cardMetrics)
+	if !ok {
+		return
+	}
+	brand := detectBrand(number)
+	if brand == "" {
+		brand = "unknown"
+	}
+	result := stats.Valid
+	if !v.Valid {
+		result = stats.Invalid
+	}
+	m.results.WithLabelValues(string(brand), result, string(v.Reason)).Inc()
+	m.stats.Count(string(brand), result, string(v.Reason))
+}
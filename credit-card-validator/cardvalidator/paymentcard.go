@@ -0,0 +1,84 @@
+package cardvalidator
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/codec"
+)
+
+// Cardholder names have between 2 and 50 characters. Cards emboss at most
+// 26, but checkouts take the name as the cardholder writes it.
+const (
+	minNameLength = 2
+	maxNameLength = 50
+)
+
+// PaymentCard is the body of a payment card validation request, the fields
+// of a checkout form. None is required so a missing one is reported like an
+// invalid one.
+type PaymentCard struct {
+	CardNumber string `json:"cardNumber"`
+	// Expiry is MM/YY or MM/YYYY
+	Expiry string `json:"expiry"`
+	// CVV is never logged or answered with
+	CVV            string `json:"cvv"`
+	CardholderName string `json:"cardholderName"`
+}
+
+// PaymentCardReport is the verdict on each field of a PaymentCard
+type PaymentCardReport struct {
+	// Valid is whether every field is
+	Valid          bool             `json:"valid"`
+	CardNumber     ValidationResult `json:"cardNumber"`
+	Expiry         ExpiryResult     `json:"expiry"`
+	CVV            Verdict          `json:"cvv"`
+	CardholderName Verdict          `json:"cardholderName"`
+}
+
+// CheckCardholderName checks that name is long enough and only has letters,
+// spaces and the punctuation of names: apostrophes, hyphens and full stops
+func CheckCardholderName(name string) Verdict {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Verdict{Reason: ReasonEmpty, Rule: "a cardholder name is required"}
+	}
+	if n := utf8.RuneCountInString(name); n < minNameLength || n > maxNameLength {
+		return Verdict{Reason: ReasonLength, Rule: "cardholder names have 2 to 50 characters"}
+	}
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsMark(c) && !strings.ContainsRune(" '’-.", c) {
+			return Verdict{Reason: ReasonCharacter, Rule: "cardholder names only have letters, spaces, apostrophes, hyphens and full stops"}
+		}
+	}
+	return Verdict{Valid: true}
+}
+
+// validatePaymentCard answers with a report on every field of the payment
+// card in the body, so checkouts can mark all the wrong fields in one round
+// trip. Numbers are looked up and fingerprinted like by version 2 of
+// /validateCreditCard and expiry dates within soon of their end are flagged.
+func validatePaymentCard(lookups cardLookups, soon time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var card PaymentCard
+		if !decodeBody(w, r, &card) {
+			return
+		}
+		card.CardNumber = checksum.Normalize(card.CardNumber)
+		slog.InfoContext(r.Context(), "payment card received", "cardNumber", card.CardNumber)
+
+		report := PaymentCardReport{
+			CardNumber:     lookups.lookup(r.Context(), card.CardNumber, checksum.Luhn),
+			Expiry:         CheckExpiry(card.Expiry, time.Now(), soon),
+			CardholderName: CheckCardholderName(card.CardholderName),
+		}
+		report.CVV = CheckCVV(card.CVV, report.CardNumber.Brand)
+		report.Valid = report.CardNumber.Valid && report.Expiry.Valid && report.CVV.Valid && report.CardholderName.Valid
+		codec.Respond(w, r, http.StatusOK, report)
+	}
+}
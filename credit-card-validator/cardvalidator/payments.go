@@ -0,0 +1,53 @@
+package cardvalidator
+
+import (
+	"net/http"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/bic"
+	"github.com/ixmorrow/go-projects/credit-card-validator/iban"
+	"github.com/ixmorrow/go-projects/credit-card-validator/vat"
+	"github.com/ixmorrow/go-projects/shared/codec"
+)
+
+// IBANInfo is the body of an IBAN validation request
+type IBANInfo struct {
+	IBAN string `json:"iban" schema:"required"`
+}
+
+// validateIBAN answers with the verdict on the IBAN in the body. Account
+// numbers are never logged, recorded or mirrored.
+func validateIBAN(w http.ResponseWriter, r *http.Request) {
+	var info IBANInfo
+	if !decodeBody(w, r, &info) {
+		return
+	}
+	codec.Respond(w, r, http.StatusOK, iban.Validate(info.IBAN))
+}
+
+// BICInfo is the body of a BIC validation request
+type BICInfo struct {
+	BIC string `json:"bic" schema:"required"`
+}
+
+// validateBIC answers with the verdict on the BIC in the body and its parts
+func validateBIC(w http.ResponseWriter, r *http.Request) {
+	var info BICInfo
+	if !decodeBody(w, r, &info) {
+		return
+	}
+	codec.Respond(w, r, http.StatusOK, bic.Validate(info.BIC))
+}
+
+// VATInfo is the body of a VAT number validation request
+type VATInfo struct {
+	VAT string `json:"vat" schema:"required"`
+}
+
+// validateVAT answers with the verdict on the EU VAT number in the body
+func validateVAT(w http.ResponseWriter, r *http.Request) {
+	var info VATInfo
+	if !decodeBody(w, r, &info) {
+		return
+	}
+	codec.Respond(w, r, http.StatusOK, vat.Validate(info.VAT))
+}
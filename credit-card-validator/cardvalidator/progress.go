@@ -0,0 +1,92 @@
+package cardvalidator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+)
+
+// eventStreamContentType marks server-sent event responses
+const eventStreamContentType = "text/event-stream"
+
+// progressInterval is how often an upload reports its progress
+const progressInterval = 500 * time.Millisecond
+
+// UploadProgress is the data of the progress events of an upload
+type UploadProgress struct {
+	// Rows and Invalid count the rows checked so far and those that failed
+	Rows    int `json:"rows"`
+	Invalid int `json:"invalid"`
+	// BytesRead is how much of the request body has been read, out of
+	// BytesTotal when the client sent a Content-Length
+	BytesRead  int64 `json:"bytesRead"`
+	BytesTotal int64 `json:"bytesTotal,omitempty"`
+	// ETA estimates the seconds left from the rate so far, once it's known
+	ETA float64 `json:"etaSeconds,omitempty"`
+}
+
+// uploadEvents checks an upload like uploadCards, answering with server-sent
+// events so progress bars can follow big files: a progress event with an
+// UploadProgress every progressInterval, then a summary event with the
+// UploadSummary, or an error event if the file can't be read
+func uploadEvents(w http.ResponseWriter, r *http.Request, cr *csv.Reader, column int, alg checksum.Algorithm, body *countingReader) {
+	rc := prepareStream(w)
+	w.Header().Set("Content-Type", eventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	// stop proxies from buffering the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	start := time.Now()
+	send := func(event string, data any) error {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	progress := func(summary UploadSummary) UploadProgress {
+		p := UploadProgress{Rows: summary.Rows, Invalid: summary.Invalid, BytesRead: body.n, BytesTotal: r.ContentLength}
+		if p.BytesTotal > 0 && p.Rows > 0 {
+			elapsed := time.Since(start).Seconds()
+			p.ETA = elapsed*float64(p.BytesTotal)/float64(p.BytesRead) - elapsed
+		}
+		return p
+	}
+
+	// the first event tells the client the upload was accepted
+	if send("progress", progress(UploadSummary{})) != nil {
+		return
+	}
+	last := start
+	summary, err := summarizeCSV(r.Context(), cr, column, alg, func(summary UploadSummary) {
+		if time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+		send("progress", progress(summary))
+	})
+	if err != nil {
+		send("error", map[string]string{"error": "reading the CSV: " + err.Error()})
+		return
+	}
+	send("summary", summary)
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,80 @@
+package cardvalidator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/cache"
+)
+
+// resultCache remembers validation results, so retry storms repeating the
+// same numbers skip the checks and BIN lookups. Numbers are keyed by their
+// salted hash and cached without their Normalized form, so the cache never
+// sees a full number. Results may miss custom range changes for up to the
+// TTL. A nil resultCache caches nothing.
+type resultCache struct {
+	cache cache.Cache
+	salt  []byte
+	ttl   time.Duration
+}
+
+// newResultCache caches results in c for cfg.TTL, returning nil when the
+// TTL is zero. Without a configured salt a random one is drawn, which is
+// fine for the memory backend but keeps replicas sharing Redis from
+// sharing results.
+func newResultCache(c cache.Cache, cfg Results) *resultCache {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+	salt := []byte(cfg.Salt)
+	if len(salt) == 0 {
+		salt = make([]byte, 32)
+		rand.Read(salt)
+	}
+	return &resultCache{cache: c, salt: salt, ttl: cfg.TTL}
+}
+
+// key hashes number, normalized, with the algorithm it's checked with
+func (c *resultCache) key(number string, alg checksum.Algorithm) string {
+	number = checksum.Normalize(number)
+	h := hmac.New(sha256.New, c.salt)
+	if _, ok := alg.(*Scheme); ok {
+		h.Write([]byte("scheme:"))
+	}
+	h.Write([]byte(alg.Name() + "\x00" + alg.Alphabet() + "\x00" + number))
+	return "result:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns the cached result of number. Errors of the backend count as
+// misses.
+func (c *resultCache) get(ctx context.Context, number string, alg checksum.Algorithm) (ValidationResult, bool) {
+	if c == nil {
+		return ValidationResult{}, false
+	}
+	result, ok, err := cache.GetJSON[ValidationResult](ctx, c.cache, c.key(number, alg))
+	if err != nil {
+		slog.WarnContext(ctx, "reading cached result", "error", err)
+		return ValidationResult{}, false
+	}
+	if ok {
+		result.Normalized = checksum.Normalize(number)
+	}
+	return result, ok
+}
+
+// set caches result as the result of number
+func (c *resultCache) set(ctx context.Context, number string, alg checksum.Algorithm, result ValidationResult) {
+	if c == nil {
+		return
+	}
+	result.Normalized = ""
+	if err := cache.SetJSON(ctx, c.cache, c.key(number, alg), result, c.ttl); err != nil {
+		slog.WarnContext(ctx, "caching result", "error", err)
+	}
+}
@@ -0,0 +1,124 @@
+package cardvalidator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+)
+
+// Scheme is a preset for a national identifier checked with a card number
+// algorithm, applying the identifier's lengths and prefixes. Schemes are
+// algorithms themselves, so they can be used anywhere one is selected.
+type Scheme struct {
+	name string
+	// Description names the identifier for people
+	Description string
+	// Algorithm computes the check digit
+	Algorithm checksum.Algorithm
+	// Lengths are the lengths identifiers are issued in
+	Lengths []int
+	// Prefixes are the leading digits identifiers are issued with, any when
+	// empty
+	Prefixes []string
+	// CheckPrefix is prepended to identifiers before the check digit is
+	// computed, but isn't part of them
+	CheckPrefix string
+}
+
+func (s *Scheme) Name() string { return s.name }
+
+func (s *Scheme) Alphabet() string { return s.Algorithm.Alphabet() }
+
+func (s *Scheme) Valid(number string) bool {
+	return s.Algorithm.Valid(s.CheckPrefix + number)
+}
+
+func (s *Scheme) CheckDigit(partial string) byte {
+	return s.Algorithm.CheckDigit(s.CheckPrefix + partial)
+}
+
+// checkLength applies the length rule of s
+func (s *Scheme) checkLength(number string) Verdict {
+	if !slices.Contains(s.Lengths, len(number)) {
+		return Verdict{Reason: ReasonLength, Rule: fmt.Sprintf("%ss have %s digits", s.Description, describeLengths(s.Lengths))}
+	}
+	return Verdict{Valid: true}
+}
+
+// checkPrefix applies the prefix rule of s
+func (s *Scheme) checkPrefix(number string) Verdict {
+	if len(s.Prefixes) == 0 {
+		return Verdict{Valid: true}
+	}
+	for _, p := range s.Prefixes {
+		if strings.HasPrefix(number, p) {
+			return Verdict{Valid: true}
+		}
+	}
+	return Verdict{Reason: ReasonPrefix, Rule: fmt.Sprintf("%ss start with %s", s.Description, joinOr(s.Prefixes))}
+}
+
+var (
+	// CanadianSIN is the social insurance number. 0 and 8 aren't assigned
+	// as first digits.
+	CanadianSIN = &Scheme{
+		name:        "ca-sin",
+		Description: "Canadian SIN",
+		Algorithm:   checksum.Luhn,
+		Lengths:     []int{9},
+		Prefixes:    []string{"1", "2", "3", "4", "5", "6", "7", "9"},
+	}
+	// USNPI is the national provider identifier of US health care
+	// providers. Its check digit is computed as if it had the 80840 prefix
+	// of health care card issuers.
+	USNPI = &Scheme{
+		name:        "us-npi",
+		Description: "US NPI",
+		Algorithm:   checksum.Luhn,
+		Lengths:     []int{10},
+		Prefixes:    []string{"1", "2"},
+		CheckPrefix: "80840",
+	}
+	// SouthAfricanID is the South African identity number
+	SouthAfricanID = &Scheme{
+		name:        "za-id",
+		Description: "South African ID number",
+		Algorithm:   checksum.Luhn,
+		Lengths:     []int{13},
+	}
+	// IMEI identifies mobile phones
+	IMEI = &Scheme{
+		name:        "imei",
+		Description: "IMEI",
+		Algorithm:   checksum.Luhn,
+		Lengths:     []int{15},
+	}
+)
+
+// schemes can be selected by name
+var schemes = []*Scheme{CanadianSIN, USNPI, SouthAfricanID, IMEI}
+
+// SchemeNamed finds a scheme by name, ignoring case
+func SchemeNamed(name string) (*Scheme, bool) {
+	for _, s := range schemes {
+		if strings.EqualFold(s.name, name) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// requestScheme is SchemeNamed with an error listing the schemes
+func requestScheme(name string) (checksum.Algorithm, error) {
+	s, ok := SchemeNamed(name)
+	if !ok {
+		names := make([]string, len(schemes))
+		for i, s := range schemes {
+			names[i] = s.name
+		}
+		return nil, fmt.Errorf("unknown scheme %q, use one of %s", name, strings.Join(names, ", "))
+	}
+	return s, nil
+}
@@ -0,0 +1,323 @@
+package cardvalidator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/credit-card-validator/bin"
+	"github.com/ixmorrow/go-projects/credit-card-validator/stats"
+	"github.com/ixmorrow/go-projects/credit-card-validator/vault"
+	"github.com/ixmorrow/go-projects/shared/buildinfo"
+	"github.com/ixmorrow/go-projects/shared/config"
+	"github.com/ixmorrow/go-projects/shared/graphql"
+	"github.com/ixmorrow/go-projects/shared/jobs"
+	"github.com/ixmorrow/go-projects/shared/loadshed"
+	"github.com/ixmorrow/go-projects/shared/metering"
+	"github.com/ixmorrow/go-projects/shared/schema"
+	"github.com/ixmorrow/go-projects/shared/service"
+	"github.com/ixmorrow/go-projects/shared/storage"
+	"github.com/ixmorrow/go-projects/shared/versioning"
+	"github.com/ixmorrow/go-projects/shared/webhook"
+)
+
+// Name is the service name used in logs, metrics and configuration
+const Name = "credit-card-validator"
+
+// Options configures a Service
+type Options struct {
+	// Config is the service configuration, normally read with config.Load
+	Config Config
+	// Args are the command line arguments the configuration is read from
+	// again when it is reloaded. Without them a reload only reads the file
+	// and the environment.
+	Args []string
+	// Logger is used for request logs. It defaults to a JSON logger at
+	// Config.Log.Level.
+	Logger *slog.Logger
+	// Level is set to the new log level on reloads. The default Logger reads
+	// its level from it; a Logger of your own only does if you built it so.
+	Level *slog.LevelVar
+}
+
+// Service is a credit card validator that can be embedded in another
+// program, either by serving its Handler on a router of its own or by
+// letting Run serve it on the configured listeners
+type Service struct {
+	core     *service.Core
+	reloader *config.Reloader[Config]
+	verdicts *cardMetrics
+	custom   *bin.Watcher
+	stats    stats.Store
+	sockets  *openSockets
+}
+
+// jobSealer seals the card numbers of batch jobs with a key derived from
+// the vault key, or a random one when there's none, so jobs can't be
+// recovered after a restart
+func jobSealer(cfg Vault) (*vault.Sealer, error) {
+	var key []byte
+	var err error
+	if cfg.Key != "" {
+		key, err = vault.ParseKey(cfg.Key)
+	} else {
+		key, err = vault.NewKey()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vault.NewSealer(key, "batch-jobs")
+}
+
+// openStatsStore keeps validation statistics in the database when one is
+// configured, in a SQLite file of their own when cfg names one and in memory
+// otherwise
+func (s *Service) openStatsStore(cfg Stats, db *storage.DB) (stats.Store, error) {
+	if db == nil && cfg.File != "" {
+		var err error
+		if db, err = storage.Open(context.Background(), cfg.File); err != nil {
+			return nil, err
+		}
+		s.core.AddCloser(db)
+	}
+	if db != nil {
+		return stats.NewSQLStore(context.Background(), db)
+	}
+	return stats.NewMemoryStore(), nil
+}
+
+// openVault keeps tokenized cards in the database when one is configured
+// and in memory otherwise. It returns nil when cfg has no key.
+func openVault(cfg Vault, db *storage.DB) (*vault.Vault, error) {
+	if cfg.Key == "" {
+		return nil, nil
+	}
+	key, err := vault.ParseKey(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	var store vault.Store = vault.NewMemoryStore()
+	if db != nil {
+		if store, err = vault.NewSQLStore(context.Background(), db); err != nil {
+			return nil, err
+		}
+	} else {
+		slog.Warn("tokenized cards are kept in memory and lost on restart, configure a database to keep them")
+	}
+	return vault.New(store, key)
+}
+
+// New opens the stores described by opts.Config, starts the batch job
+// runner and builds the routes. Call Shutdown when done with the Service,
+// unless Run was used, which shuts it down itself.
+func New(opts Options) (*Service, error) {
+	core, err := service.New(opts.Config.Base, service.Options{
+		Name:       Name,
+		Prefix:     "ccv:",
+		RateGroups: []string{"validate", "batch", "grpc", "graphql"},
+		Sanitize:   sanitizeTraffic,
+		Logger:     opts.Logger,
+		Level:      opts.Level,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{core: core, verdicts: newCardMetrics(), sockets: newOpenSockets()}
+	if err := s.build(opts.Config, opts.Args); err != nil {
+		return nil, errors.Join(err, s.Shutdown(context.Background()))
+	}
+	return s, nil
+}
+
+// build opens the stores of the validator and registers its job types and
+// routes, adding anything that needs closing to the core as it goes
+func (s *Service) build(cfg Config, args []string) error {
+	c := s.core
+	m := c.Metrics
+	m.Registry().MustRegister(s.verdicts.results)
+	c.Router.Use(s.verdicts.Middleware)
+	// sockets are drained before the statistics are flushed, their last
+	// verdicts count too
+	c.OnShutdown(s.sockets.drain)
+	c.OnShutdown(func(ctx context.Context) error {
+		if s.stats == nil {
+			return nil
+		}
+		return s.verdicts.stats.Flush(ctx, s.stats)
+	})
+
+	sealer, err := jobSealer(cfg.Vault)
+	if err != nil {
+		return err
+	}
+	c.Runner.Register(batchJob, runBatch(sealer, cfg.Batch.Workers, s.verdicts))
+	var sender *webhook.Sender
+	if opts, ok := cfg.WebhookOptions(); ok {
+		if sender, err = webhook.New(opts); err != nil {
+			return err
+		}
+		c.AddCloser(sender)
+		c.Runner.OnFinish(notifyBatch(sender))
+	}
+	if err := c.Runner.Start(context.Background()); err != nil {
+		return err
+	}
+
+	if s.stats, err = s.openStatsStore(cfg.Stats, c.DB); err != nil {
+		return err
+	}
+	c.Go(func(ctx context.Context) { s.verdicts.stats.Run(ctx, s.stats, 10*time.Second) })
+	cards, err := openVault(cfg.Vault, c.DB)
+	if err != nil {
+		return err
+	}
+
+	bins := bin.Default()
+	c.AddComponent("algorithm", func() string { return algorithmVersion })
+	c.AddComponent("binDataset", bins.Version)
+	if cfg.BIN.CustomFile != "" {
+		s.custom, err = bin.Watch(cfg.BIN.CustomFile)
+		if err != nil {
+			return fmt.Errorf("loading custom BIN ranges: %w", err)
+		}
+		c.AddComponent("customBins", func() string {
+			t := s.custom.Table()
+			return fmt.Sprintf("%s, %d ranges, loaded %s", t.Version(), t.Len(), s.custom.Loaded().UTC().Format(time.RFC3339))
+		})
+		c.Go(func(ctx context.Context) { s.custom.Run(ctx, cfg.BIN.CheckEvery) })
+	}
+	lookups := cardLookups{bins: bins, custom: s.custom, results: newResultCache(c.Cache, cfg.Results)}
+	if lookups.prints, err = newFingerprinter(cfg.Fingerprints.Keys); err != nil {
+		return err
+	}
+	if lookups.tests, err = newTestCards(cfg.TestCards.Numbers); err != nil {
+		return err
+	}
+
+	r := c.Router
+	r.PathPrefix("/ui/").Handler(uiHandler()).Methods("GET")
+	r.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently)).Methods("GET")
+	// the page loads the document relative to itself, so it works under a
+	// mount prefix too
+	docs := apiSpec(buildinfo.Read(Name, nil).Version)
+	r.Handle("/docs/openapi.json", docs.Handler()).Methods("GET")
+	r.Handle("/docs", docs.UI("docs/openapi.json")).Methods("GET")
+
+	// cheap and expensive routes shed load separately so a flood of batch
+	// or report requests can't starve the single validations
+	cheapLimits, expensiveLimits := cfg.ShedLimits()
+	shedder := loadshed.New(m.Registry())
+	shedCheap := shedder.Limit("validate", cheapLimits)
+	shedExpensive := shedder.Limit("batch", expensiveLimits)
+	deprecations := versioning.NewDeprecations(m.Registry())
+	getWithBody := deprecations.Deprecate(versioning.Policy{
+		Deprecated: getWithBodyDeprecated,
+		Successor:  "/api/v1/validateCreditCard",
+	})
+	paymentCard := validatePaymentCard(lookups, cfg.Expiry.SoonWithin)
+	validateRoutes := func(validate *mux.Router, handle http.HandlerFunc) {
+		validate.Use(c.Faults, c.Auth.Require(scopeValidate))
+		single := validate.NewRoute().Subrouter()
+		single.Use(c.Limiters["validate"].Middleware, c.Meter.Middleware)
+		validateHandler := shedCheap(c.Record(c.Mirror(cardFromQuery(schema.Body[CardInfo]()(handle)))))
+		single.Handle("/validateCreditCard", validateHandler).Methods("POST")
+		single.Handle("/validateCreditCard", validateHandler).Methods("GET").Queries("cardNumber", "{cardNumber}")
+		single.Handle("/validateCreditCard", getWithBody(validateHandler)).Methods("GET")
+		single.HandleFunc("/generateTestCards", generateTestCards).Methods("GET")
+		single.Handle("/checkDigit", shedCheap(schema.Body[PartialNumber]()(http.HandlerFunc(completeNumber)))).Methods("POST")
+		single.Handle("/validateIBAN", shedCheap(schema.Body[IBANInfo]()(http.HandlerFunc(validateIBAN)))).Methods("POST")
+		single.Handle("/validateBIC", shedCheap(schema.Body[BICInfo]()(http.HandlerFunc(validateBIC)))).Methods("POST")
+		single.Handle("/validateISBN", shedCheap(schema.Body[ISBNInfo]()(http.HandlerFunc(validateISBN)))).Methods("POST")
+		single.Handle("/validateVAT", shedCheap(schema.Body[VATInfo]()(http.HandlerFunc(validateVAT)))).Methods("POST")
+		single.Handle("/validateExpiry", shedCheap(schema.Body[ExpiryInfo]()(validateExpiry(cfg.Expiry.SoonWithin)))).Methods("POST")
+		single.Handle("/validatePaymentCard", shedCheap(c.Record(c.Mirror(schema.Body[PaymentCard]()(paymentCard))))).Methods("POST")
+		if cards != nil {
+			// never recorded or mirrored, which would copy the cards
+			tokenRoutes(single, cards, shedCheap, c.Auth.Require(scopeDetokenize))
+		}
+		batch := validate.NewRoute().Subrouter()
+		batch.Use(c.Limiters["batch"].Middleware, c.Meter.Middleware, shedExpensive)
+		// streams and uploads skip recording and mirroring, which hold bodies
+		// in memory
+		batch.HandleFunc("/validateCreditCards", streamCards).Methods("POST").
+			HeadersRegexp("Content-Type", "^application/(x-)?ndjson")
+		batch.HandleFunc("/validateCreditCards/upload", uploadCards).Methods("POST")
+		batch.HandleFunc("/validateCreditCards/socket", socketCards(s.sockets)).Methods("GET")
+		batch.Handle("/validateCreditCards/jobs", schema.Body[[]string]()(submitBatch(c.Runner, sealer, sender))).Methods("POST")
+		batch.Handle("/validateCreditCards", c.Record(c.Mirror(schema.Body[[]string]()(validateCards(cfg.Batch.Workers))))).Methods("POST")
+		jobs.RegisterRoutes(batch, c.Jobs)
+	}
+	versions := versioning.New(r, "/api").WithDeprecations(deprecations)
+	// v2 answers with an object that has room for more than the Luhn result
+	cardV2 := validateCardV2(lookups)
+	// v1 callers get it too once the v2-response flag is on for them
+	cardV1 := c.Features.Switch(flagV2Response, cardV2, http.HandlerFunc(validateCard)).ServeHTTP
+	validateRoutes(versions.Version("v1", versioning.Policy{}), cardV1)
+	validateRoutes(versions.Alias("/v1", "v1"), cardV1)
+	// the unversioned routes stay for existing clients, answering like v1
+	validateRoutes(versions.Unversioned("v1"), cardV1)
+	validateRoutes(versions.Version("v2", versioning.Policy{}), cardV2)
+	// gRPC shares the port, which must serve HTTP/2 for it
+	grpc := r.PathPrefix(grpcService).Methods("POST").
+		HeadersRegexp("Content-Type", "^application/grpc").Subrouter()
+	grpc.Use(c.Faults, c.Auth.Require(scopeValidate), c.Limiters["grpc"].Middleware, c.Meter.Middleware)
+	grpcRoutes(grpc, bins, shedCheap, shedExpensive)
+	// one GraphQL query can hold many lookups, so it's shed like a batch
+	gql := r.Path("/graphql").Methods("GET", "POST").Subrouter()
+	gql.Use(c.Faults, c.Auth.Require(scopeValidate), c.Limiters["graphql"].Middleware, c.Meter.Middleware)
+	gql.NewRoute().Handler(shedExpensive(graphql.Handler(graphQLSchema(bins))))
+
+	// usage reports aren't metered so callers can still check them once
+	// their quota is used up
+	usage := r.NewRoute().Subrouter()
+	usage.Use(c.Auth.Require(scopeValidate), shedExpensive)
+	metering.RegisterRoutes(usage, c.Usage)
+
+	s.reloader = config.NewReloader(Name, args, cfg)
+	s.reloader.OnReload(func(cfg Config) { c.Reload(cfg.Base) })
+	admin := c.Admin(s.reloader)
+	stats.RegisterAdminRoutes(admin, s.stats)
+	c.Dash.AddLink("Validation stats", "/admin/stats")
+	c.Dash.AddLink("API docs", "/docs")
+	return nil
+}
+
+// Handler serves the API, the UI and the admin routes. Mount it under a
+// prefix with http.StripPrefix; Start must be running for usage to be
+// recorded and for the dashboard to show traffic.
+func (s *Service) Handler() http.Handler {
+	return s.core.Router
+}
+
+// Start runs the background work of the Service until ctx is done, see
+// service.Core.Start, flushing the validation statistics too and reloading
+// custom BIN ranges when their file changes
+func (s *Service) Start(ctx context.Context) {
+	s.core.Start(ctx)
+}
+
+// Shutdown closes the open sockets and waits for running batch jobs,
+// flushes the usage counts and validation statistics and closes the
+// database and log files
+func (s *Service) Shutdown(ctx context.Context) error {
+	return s.core.Shutdown(ctx)
+}
+
+// Run serves the Service until ctx is done, see service.Core.Run. It shuts
+// the Service down before returning.
+func (s *Service) Run(ctx context.Context) error {
+	return s.core.Run(ctx)
+}
+
+// Run creates a Service from opts and runs it until ctx is done
+func Run(ctx context.Context, opts Options) error {
+	s, err := New(opts)
+	if err != nil {
+		return err
+	}
+	return s.Run(ctx)
+}
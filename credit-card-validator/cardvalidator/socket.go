@@ -0,0 +1,186 @@
+package cardvalidator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/respond"
+	"golang.org/x/net/websocket"
+)
+
+// socketBacklog is how many results may wait for a slow client before
+// reading its messages stops
+const socketBacklog = 64
+
+// socketRequest is a message a client sends over the socket: a card with an
+// optional id its result echoes
+type socketRequest struct {
+	ID json.RawMessage `json:"id,omitempty"`
+	CardInfo
+}
+
+// SocketResult is the answer to one socket message
+type SocketResult struct {
+	// ID is the id of the message, if it had one
+	ID json.RawMessage `json:"id,omitempty"`
+	BatchResult
+}
+
+// socketCards upgrades the request to a WebSocket over which the client
+// sends card records, as JSON text messages, for as long as it likes. Each
+// gets a SocketResult as soon as it's checked, with the index of the
+// message and its id, while the next ones are read. Records are checked
+// like those of a stream, repeats included. Sockets are tracked in open so
+// shutdown can drain them.
+func socketCards(open *openSockets) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alg, err := requestAlgorithm(r, "", "", "")
+		if err != nil {
+			respond.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// the connection outlasts the server timeouts
+		prepareStream(w)
+		websocket.Server{Handshake: sameOrigin, Handler: func(ws *websocket.Conn) {
+			if !open.add(ws) {
+				return
+			}
+			defer open.remove(ws)
+			serveSocket(r, ws, alg)
+		}}.ServeHTTP(hijacker{w}, r)
+	}
+}
+
+// serveSocket answers the records sent over ws until the client stops
+// sending or the socket's read deadline passes
+func serveSocket(r *http.Request, ws *websocket.Conn, alg checksum.Algorithm) {
+	ws.MaxPayloadBytes = maxRecordBytes
+	results := make(chan SocketResult, socketBacklog)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for result := range results {
+			if err := websocket.JSON.Send(ws, result); err != nil {
+				// closing ends the read loop too
+				ws.Close()
+				break
+			}
+		}
+		// let the read loop finish if it's blocked on a full backlog
+		for range results {
+		}
+	}()
+	seen := newDuplicates()
+	for index := 0; ; index++ {
+		var req socketRequest
+		err := websocket.JSON.Receive(ws, &req)
+		var syntax *json.SyntaxError
+		var typ *json.UnmarshalTypeError
+		switch {
+		case err == nil:
+			card := req.CardInfo
+			result := seen.check(recordKey(card), index, func() Verdict { return checkRecord(r.Context(), card, alg) })
+			results <- SocketResult{ID: req.ID, BatchResult: result}
+			continue
+		case errors.As(err, &syntax), errors.As(err, &typ), errors.Is(err, websocket.ErrFrameTooLarge):
+			// the message is skipped and the socket stays usable
+			results <- SocketResult{BatchResult: BatchResult{Index: index, Verdict: Verdict{Reason: ReasonMalformed}}}
+			continue
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			// shutting down, the results due still go out
+		case !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed):
+			slog.WarnContext(r.Context(), "reading card socket", "error", err, "records", index)
+		}
+		break
+	}
+	close(results)
+	wg.Wait()
+}
+
+// openSockets tracks the card sockets, which the server's shutdown doesn't
+// wait for since they're hijacked connections
+type openSockets struct {
+	mu       sync.Mutex
+	conns    map[*websocket.Conn]struct{}
+	draining bool
+	wg       sync.WaitGroup
+}
+
+func newOpenSockets() *openSockets {
+	return &openSockets{conns: make(map[*websocket.Conn]struct{})}
+}
+
+// add tracks ws, reporting false when sockets are being drained
+func (o *openSockets) add(ws *websocket.Conn) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.draining {
+		return false
+	}
+	o.conns[ws] = struct{}{}
+	o.wg.Add(1)
+	return true
+}
+
+func (o *openSockets) remove(ws *websocket.Conn) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.conns, ws)
+	o.wg.Done()
+}
+
+// drain stops the sockets reading records and waits until they've sent the
+// results of those already read, or ctx is done
+func (o *openSockets) drain(ctx context.Context) error {
+	o.mu.Lock()
+	o.draining = true
+	for ws := range o.conns {
+		ws.SetReadDeadline(time.Now())
+	}
+	o.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sameOrigin turns away browsers connecting from pages of other sites, which
+// could otherwise use credentials the browser holds for this one. Clients
+// that aren't browsers send no origin.
+func sameOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	if origin != nil && origin.Host != r.Host {
+		return errors.New("cross-origin WebSocket")
+	}
+	config.Origin = origin
+	return nil
+}
+
+// hijacker lets the websocket package take over connections whose response
+// writers are wrapped by middleware
+type hijacker struct{ http.ResponseWriter }
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(h.ResponseWriter).Hijack()
+}
@@ -0,0 +1,110 @@
+package cardvalidator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// ndjsonContentType marks request and response bodies of newline
+// delimited JSON
+const ndjsonContentType = "application/x-ndjson"
+
+const (
+	// maxRecordBytes bounds one line of a stream
+	maxRecordBytes = 64 << 10
+	// flushEvery is how many results are buffered before they're sent
+	flushEvery = 100
+)
+
+// ReasonMalformed marks stream lines that aren't a card record
+const ReasonMalformed Reason = "malformed_record"
+
+// streamCards validates a body of newline delimited card records and writes
+// a result per record as a line of JSON while the body is still being read,
+// so files of any size are checked in constant memory. Results carry the
+// index of their record among the non-blank lines, and repeated records
+// point at their first occurrence. Records are checked with
+// the scheme, algorithm and alphabet they name, or else the ones ?scheme=,
+// ?algorithm= and ?alphabet= select.
+func streamCards(w http.ResponseWriter, r *http.Request) {
+	alg, err := requestAlgorithm(r, "", "", "")
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rc := prepareStream(w)
+	w.Header().Set("Content-Type", ndjsonContentType)
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+
+	in := bufio.NewScanner(r.Body)
+	in.Buffer(make([]byte, 0, 4096), maxRecordBytes)
+	index := 0
+	seen := newDuplicates()
+	for in.Scan() {
+		line := bytes.TrimSpace(in.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		result := BatchResult{Index: index, Verdict: Verdict{Reason: ReasonMalformed}}
+		var card CardInfo
+		if err := json.Unmarshal(line, &card); err == nil {
+			result = seen.check(recordKey(card), index, func() Verdict { return checkRecord(r.Context(), card, alg) })
+		}
+		if err := enc.Encode(result); err != nil {
+			return
+		}
+		index++
+		if index%flushEvery == 0 {
+			if out.Flush() != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+	if err := in.Err(); err != nil {
+		// the status is long sent, so the error can only go in the stream
+		slog.WarnContext(r.Context(), "reading card stream", "error", err, "records", index)
+		enc.Encode(map[string]string{"error": err.Error()})
+	}
+	out.Flush()
+}
+
+// checkRecord checks the card of a stream record with the scheme,
+// algorithm and alphabet it names, or else with alg
+func checkRecord(ctx context.Context, card CardInfo, alg checksum.Algorithm) Verdict {
+	if card.Scheme != "" || card.Algorithm != "" || card.Alphabet != "" {
+		var err error
+		if alg, err = pickAlgorithm(card.Scheme, card.Algorithm, card.Alphabet); err != nil {
+			return Verdict{Reason: ReasonMalformed, Rule: err.Error()}
+		}
+	}
+	return checkCard(ctx, checksum.Normalize(card.CardNumber), alg)
+}
+
+// recordKey tells apart the records of a stream by number and the
+// algorithm they name
+func recordKey(card CardInfo) string {
+	return card.Scheme + "\x00" + card.Algorithm + "\x00" + card.Alphabet + "\x00" + checksum.Normalize(card.CardNumber)
+}
+
+// prepareStream lets a handler write its response while it still reads the
+// request body. The handler must read from the body before it writes: the
+// status goes out with the first write, and clients waiting for 100
+// Continue only send the body once it's read from.
+func prepareStream(w http.ResponseWriter) *http.ResponseController {
+	rc := http.NewResponseController(w)
+	// HTTP/1 servers stop reading the body once the response starts
+	// unless told otherwise, and streams outlast the server timeouts
+	rc.EnableFullDuplex()
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+	return rc
+}
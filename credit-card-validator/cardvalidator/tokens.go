@@ -0,0 +1,113 @@
+package cardvalidator
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/credit-card-validator/vault"
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/codec"
+	"github.com/ixmorrow/go-projects/shared/logging"
+	"github.com/ixmorrow/go-projects/shared/schema"
+)
+
+// scopeDetokenize lets an API key read the numbers behind tokens
+const scopeDetokenize = "detokenize"
+
+// TokenResult is the token of a card with what may be shown of the card
+type TokenResult struct {
+	Token string `json:"token"`
+	// Number is the card number, masked
+	Number string `json:"number"`
+	Brand  Brand  `json:"brand,omitempty"`
+}
+
+// Detokenized is the card number behind a token
+type Detokenized struct {
+	CardNumber string `json:"cardNumber"`
+}
+
+// tokenRoutes adds the vault to r, which requires the validate scope:
+//
+//	POST /tokenize                   the token of the valid card in the body
+//	GET  /tokens/{token}             the verdict on the card behind a token
+//	POST /tokens/{token}/detokenize  the card number behind a token
+//
+// Reading tokens also takes the detokenize scope, which requireDetokenize
+// checks. Tokens belong to the caller's tenant. All of them are shed with
+// shed like the other single validations.
+func tokenRoutes(r *mux.Router, v *vault.Vault, shed, requireDetokenize mux.MiddlewareFunc) {
+	r.Handle("/tokenize", shed(schema.Body[CardInfo]()(tokenize(v)))).Methods("POST")
+	r.Handle("/tokens/{token}", requireDetokenize(shed(validateToken(v)))).Methods("GET")
+	r.Handle("/tokens/{token}/detokenize", requireDetokenize(shed(detokenizeCard(v)))).Methods("POST")
+}
+
+// tokenize answers with the token of the card number in the body, which
+// has to be valid
+func tokenize(v *vault.Vault) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cardInfo, ok := decodeCard(w, r)
+		if !ok {
+			return
+		}
+		verdict := checkCard(r.Context(), cardInfo.CardNumber, checksum.Luhn)
+		if !verdict.Valid {
+			codec.Error(w, r, http.StatusUnprocessableEntity, "only valid card numbers are tokenized: "+verdict.Rule)
+			return
+		}
+		token, err := v.Tokenize(r.Context(), auth.Tenant(r.Context()), cardInfo.CardNumber)
+		if err != nil {
+			codec.Error(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		codec.Respond(w, r, http.StatusOK, TokenResult{
+			Token:  token,
+			Number: logging.MaskPAN(cardInfo.CardNumber),
+			Brand:  detectBrand(cardInfo.CardNumber),
+		})
+	}
+}
+
+// validateToken answers with the verdict on the card behind the token, as
+// for version 2 of validateCreditCard but without the issuer lookups
+func validateToken(v *vault.Vault) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		number, ok := detokenizeRequest(w, r, v)
+		if !ok {
+			return
+		}
+		codec.Respond(w, r, http.StatusOK, validateWith(r.Context(), number, checksum.Luhn))
+	}
+}
+
+// detokenizeCard answers with the card number behind the token. Every
+// detokenization is logged with the caller.
+func detokenizeCard(v *vault.Vault) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		number, ok := detokenizeRequest(w, r, v)
+		if !ok {
+			return
+		}
+		p, _ := auth.FromContext(r.Context())
+		slog.InfoContext(r.Context(), "card detokenized", "token", mux.Vars(r)["token"], "key", p.ID)
+		codec.Respond(w, r, http.StatusOK, Detokenized{CardNumber: number})
+	}
+}
+
+// detokenizeRequest looks up the token of the request path, answering 404
+// when the caller's tenant has no such token
+func detokenizeRequest(w http.ResponseWriter, r *http.Request, v *vault.Vault) (string, bool) {
+	number, err := v.Detokenize(r.Context(), auth.Tenant(r.Context()), mux.Vars(r)["token"])
+	if errors.Is(err, vault.ErrNotFound) {
+		codec.Error(w, r, http.StatusNotFound, err.Error())
+		return "", false
+	}
+	if err != nil {
+		codec.Error(w, r, http.StatusInternalServerError, err.Error())
+		return "", false
+	}
+	return number, true
+}
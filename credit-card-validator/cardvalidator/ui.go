@@ -0,0 +1,20 @@
+package cardvalidator
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the embedded web UI under /ui/. The page calls the API
+// with the key its user enters, so it needs no authentication itself.
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(files)))
+}
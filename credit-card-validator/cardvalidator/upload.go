@@ -0,0 +1,240 @@
+package cardvalidator
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/checksum"
+	"github.com/ixmorrow/go-projects/shared/codec"
+)
+
+// uploadField is the multipart form field holding the CSV file
+const uploadField = "file"
+
+// maxListedFailures bounds the failures an upload summary lists; the
+// counts cover all of them
+const maxListedFailures = 1000
+
+// cardColumns are the header names, lower case and without separators,
+// taken for the card number column when the caller doesn't name one
+var cardColumns = []string{"cardnumber", "cardno", "card", "pan", "ccnumber", "number"}
+
+// UploadSummary is the JSON answer to a CSV upload
+type UploadSummary struct {
+	Rows int `json:"rows"`
+	// Duplicates counts the rows repeating the number of an earlier one,
+	// which are checked once
+	Duplicates int `json:"duplicates"`
+	Valid      int `json:"valid"`
+	Invalid    int `json:"invalid"`
+	// Reasons counts the invalid rows by reason
+	Reasons map[Reason]int `json:"reasons"`
+	// Failures lists the first invalid rows
+	Failures []UploadFailure `json:"failures"`
+}
+
+// UploadFailure is an invalid row of an uploaded file
+type UploadFailure struct {
+	// Line is the row's line in the file, the header being line 1
+	Line   int    `json:"line"`
+	Reason Reason `json:"reason"`
+	Rule   string `json:"rule"`
+}
+
+// uploadCards validates the card number column of a CSV file sent as the
+// "file" field of a multipart form. Callers accepting text/csv get the file
+// back with valid and reason columns added, callers accepting
+// text/event-stream get progress events while it's read, and everyone else
+// gets a summary. The column is found by its header or named with
+// ?column=, and ?scheme=, ?algorithm= and ?alphabet= select the check digit
+// algorithm. Files are streamed, so they can be of any size.
+func uploadCards(w http.ResponseWriter, r *http.Request) {
+	alg, err := requestAlgorithm(r, "", "", "")
+	if err != nil {
+		codec.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// files of any size outlast the server timeouts
+	prepareStream(w)
+	// counting the body's bytes tells event stream callers how far along
+	// the upload is
+	body := &countingReader{ReadCloser: r.Body}
+	r.Body = body
+	mr, err := r.MultipartReader()
+	if err != nil {
+		codec.Error(w, r, http.StatusUnsupportedMediaType, "upload the CSV as multipart/form-data")
+		return
+	}
+	var file io.Reader
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			codec.Error(w, r, http.StatusBadRequest, "invalid multipart body: "+err.Error())
+			return
+		}
+		if part.FormName() == uploadField {
+			file = part
+			break
+		}
+	}
+	if file == nil {
+		codec.Error(w, r, http.StatusBadRequest, "the form has no "+uploadField+" field")
+		return
+	}
+
+	cr := csv.NewReader(file)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		codec.Error(w, r, http.StatusBadRequest, "reading the CSV header: "+err.Error())
+		return
+	}
+	column := cardColumn(header, r.URL.Query().Get("column"))
+	if column < 0 {
+		codec.Error(w, r, http.StatusBadRequest, "no card number column found, name it with ?column=")
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), eventStreamContentType) {
+		uploadEvents(w, r, cr, column, alg, body)
+		return
+	}
+	if codec.Negotiate(r.Header.Get("Accept")) == codec.CSV {
+		annotateCSV(w, r, cr, append([]string(nil), header...), column, alg)
+		return
+	}
+	summary, err := summarizeCSV(r.Context(), cr, column, alg, nil)
+	if err != nil {
+		codec.Error(w, r, http.StatusBadRequest, "reading the CSV: "+err.Error())
+		return
+	}
+	codec.Respond(w, r, http.StatusOK, summary)
+}
+
+// summarizeCSV checks the rows of cr, calling progress with the summary so
+// far every flushEvery rows when it's set
+func summarizeCSV(ctx context.Context, cr *csv.Reader, column int, alg checksum.Algorithm, progress func(UploadSummary)) (UploadSummary, error) {
+	summary := UploadSummary{Reasons: map[Reason]int{}, Failures: []UploadFailure{}}
+	seen := newDuplicates()
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return summary, nil
+		}
+		if err != nil {
+			return summary, err
+		}
+		summary.Rows++
+		if progress != nil && summary.Rows%flushEvery == 0 {
+			progress(summary)
+		}
+		number := cardField(record, column)
+		v := seen.check(number, summary.Rows, func() Verdict { return checkCard(ctx, number, alg) }).Verdict
+		summary.Duplicates = seen.Count
+		if v.Valid {
+			summary.Valid++
+			continue
+		}
+		summary.Invalid++
+		summary.Reasons[v.Reason]++
+		if len(summary.Failures) < maxListedFailures {
+			line, _ := cr.FieldPos(0)
+			summary.Failures = append(summary.Failures, UploadFailure{Line: line, Reason: v.Reason, Rule: v.Rule})
+		}
+	}
+}
+
+// annotateCSV writes the rows of cr back with valid and reason columns
+// while they're read
+func annotateCSV(w http.ResponseWriter, r *http.Request, cr *csv.Reader, header []string, column int, alg checksum.Algorithm) {
+	rc := prepareStream(w)
+	w.Header().Set("Content-Type", codec.CSV.ContentType())
+	out := bufio.NewWriterSize(w, 64<<10)
+	cw := csv.NewWriter(out)
+	cw.Write(append(header, "valid", "reason"))
+	rows := 0
+	seen := newDuplicates()
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if rows < flushEvery {
+				// nothing has been sent yet, so the caller can still be told
+				codec.Error(w, r, http.StatusBadRequest, "reading the CSV: "+err.Error())
+				return
+			}
+			// a CSV has no place for the error, so cut the response short
+			// rather than let it pass for the whole file
+			slog.WarnContext(r.Context(), "reading uploaded CSV", "error", err, "rows", rows)
+			panic(http.ErrAbortHandler)
+		}
+		number := cardField(record, column)
+		v := seen.check(number, rows, func() Verdict { return checkCard(r.Context(), number, alg) }).Verdict
+		cw.Write(append(record, fmt.Sprint(v.Valid), string(v.Reason)))
+		rows++
+		if rows%flushEvery == 0 {
+			cw.Flush()
+			if out.Flush() != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+	cw.Flush()
+	out.Flush()
+}
+
+// cardColumn finds the card number column in header: the one called name
+// when it's given, otherwise the first with a usual name, or the only one
+func cardColumn(header []string, name string) int {
+	if name != "" {
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, want := range cardColumns {
+		for i, h := range header {
+			if normalizeHeader(h) == want {
+				return i
+			}
+		}
+	}
+	if len(header) == 1 {
+		return 0
+	}
+	return -1
+}
+
+// normalizeHeader lower cases h and drops spaces, dashes and underscores
+func normalizeHeader(h string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_':
+			return -1
+		}
+		return r
+	}, strings.ToLower(h))
+}
+
+// cardField is the normalized card number in record, empty when the row is
+// short
+func cardField(record []string, column int) string {
+	if column >= len(record) {
+		return ""
+	}
+	return checksum.Normalize(record[column])
+}
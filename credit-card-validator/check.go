@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/cardvalidator"
+)
+
+// Exit codes of the check command
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitUsage   = 2
+)
+
+// check validates the card numbers in args, or one per line of stdin when
+// there are none, without starting the service. It prints a result per
+// number and exits non-zero when any of them is invalid, for scripts.
+func check(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "output format: text, json (a result per line) or csv")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: check [-format text|json|csv] [number ...]")
+		fmt.Fprintln(stderr, "Numbers are read one per line from stdin when none are given.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	var out resultWriter
+	switch *format {
+	case "text":
+		out = textWriter{stdout}
+	case "json":
+		out = jsonWriter{json.NewEncoder(stdout)}
+	case "csv":
+		w := csv.NewWriter(stdout)
+		w.Write([]string{"number", "valid", "reason", "rule", "brand"})
+		out = csvWriter{w}
+	default:
+		fmt.Fprintf(stderr, "unknown format %q, use text, json or csv\n", *format)
+		return exitUsage
+	}
+
+	code := exitValid
+	validate := func(number string) error {
+		result := cardvalidator.ValidateCard(number)
+		if !result.Valid {
+			code = exitInvalid
+		}
+		return out.write(result)
+	}
+	if fs.NArg() > 0 {
+		for _, number := range fs.Args() {
+			if err := validate(number); err != nil {
+				fmt.Fprintln(stderr, err)
+				return exitUsage
+			}
+		}
+	} else {
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			if err := validate(line); err != nil {
+				fmt.Fprintln(stderr, err)
+				return exitUsage
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+	}
+	if err := out.flush(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	return code
+}
+
+// resultWriter prints results in one of the check formats
+type resultWriter interface {
+	write(cardvalidator.ValidationResult) error
+	flush() error
+}
+
+type textWriter struct{ w io.Writer }
+
+func (t textWriter) write(r cardvalidator.ValidationResult) error {
+	number := r.Number
+	if number == "" {
+		number = "-"
+	}
+	var err error
+	if r.Valid {
+		_, err = fmt.Fprintf(t.w, "%s\tvalid\t%s\n", number, r.Brand)
+	} else {
+		_, err = fmt.Fprintf(t.w, "%s\tinvalid\t%s: %s\n", number, r.Reason, r.Rule)
+	}
+	return err
+}
+
+func (textWriter) flush() error { return nil }
+
+type jsonWriter struct{ enc *json.Encoder }
+
+func (j jsonWriter) write(r cardvalidator.ValidationResult) error { return j.enc.Encode(r) }
+
+func (jsonWriter) flush() error { return nil }
+
+type csvWriter struct{ w *csv.Writer }
+
+func (c csvWriter) write(r cardvalidator.ValidationResult) error {
+	return c.w.Write([]string{r.Number, strconv.FormatBool(r.Valid), string(r.Reason), r.Rule, string(r.Brand)})
+}
+
+func (c csvWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,328 @@
+package checksum
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Algorithm is a check digit scheme. Card numbers use Luhn; the others
+// validate national IDs, serial numbers, barcodes and voucher codes.
+type Algorithm interface {
+	// Name identifies the algorithm to Named
+	Name() string
+	// Alphabet lists the characters numbers are made of, most often the
+	// digits
+	Alphabet() string
+	// Valid reports whether the last character of number is its check
+	// character. number must only have characters of the alphabet.
+	Valid(number string) bool
+	// CheckDigit computes the character that makes partial valid when
+	// appended to it. partial must only have characters of the alphabet.
+	CheckDigit(partial string) byte
+}
+
+// Digits is the alphabet of numbers
+const Digits = "0123456789"
+
+// InAlphabet reports whether s only has characters of alg's alphabet
+func InAlphabet(s string, alg Algorithm) bool {
+	alphabet := alg.Alphabet()
+	for _, c := range s {
+		if !strings.ContainsRune(alphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	// Luhn is the mod 10 algorithm of card numbers
+	Luhn Algorithm = luhn{}
+	// Verhoeff catches every single digit error and every transposition of
+	// adjacent digits, and is used by national IDs like India's Aadhaar
+	Verhoeff Algorithm = verhoeff{}
+	// Damm catches the same errors as Verhoeff with a single table, and is
+	// common for serial numbers
+	Damm Algorithm = damm{}
+	// LuhnModBase36 is Luhn mod N over the digits and upper case letters,
+	// for alphanumeric identifiers like vouchers and license keys
+	LuhnModBase36 Algorithm = luhnModN{alphabet: "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"}
+	// ISBN10 is the mod 11 algorithm of 10 digit ISBNs, whose check
+	// character is X when it's worth 10
+	ISBN10 Algorithm = isbn10{}
+	// ISBN13 is the mod 10 algorithm of 13 digit ISBNs, weighting digits 1
+	// and 3 in turn
+	ISBN13 Algorithm = weightedMod10{name: "isbn-13"}
+	// GTIN is the same algorithm for the barcodes on retail and logistics
+	// items: EAN-8, UPC-A, EAN-13 and GTIN-14
+	GTIN Algorithm = weightedMod10{name: "gtin"}
+)
+
+// algorithms can be selected by name
+var algorithms = []Algorithm{Luhn, Verhoeff, Damm, LuhnModBase36, ISBN10, ISBN13, GTIN}
+
+// Algorithms lists the algorithms Named finds
+func Algorithms() []Algorithm {
+	return append([]Algorithm(nil), algorithms...)
+}
+
+// Named finds an algorithm by name, ignoring case
+func Named(name string) (Algorithm, bool) {
+	for _, a := range algorithms {
+		if strings.EqualFold(a.Name(), name) {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// LuhnModN is Luhn mod N over alphabet, where N is the length of the
+// alphabet and a character's value its position in it. Characters are
+// matched exactly, so an alphabet of upper case letters rejects lower case
+// ones. Over the digits it's plain Luhn.
+func LuhnModN(alphabet string) (Algorithm, error) {
+	if len(alphabet) < 2 || len(alphabet) > 256 {
+		return nil, errors.New("the alphabet must have 2 to 256 characters")
+	}
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if c <= ' ' || c > '~' || c == '-' {
+			return nil, errors.New("the alphabet may only have printable ASCII characters other than spaces and dashes")
+		}
+		if strings.IndexByte(alphabet[i+1:], c) >= 0 {
+			return nil, fmt.Errorf("the alphabet has %q twice", c)
+		}
+	}
+	return luhnModN{alphabet: alphabet}, nil
+}
+
+type luhn struct{}
+
+func (luhn) Name() string { return "luhn" }
+
+func (luhn) Alphabet() string { return Digits }
+
+func (luhn) Valid(number string) bool {
+	sum := 0
+	for i := len(number) - 1; i >= 0; i -= 2 {
+		sum += int(number[i] - '0')
+	}
+	// double every second digit from the right and subtract 9 if the
+	// result is greater than 9
+	for i := len(number) - 2; i >= 0; i -= 2 {
+		d := int(number[i]-'0') * 2
+		if d > 9 {
+			d -= 9
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func (luhn) CheckDigit(partial string) byte {
+	sum := 0
+	// the check digit goes at the end, so the doubling starts with the
+	// last digit of partial
+	for i := len(partial) - 1; i >= 0; i -= 2 {
+		d := int(partial[i]-'0') * 2
+		if d > 9 {
+			d -= 9
+		}
+		sum += d
+	}
+	for i := len(partial) - 2; i >= 0; i -= 2 {
+		sum += int(partial[i] - '0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// The Verhoeff tables: multiplication in the dihedral group D5, the
+// permutation applied to a digit by its position, and the inverses
+var (
+	verhoeffD = [10][10]byte{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffP = [8][10]byte{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+	verhoeffInv = [10]byte{0, 4, 3, 2, 1, 5, 6, 7, 8, 9}
+)
+
+type verhoeff struct{}
+
+func (verhoeff) Name() string { return "verhoeff" }
+
+func (verhoeff) Alphabet() string { return Digits }
+
+// checksum runs digits through the tables from the right, with the first
+// digit from the right in position offset
+func (verhoeff) checksum(digits string, offset int) byte {
+	var c byte
+	for i := 0; i < len(digits); i++ {
+		d := digits[len(digits)-1-i] - '0'
+		c = verhoeffD[c][verhoeffP[(i+offset)%8][d]]
+	}
+	return c
+}
+
+func (v verhoeff) Valid(number string) bool {
+	return v.checksum(number, 0) == 0
+}
+
+func (v verhoeff) CheckDigit(partial string) byte {
+	// partial's digits move one place left once the check digit is added
+	return '0' + verhoeffInv[v.checksum(partial, 1)]
+}
+
+// dammTable is a totally anti-symmetric quasigroup of order 10
+var dammTable = [10][10]byte{
+	{0, 3, 1, 7, 5, 9, 8, 6, 4, 2},
+	{7, 0, 9, 2, 1, 5, 4, 8, 6, 3},
+	{4, 2, 0, 6, 8, 7, 1, 3, 5, 9},
+	{1, 7, 5, 0, 9, 8, 3, 4, 2, 6},
+	{6, 1, 2, 3, 0, 4, 5, 9, 7, 8},
+	{3, 6, 7, 4, 2, 0, 9, 5, 8, 1},
+	{5, 8, 6, 9, 7, 2, 0, 1, 3, 4},
+	{8, 9, 4, 5, 3, 6, 2, 0, 1, 7},
+	{9, 4, 3, 8, 6, 1, 7, 2, 0, 5},
+	{2, 5, 8, 1, 4, 3, 6, 7, 9, 0},
+}
+
+type damm struct{}
+
+func (damm) Name() string { return "damm" }
+
+func (damm) Alphabet() string { return Digits }
+
+// interim runs digits through the table from the left
+func (damm) interim(digits string) byte {
+	var c byte
+	for i := 0; i < len(digits); i++ {
+		c = dammTable[c][digits[i]-'0']
+	}
+	return c
+}
+
+func (d damm) Valid(number string) bool {
+	return d.interim(number) == 0
+}
+
+func (d damm) CheckDigit(partial string) byte {
+	return '0' + d.interim(partial)
+}
+
+type luhnModN struct {
+	alphabet string
+}
+
+func (luhnModN) Name() string { return "luhn-mod-n" }
+
+func (l luhnModN) Alphabet() string { return l.alphabet }
+
+// sum adds up the characters of s from the right, doubling every other one
+// starting with the first when double is set
+func (l luhnModN) sum(s string, double bool) int {
+	n := len(l.alphabet)
+	sum := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		addend := strings.IndexByte(l.alphabet, s[i])
+		if double {
+			addend *= 2
+		}
+		double = !double
+		// the digits of addend written in base n
+		sum += addend/n + addend%n
+	}
+	return sum
+}
+
+func (l luhnModN) Valid(number string) bool {
+	return l.sum(number, false)%len(l.alphabet) == 0
+}
+
+func (l luhnModN) CheckDigit(partial string) byte {
+	n := len(l.alphabet)
+	return l.alphabet[(n-l.sum(partial, true)%n)%n]
+}
+
+type isbn10 struct{}
+
+func (isbn10) Name() string { return "isbn-10" }
+
+func (isbn10) Alphabet() string { return Digits + "X" }
+
+// sum weights the digits of s by their position from the right, starting
+// from start
+func (isbn10) sum(s string, start int) int {
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		d := 10
+		if c := s[len(s)-1-i]; c != 'X' {
+			d = int(c - '0')
+		}
+		sum += d * (start + i)
+	}
+	return sum
+}
+
+func (b isbn10) Valid(number string) bool {
+	// only the check character may be X
+	if strings.IndexByte(number[:len(number)-1], 'X') >= 0 {
+		return false
+	}
+	return b.sum(number, 1)%11 == 0
+}
+
+func (b isbn10) CheckDigit(partial string) byte {
+	return "0123456789X"[(11-b.sum(partial, 2)%11)%11]
+}
+
+// weightedMod10 is the mod 10 algorithm of EAN barcodes, weighting digits
+// 1 and 3 in turn from the check digit
+type weightedMod10 struct {
+	name string
+}
+
+func (w weightedMod10) Name() string { return w.name }
+
+func (weightedMod10) Alphabet() string { return Digits }
+
+// sum adds up the digits of s from the right, tripling every other one
+// starting with the first when triple is set
+func (weightedMod10) sum(s string, triple bool) int {
+	sum := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		d := int(s[i] - '0')
+		if triple {
+			d *= 3
+		}
+		triple = !triple
+		sum += d
+	}
+	return sum
+}
+
+func (w weightedMod10) Valid(number string) bool {
+	return w.sum(number, false)%10 == 0
+}
+
+func (w weightedMod10) CheckDigit(partial string) byte {
+	return byte('0' + (10-w.sum(partial, true)%10)%10)
+}
@@ -0,0 +1,73 @@
+// Package checksum computes and verifies check digits: Luhn for card
+// numbers, and the algorithms of national IDs, serial numbers, barcodes and
+// voucher codes. It has no dependencies, so it can be imported or vendored
+// without the card validation service.
+package checksum
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ErrNotDigits is returned by CheckDigit for input that isn't a run of
+// digits
+var ErrNotDigits = errors.New("the number must be one or more digits")
+
+// ErrNotInAlphabet is returned for identifiers with characters outside the
+// alphabet of their algorithm
+var ErrNotInAlphabet = errors.New("the identifier must be one or more characters of the alphabet")
+
+// Normalize drops the spaces and dashes numbers are written with and turns
+// full-width digits, as typed with East Asian input methods, into ASCII
+// ones. Anything else is left for validation to reject.
+func Normalize(number string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '０' && r <= '９':
+			return '0' + r - '０'
+		case unicode.IsSpace(r), isDash(r):
+			return -1
+		}
+		return r
+	}, number)
+}
+
+// isDash matches the hyphens and dashes that end up in pasted numbers
+func isDash(r rune) bool {
+	switch r {
+	case '-', '‐', '‑', '‒', '–', '—', '－':
+		return true
+	}
+	return false
+}
+
+// Valid reports whether number, once normalized, is a run of digits that
+// passes the Luhn check
+func Valid(number string) bool {
+	return ValidWith(Luhn, number)
+}
+
+// ValidWith is Valid for any algorithm
+func ValidWith(alg Algorithm, number string) bool {
+	number = Normalize(number)
+	return number != "" && InAlphabet(number, alg) && alg.Valid(number)
+}
+
+// CheckDigit computes the Luhn check digit that makes partial a valid
+// number when appended to it. partial is normalized first.
+func CheckDigit(partial string) (byte, error) {
+	return CheckDigitWith(Luhn, partial)
+}
+
+// CheckDigitWith is CheckDigit for any algorithm
+func CheckDigitWith(alg Algorithm, partial string) (byte, error) {
+	partial = Normalize(partial)
+	if partial == "" || !InAlphabet(partial, alg) {
+		if alg.Alphabet() == Digits {
+			return 0, ErrNotDigits
+		}
+		return 0, ErrNotInAlphabet
+	}
+	return alg.CheckDigit(partial), nil
+}
@@ -0,0 +1,208 @@
+// Package iban validates International Bank Account Numbers as ISO 13616
+// defines them: the country's length, the structure of its basic bank
+// account number (BBAN) and the mod 97 check digits.
+package iban
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Reason says why an IBAN is invalid
+type Reason string
+
+const (
+	ReasonEmpty     Reason = "empty_input"
+	ReasonCharacter Reason = "invalid_character"
+	ReasonCountry   Reason = "unknown_country"
+	ReasonLength    Reason = "invalid_length"
+	ReasonBBAN      Reason = "invalid_bban"
+	ReasonChecksum  Reason = "failed_checksum"
+)
+
+// Result is the outcome of validating an IBAN along with its parts
+type Result struct {
+	Valid  bool   `json:"valid"`
+	Reason Reason `json:"reason,omitempty"`
+	// Rule describes the rule the IBAN broke
+	Rule string `json:"rule,omitempty"`
+	// IBAN is the electronic format: upper case, without spaces
+	IBAN string `json:"iban,omitempty"`
+	// Formatted is the print format, in groups of four
+	Formatted   string `json:"formatted,omitempty"`
+	Country     string `json:"country,omitempty"`
+	CheckDigits string `json:"checkDigits,omitempty"`
+	BBAN        string `json:"bban,omitempty"`
+}
+
+// Normalize turns an IBAN in print format, like "IBAN DE89 3704 0044 0532
+// 0130 00", into the electronic format
+func Normalize(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "IBAN")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Validate checks s, in print or electronic format
+func Validate(s string) Result {
+	s = Normalize(s)
+	if s == "" {
+		return Result{Reason: ReasonEmpty, Rule: "an IBAN is required"}
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) && !isUpper(s[i]) {
+			return Result{Reason: ReasonCharacter, Rule: "IBANs only have letters and digits"}
+		}
+	}
+	res := Result{IBAN: s, Formatted: format(s)}
+	if len(s) < 4 || !isUpper(s[0]) || !isUpper(s[1]) || !isDigit(s[2]) || !isDigit(s[3]) {
+		res.Reason, res.Rule = ReasonCharacter, "IBANs start with a country code and two check digits"
+		return res
+	}
+	res.Country, res.CheckDigits, res.BBAN = s[:2], s[2:4], s[4:]
+	structure, ok := registry[res.Country]
+	if !ok {
+		res.Reason, res.Rule = ReasonCountry, res.Country+" doesn't use IBANs"
+		return res
+	}
+	if want := 4 + structure.length(); len(s) != want {
+		res.Reason, res.Rule = ReasonLength, fmt.Sprintf("%s IBANs have %d characters", res.Country, want)
+		return res
+	}
+	if !structure.matches(res.BBAN) {
+		res.Reason, res.Rule = ReasonBBAN, fmt.Sprintf("%s account numbers are %s", res.Country, structure.describe())
+		return res
+	}
+	if mod97(s[4:]+s[:4]) != 1 {
+		res.Reason, res.Rule = ReasonChecksum, "the check digits don't match the mod 97 checksum"
+		return res
+	}
+	res.Valid = true
+	return res
+}
+
+// mod97 computes s mod 97 with letters standing for 10 to 35, a digit at a
+// time so the number doesn't have to fit an integer
+func mod97(s string) int {
+	r := 0
+	for i := 0; i < len(s); i++ {
+		if isDigit(s[i]) {
+			r = (r*10 + int(s[i]-'0')) % 97
+		} else {
+			r = (r*100 + int(s[i]-'A') + 10) % 97
+		}
+	}
+	return r
+}
+
+// format splits s into groups of four
+func format(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i += 4 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(s[i:min(i+4, len(s))])
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+
+// segment is a run of characters of one kind in a BBAN: n for digits, a for
+// upper case letters and c for either
+type segment struct {
+	n    int
+	kind byte
+}
+
+// structure is the BBAN of a country, written like the IBAN registry does
+// without the "!": "8n10n" is eight digits followed by ten
+type structure []segment
+
+// parseStructure reads registry notation, panicking on mistakes since it
+// only reads the table below
+func parseStructure(s string) structure {
+	var st structure
+	for s != "" {
+		i := strings.IndexAny(s, "nac")
+		n, err := strconv.Atoi(s[:i])
+		if err != nil || i < 1 {
+			panic("iban: bad structure " + s)
+		}
+		st = append(st, segment{n, s[i]})
+		s = s[i+1:]
+	}
+	return st
+}
+
+func (st structure) length() int {
+	n := 0
+	for _, seg := range st {
+		n += seg.n
+	}
+	return n
+}
+
+func (st structure) matches(bban string) bool {
+	i := 0
+	for _, seg := range st {
+		for _, c := range []byte(bban[i : i+seg.n]) {
+			switch {
+			case seg.kind == 'n' && !isDigit(c),
+				seg.kind == 'a' && !isUpper(c):
+				return false
+			}
+		}
+		i += seg.n
+	}
+	return true
+}
+
+// describe writes st out, e.g. "4 letters, then 6 digits, then 8 digits"
+func (st structure) describe() string {
+	kinds := map[byte]string{'n': "digits", 'a': "letters", 'c': "letters or digits"}
+	parts := make([]string, len(st))
+	for i, seg := range st {
+		parts[i] = fmt.Sprintf("%d %s", seg.n, kinds[seg.kind])
+	}
+	return strings.Join(parts, ", then ")
+}
+
+// registry is the BBAN structure of the countries in the SWIFT IBAN
+// registry
+var registry = func() map[string]structure {
+	m := make(map[string]structure)
+	for country, s := range map[string]string{
+		"AD": "4n4n12c", "AE": "3n16n", "AL": "8n16c", "AT": "5n11n",
+		"AZ": "4a20c", "BA": "3n3n8n2n", "BE": "3n7n2n", "BG": "4a4n2n8c",
+		"BH": "4a14c", "BR": "8n5n10n1a1c", "CH": "5n12c", "CR": "4n14n",
+		"CY": "3n5n16c", "CZ": "4n6n10n", "DE": "8n10n", "DK": "4n9n1n",
+		"DO": "4c20n", "EE": "2n2n11n1n", "EG": "4n4n17n", "ES": "4n4n1n1n10n",
+		"FI": "3n11n", "FO": "4n9n1n", "FR": "5n5n11c2n", "GB": "4a6n8n",
+		"GE": "2a16n", "GI": "4a15c", "GL": "4n9n1n", "GR": "3n4n16c",
+		"GT": "4c20c", "HR": "7n10n", "HU": "3n4n1n15n1n", "IE": "4a6n8n",
+		"IL": "3n3n13n", "IQ": "4a3n12n", "IS": "4n2n6n10n", "IT": "1a5n5n12c",
+		"JO": "4a4n18c", "KW": "4a22c", "KZ": "3n13c", "LB": "4n20c",
+		"LC": "4a24c", "LI": "5n12c", "LT": "5n11n", "LU": "3n13c",
+		"LV": "4a13c", "MC": "5n5n11c2n", "MD": "2c18c", "ME": "3n13n2n",
+		"MK": "3n10c2n", "MR": "5n5n11n2n", "MT": "4a5n18c", "MU": "4a2n2n12n3n3a",
+		"NL": "4a10n", "NO": "4n6n1n", "PK": "4a16c", "PL": "8n16n",
+		"PS": "4a21c", "PT": "4n4n11n2n", "QA": "4a21c", "RO": "4a16c",
+		"RS": "3n13n2n", "SA": "2n18c", "SE": "3n16n1n", "SI": "5n8n2n",
+		"SK": "4n6n10n", "SM": "1a5n5n12c", "TN": "2n3n13n2n", "TR": "5n1n16c",
+		"UA": "6n19c", "VA": "3n15n", "VG": "4a16n", "XK": "4n10n2n",
+	} {
+		m[country] = parseStructure(s)
+	}
+	return m
+}()
@@ -1,64 +1,52 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"log"
-	"net/http"
-	"strconv"
-
-	"github.com/gorilla/mux"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ixmorrow/go-projects/credit-card-validator/cardvalidator"
+	"github.com/ixmorrow/go-projects/shared/config"
+	"github.com/ixmorrow/go-projects/shared/logging"
+	"github.com/ixmorrow/go-projects/shared/serverless"
 )
 
-type CardInfo struct {
-	CardNumber string `json:"cardNumber"`
-}
-
-func luhnAlgorithm(input string) bool {
-	// Convert the input string to a slice of integers
-	digits := make([]int, len(input))
-
-	for i, char := range input {
-		digit, err := strconv.Atoi(string(char))
-		if err != nil {
-			// Return false if the input contains non-numeric characters
-			return false
-		}
-		digits[i] = digit
+func main() {
+	// check validates numbers from the command line instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(check(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
 	}
-
-	// Double every second digit from the right and subtract 9 if the result is greater than 9
-	for i := len(digits) - 2; i >= 0; i -= 2 {
-		doubled := digits[i] * 2
-		if doubled > 9 {
-			doubled -= 9
-		}
-		digits[i] = doubled
+	var cfg cardvalidator.Config
+	if err := config.Load(cardvalidator.Name, os.Args[1:], &cfg); err != nil {
+		log.Fatal(err)
 	}
-
-	// calculate the sum of all digits
-	sum := 0
-	for _, digit := range digits {
-		sum += digit
+	cfg.Server.Listen = serverless.ListenAddr(cfg.Server.Listen)
+
+	level := new(slog.LevelVar)
+	level.Set(logging.ParseLevel(cfg.Log.Level))
+	logger := logging.New(logging.Options{
+		Service:         cardvalidator.Name,
+		Level:           level,
+		SensitiveFields: cfg.Log.SensitiveFields,
+	})
+	slog.SetDefault(logger)
+
+	svc, err := cardvalidator.New(cardvalidator.Options{
+		Config: cfg,
+		Args:   os.Args[1:],
+		Logger: logger,
+		Level:  level,
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Check if the sum is a multiple of 10
-	return sum%10 == 0
-}
-
-func validateCard(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	var cardInfo CardInfo
-	_ = json.NewDecoder(r.Body).Decode(&cardInfo)
-	fmt.Println("Card number received:", cardInfo.CardNumber)
-	isValidCardNumber := luhnAlgorithm(cardInfo.CardNumber)
-	json.NewEncoder(w).Encode(isValidCardNumber)
-}
-
-func main() {
-	r := mux.NewRouter()
-	r.HandleFunc("/validateCreditCard", validateCard).Methods("GET")
-
-	fmt.Println("Starting server at port 8000...")
-	log.Fatal(http.ListenAndServe(":8000", r))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := svc.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,194 @@
+package stats
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// Results of validations
+const (
+	Valid   = "valid"
+	Invalid = "invalid"
+)
+
+// Bucket sizes of a Report
+const (
+	Hourly = "hour"
+	Daily  = "day"
+)
+
+// Windows are the periods a Report can cover, ending with the current hour
+var Windows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// Report sums up the validations of a period, overall and per bucket
+type Report struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Bucket string    `json:"bucket"`
+	Totals
+	Brands  map[string]int64 `json:"brands"`
+	Reasons map[string]int64 `json:"reasons"`
+	Buckets []Bucket         `json:"buckets"`
+}
+
+// Totals counts validations by result
+type Totals struct {
+	Total   int64 `json:"total"`
+	Valid   int64 `json:"valid"`
+	Invalid int64 `json:"invalid"`
+	// ValidRatio is Valid over Total, zero without validations
+	ValidRatio float64 `json:"validRatio"`
+}
+
+func (t *Totals) add(r Record) {
+	t.Total += r.Count
+	if r.Result == Valid {
+		t.Valid += r.Count
+	} else {
+		t.Invalid += r.Count
+	}
+	t.ValidRatio = float64(t.Valid) / float64(t.Total)
+}
+
+// Bucket is the validations of one hour or day
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Totals
+}
+
+// RegisterAdminRoutes adds the validation statistics to r, which is
+// normally the /admin subrouter. They cover every tenant, so only operators
+// may see them. Counts reach the store in batches, so the last seconds may
+// be missing.
+//
+//	GET /stats  the ?window= ending now, one of 1h, 24h (the default), 7d and
+//	            30d, or the hours between ?from= and ?to=, in ?bucket=s of an
+//	            hour or a day
+func RegisterAdminRoutes(r *mux.Router, store Store) {
+	r.HandleFunc("/stats", report(store)).Methods("GET")
+}
+
+func report(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, _ := auth.FromContext(r.Context()); !p.Operator() {
+			respond.Error(w, http.StatusForbidden, "only operators can see validation statistics")
+			return
+		}
+		q := r.URL.Query()
+		f, err := window(q.Get("window"), q.Get("from"), q.Get("to"), time.Now())
+		if err != nil {
+			respond.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		bucket := q.Get("bucket")
+		switch bucket {
+		case "":
+			bucket = Hourly
+			if f.To.Sub(f.From) > 48*time.Hour {
+				bucket = Daily
+			}
+		case Hourly, Daily:
+		default:
+			respond.Error(w, http.StatusBadRequest, "bucket must be hour or day")
+			return
+		}
+
+		records, err := store.Query(r.Context(), f)
+		if err != nil {
+			respond.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respond.JSON(w, http.StatusOK, summarize(f, bucket, records))
+	}
+}
+
+// window is the filter of the query parameters. Times are rounded to hours
+// since that's what the store keeps.
+func window(name, from, to string, now time.Time) (Filter, error) {
+	end := now.UTC().Truncate(time.Hour).Add(time.Hour)
+	if from != "" || to != "" {
+		if name != "" {
+			return Filter{}, errors.New("give either window or from and to")
+		}
+		f := Filter{To: end}
+		var err error
+		if f.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return Filter{}, errors.New("from must be a time like 2006-01-02T15:04:05Z")
+		}
+		if to != "" {
+			if f.To, err = time.Parse(time.RFC3339, to); err != nil {
+				return Filter{}, errors.New("to must be a time like 2006-01-02T15:04:05Z")
+			}
+		}
+		f.From, f.To = f.From.UTC().Truncate(time.Hour), f.To.UTC().Truncate(time.Hour)
+		if !f.From.Before(f.To) {
+			return Filter{}, errors.New("from must be at least an hour before to")
+		}
+		return f, nil
+	}
+	if name == "" {
+		name = "24h"
+	}
+	d, ok := Windows[name]
+	if !ok {
+		return Filter{}, errors.New("window must be one of 1h, 24h, 7d and 30d")
+	}
+	return Filter{From: end.Add(-d), To: end}, nil
+}
+
+// summarize adds up records, the records of f, by brand, reason and bucket.
+// Buckets without validations are reported too so spikes stand out.
+func summarize(f Filter, bucket string, records []Record) Report {
+	rep := Report{
+		From:    f.From,
+		To:      f.To,
+		Bucket:  bucket,
+		Brands:  make(map[string]int64),
+		Reasons: make(map[string]int64),
+		Buckets: []Bucket{},
+	}
+	index := make(map[time.Time]int)
+	for start := bucketStart(f.From, bucket); start.Before(f.To); start = nextBucket(start, bucket) {
+		index[start] = len(rep.Buckets)
+		rep.Buckets = append(rep.Buckets, Bucket{Start: start})
+	}
+	for _, rec := range records {
+		rep.Totals.add(rec)
+		rep.Brands[rec.Brand] += rec.Count
+		if rec.Reason != "" {
+			rep.Reasons[rec.Reason] += rec.Count
+		}
+		hour, err := time.Parse(HourFormat, rec.Hour)
+		if err != nil {
+			continue
+		}
+		if i, ok := index[bucketStart(hour, bucket)]; ok {
+			rep.Buckets[i].add(rec)
+		}
+	}
+	return rep
+}
+
+func bucketStart(t time.Time, bucket string) time.Time {
+	if bucket == Daily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+func nextBucket(t time.Time, bucket string) time.Time {
+	if bucket == Daily {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(time.Hour)
+}
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS validation_stats (
+	hour TEXT NOT NULL,
+	brand TEXT NOT NULL,
+	result TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (hour, brand, result, reason)
+);
@@ -0,0 +1,257 @@
+// Package stats keeps hourly counts of validated card numbers by brand,
+// result and failure reason. Only the counts are kept, never the numbers,
+// so they can be stored as long as the analytics need them.
+package stats
+
+import (
+	"context"
+	"embed"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/storage"
+)
+
+// HourFormat is the form of Record.Hour, an hour in UTC
+const HourFormat = "2006-01-02T15"
+
+// Record counts the numbers of one brand with one result and failure reason
+// validated in one hour
+type Record struct {
+	Hour   string `json:"hour"`
+	Brand  string `json:"brand"`
+	Result string `json:"result"`
+	Reason string `json:"reason,omitempty"`
+	Count  int64  `json:"count"`
+}
+
+// Filter narrows a query to the hours from From up to but not including To.
+// Zero times leave that end open.
+type Filter struct {
+	From time.Time
+	To   time.Time
+}
+
+func (f Filter) from() string {
+	if f.From.IsZero() {
+		return ""
+	}
+	return f.From.UTC().Format(HourFormat)
+}
+
+func (f Filter) to() string {
+	if f.To.IsZero() {
+		return ""
+	}
+	return f.To.UTC().Format(HourFormat)
+}
+
+func (f Filter) match(r Record) bool {
+	from, to := f.from(), f.to()
+	return (from == "" || r.Hour >= from) && (to == "" || r.Hour < to)
+}
+
+// Store persists the counts
+type Store interface {
+	// Add increments the stored counts by the given records
+	Add(ctx context.Context, records []Record) error
+	// Query returns the records f matches ordered by hour
+	Query(ctx context.Context, f Filter) ([]Record, error)
+}
+
+type recordKey struct {
+	hour, brand, result, reason string
+}
+
+func keyOf(r Record) recordKey {
+	return recordKey{r.Hour, r.Brand, r.Result, r.Reason}
+}
+
+func sortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := keyOf(records[i]), keyOf(records[j])
+		if a.hour != b.hour {
+			return a.hour < b.hour
+		}
+		if a.brand != b.brand {
+			return a.brand < b.brand
+		}
+		if a.result != b.result {
+			return a.result < b.result
+		}
+		return a.reason < b.reason
+	})
+}
+
+// MemoryStore keeps the counts in memory, losing them on restart
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[recordKey]Record
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[recordKey]Record)}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range records {
+		k := keyOf(r)
+		if existing, ok := s.records[k]; ok {
+			r.Count += existing.Count
+		}
+		s.records[k] = r
+	}
+	return nil
+}
+
+func (s *MemoryStore) Query(ctx context.Context, f Filter) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var records []Record
+	for _, r := range s.records {
+		if f.match(r) {
+			records = append(records, r)
+		}
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLStore keeps the counts in the validation_stats table of a database
+type SQLStore struct {
+	db *storage.DB
+}
+
+// NewSQLStore migrates the validation_stats table and returns a store using
+// it
+func NewSQLStore(ctx context.Context, db *storage.DB) (*SQLStore, error) {
+	if err := db.Migrate(ctx, "stats", migrations, "migrations"); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Add(ctx context.Context, records []Record) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := s.db.Rebind(`INSERT INTO validation_stats (hour, brand, result, reason, count)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (hour, brand, result, reason) DO UPDATE SET count = validation_stats.count + excluded.count`)
+	for _, r := range records {
+		if _, err := tx.ExecContext(ctx, query, r.Hour, r.Brand, r.Result, r.Reason, r.Count); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Query(ctx context.Context, f Filter) ([]Record, error) {
+	query := `SELECT hour, brand, result, reason, count FROM validation_stats WHERE 1 = 1`
+	var args []any
+	if from := f.from(); from != "" {
+		query += ` AND hour >= ?`
+		args = append(args, from)
+	}
+	if to := f.to(); to != "" {
+		query += ` AND hour < ?`
+		args = append(args, to)
+	}
+	query += ` ORDER BY hour, brand, result, reason`
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []Record
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.Hour, &r.Brand, &r.Result, &r.Reason, &r.Count); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Counter counts validations in memory until they're flushed to a store,
+// so validating doesn't wait on the database
+type Counter struct {
+	mu      sync.Mutex
+	pending map[recordKey]Record
+	now     func() time.Time
+}
+
+// NewCounter creates a Counter with nothing pending
+func NewCounter() *Counter {
+	return &Counter{pending: make(map[recordKey]Record), now: time.Now}
+}
+
+// Count counts one validated number
+func (c *Counter) Count(brand, result, reason string) {
+	hour := c.now().UTC().Format(HourFormat)
+	k := recordKey{hour, brand, result, reason}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.pending[k]
+	if !ok {
+		r = Record{Hour: hour, Brand: brand, Result: result, Reason: reason}
+	}
+	r.Count++
+	c.pending[k] = r
+}
+
+// Flush adds the pending counts to store, keeping them for the next flush
+// when that fails
+func (c *Counter) Flush(ctx context.Context, store Store) error {
+	c.mu.Lock()
+	records := make([]Record, 0, len(c.pending))
+	for _, r := range c.pending {
+		records = append(records, r)
+	}
+	c.pending = make(map[recordKey]Record)
+	c.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+
+	err := store.Add(ctx, records)
+	if err != nil {
+		c.mu.Lock()
+		for _, r := range records {
+			k := keyOf(r)
+			if pending, ok := c.pending[k]; ok {
+				r.Count += pending.Count
+			}
+			c.pending[k] = r
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// Run flushes the pending counts to store every interval until ctx is done
+func (c *Counter) Run(ctx context.Context, store Store, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := c.Flush(ctx, store); err != nil {
+				slog.ErrorContext(ctx, "flushing validation stats", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package vat validates the VAT identification numbers of EU member
+// states. Every country's numbers are checked against its format, and the
+// check digits are verified for the countries whose algorithm is public.
+package vat
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Reason says why a VAT number is invalid
+type Reason string
+
+const (
+	ReasonEmpty    Reason = "empty_input"
+	ReasonCountry  Reason = "unknown_country"
+	ReasonFormat   Reason = "invalid_format"
+	ReasonChecksum Reason = "failed_checksum"
+)
+
+// Result is the outcome of validating a VAT number
+type Result struct {
+	Valid  bool   `json:"valid"`
+	Reason Reason `json:"reason,omitempty"`
+	// Rule describes the rule the number broke
+	Rule string `json:"rule,omitempty"`
+	// Country is the VAT prefix, which is EL for Greece and XI for
+	// Northern Ireland
+	Country string `json:"country,omitempty"`
+	// VAT is the number with its prefix and without separators
+	VAT string `json:"vat,omitempty"`
+	// ChecksumVerified is set when the country's check digits were checked,
+	// as opposed to its format only
+	ChecksumVerified bool `json:"checksumVerified,omitempty"`
+}
+
+// country is the format of a country's numbers, without the prefix, and
+// its check digit algorithm if it has a public one
+type country struct {
+	format   *regexp.Regexp
+	describe string
+	checksum func(number string) bool
+}
+
+var countries = map[string]country{
+	"AT": {regexp.MustCompile(`^U\d{8}$`), "U and 8 digits", checkAT},
+	"BE": {regexp.MustCompile(`^[01]\d{9}$`), "10 digits starting with 0 or 1", checkBE},
+	"BG": {regexp.MustCompile(`^\d{9,10}$`), "9 or 10 digits", nil},
+	"CY": {regexp.MustCompile(`^\d{8}[A-Z]$`), "8 digits and a letter", nil},
+	"CZ": {regexp.MustCompile(`^\d{8,10}$`), "8 to 10 digits", nil},
+	"DE": {regexp.MustCompile(`^\d{9}$`), "9 digits", checkDE},
+	"DK": {regexp.MustCompile(`^\d{8}$`), "8 digits", checkDK},
+	"EE": {regexp.MustCompile(`^\d{9}$`), "9 digits", nil},
+	"EL": {regexp.MustCompile(`^\d{9}$`), "9 digits", nil},
+	"ES": {regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`), "9 characters, the first or last a letter", nil},
+	"FI": {regexp.MustCompile(`^\d{8}$`), "8 digits", checkFI},
+	"FR": {regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}\d{9}$`), "a 2 character key and 9 digits", nil},
+	"HR": {regexp.MustCompile(`^\d{11}$`), "11 digits", nil},
+	"HU": {regexp.MustCompile(`^\d{8}$`), "8 digits", nil},
+	"IE": {regexp.MustCompile(`^(\d{7}[A-W][A-I]?|\d[A-Z+*]\d{5}[A-W])$`), "7 digits and 1 or 2 letters", nil},
+	"IT": {regexp.MustCompile(`^\d{11}$`), "11 digits", checkIT},
+	"LT": {regexp.MustCompile(`^(\d{9}|\d{12})$`), "9 or 12 digits", nil},
+	"LU": {regexp.MustCompile(`^\d{8}$`), "8 digits", nil},
+	"LV": {regexp.MustCompile(`^\d{11}$`), "11 digits", nil},
+	"MT": {regexp.MustCompile(`^\d{8}$`), "8 digits", nil},
+	"NL": {regexp.MustCompile(`^\d{9}B\d{2}$`), "9 digits, B and 2 digits", checkNL},
+	"PL": {regexp.MustCompile(`^\d{10}$`), "10 digits", checkPL},
+	"PT": {regexp.MustCompile(`^\d{9}$`), "9 digits", nil},
+	"RO": {regexp.MustCompile(`^[1-9]\d{1,9}$`), "2 to 10 digits", nil},
+	"SE": {regexp.MustCompile(`^\d{10}01$`), "12 digits ending in 01", checkSE},
+	"SI": {regexp.MustCompile(`^\d{8}$`), "8 digits", nil},
+	"SK": {regexp.MustCompile(`^\d{10}$`), "10 digits", nil},
+	"XI": {regexp.MustCompile(`^(\d{9}|\d{12}|GD\d{3}|HA\d{3})$`), "9 or 12 digits, or GD or HA and 3 digits", nil},
+}
+
+// Normalize upper cases s and drops the spaces, dots and dashes VAT
+// numbers are written with. GR becomes EL, the prefix Greece uses for VAT.
+func Normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '.' || r == '-' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, s)
+	if strings.HasPrefix(s, "GR") {
+		s = "EL" + s[2:]
+	}
+	return s
+}
+
+// Validate checks s, which must start with its country prefix
+func Validate(s string) Result {
+	s = Normalize(s)
+	if s == "" {
+		return Result{Reason: ReasonEmpty, Rule: "a VAT number is required"}
+	}
+	if len(s) < 2 {
+		return Result{Reason: ReasonCountry, Rule: "VAT numbers start with the country code"}
+	}
+	res := Result{Country: s[:2], VAT: s}
+	c, ok := countries[res.Country]
+	if !ok {
+		res.Reason, res.Rule = ReasonCountry, res.Country+" isn't an EU VAT prefix"
+		return res
+	}
+	number := s[2:]
+	if !c.format.MatchString(number) {
+		res.Reason, res.Rule = ReasonFormat, res.Country+" VAT numbers are "+c.describe
+		return res
+	}
+	if c.checksum != nil {
+		if !c.checksum(number) {
+			res.Reason, res.Rule = ReasonChecksum, "the check digits don't match the "+res.Country+" checksum"
+			return res
+		}
+		res.ChecksumVerified = true
+	}
+	res.Valid = true
+	return res
+}
+
+// digit is the value of the digit at i of s
+func digit(s string, i int) int { return int(s[i] - '0') }
+
+// weighted sums the digits of s times weights
+func weighted(s string, weights ...int) int {
+	sum := 0
+	for i, w := range weights {
+		sum += digit(s, i) * w
+	}
+	return sum
+}
+
+// luhn reports whether s passes the Luhn check
+func luhn(s string) bool {
+	sum := 0
+	for i := len(s) - 1; i >= 0; i -= 2 {
+		sum += digit(s, i)
+	}
+	for i := len(s) - 2; i >= 0; i -= 2 {
+		d := digit(s, i) * 2
+		sum += d/10 + d%10
+	}
+	return sum%10 == 0
+}
+
+// checkAT doubles every other digit like Luhn, offset by 4
+func checkAT(n string) bool {
+	sum := 0
+	for i := 1; i < 8; i++ {
+		d := digit(n, i)
+		if i%2 == 0 {
+			d *= 2
+			d = d/10 + d%10
+		}
+		sum += d
+	}
+	return (10-(sum+4)%10)%10 == digit(n, 8)
+}
+
+// checkBE requires the last two digits to be 97 minus the rest mod 97
+func checkBE(n string) bool {
+	body, _ := strconv.Atoi(n[:8])
+	check, _ := strconv.Atoi(n[8:])
+	return 97-body%97 == check
+}
+
+// checkDE is ISO 7064 mod 11,10
+func checkDE(n string) bool {
+	p := 10
+	for i := 0; i < 8; i++ {
+		s := (digit(n, i) + p) % 10
+		if s == 0 {
+			s = 10
+		}
+		p = 2 * s % 11
+	}
+	return (11-p)%10 == digit(n, 8)
+}
+
+func checkDK(n string) bool {
+	return weighted(n, 2, 7, 6, 5, 4, 3, 2, 1)%11 == 0
+}
+
+func checkFI(n string) bool {
+	return weighted(n, 7, 9, 10, 5, 8, 4, 2, 1)%11 == 0
+}
+
+// checkIT is Luhn over the 7 digit company number, 3 digit office code and
+// check digit
+func checkIT(n string) bool {
+	return luhn(n)
+}
+
+// checkNL accepts the mod 11 check of numbers issued to companies and the
+// mod 97 check of those issued to sole traders since 2020
+func checkNL(n string) bool {
+	if weighted(n, 9, 8, 7, 6, 5, 4, 3, 2, -1)%11 == 0 {
+		return true
+	}
+	// NL is 2321 and B is 11 when letters are worth 10 to 35
+	r := 0
+	for _, c := range "2321" + n[:9] + "11" + n[10:] {
+		r = (r*10 + int(c-'0')) % 97
+	}
+	return r == 1
+}
+
+func checkPL(n string) bool {
+	sum := weighted(n, 6, 5, 7, 2, 3, 4, 5, 6, 7) % 11
+	return sum != 10 && sum == digit(n, 9)
+}
+
+// checkSE is Luhn over the 10 digit organisation number
+func checkSE(n string) bool {
+	return luhn(n[:10])
+}
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS card_tokens (
+	token TEXT PRIMARY KEY,
+	tenant TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	sealed TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS card_tokens_fingerprint ON card_tokens (tenant, fingerprint);
@@ -0,0 +1,64 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Sealer encrypts data that holds card numbers and has to be stored outside
+// the vault for a while, such as the payloads of background jobs
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewKey generates a random key, for sealing data that doesn't need to
+// outlive the process
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// NewSealer creates a Sealer whose key is derived from key for purpose, so
+// it never shares a key with the vault or with Sealers of other purposes
+func NewSealer(key []byte, purpose string) (*Sealer, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("vault: key has %d bytes instead of %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(derive(key, "sealer:"+purpose))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts data, prefixed with its nonce
+func (s *Sealer) Seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// Open decrypts what Seal encrypted
+func (s *Sealer) Open(sealed []byte) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("vault: sealed data is truncated")
+	}
+	data, err := s.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("vault: opening sealed data: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"sync"
+
+	"github.com/ixmorrow/go-projects/shared/storage"
+)
+
+// MemoryStore keeps tokens in memory, so they are lost on restart
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.entries {
+		if existing.Tenant == e.Tenant && existing.Fingerprint == e.Fingerprint {
+			return ErrExists
+		}
+	}
+	s.entries[e.Token] = e
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, tenant, token string) (Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.entries[token]
+	if !ok || e.Tenant != tenant {
+		return Entry{}, ErrNotFound
+	}
+	return e, nil
+}
+
+func (s *MemoryStore) Find(ctx context.Context, tenant, fingerprint string) (Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.entries {
+		if e.Tenant == tenant && e.Fingerprint == fingerprint {
+			return e, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLStore keeps tokens in the card_tokens table of the shared database
+type SQLStore struct {
+	db *storage.DB
+}
+
+// NewSQLStore migrates the card_tokens table and returns a store using it
+func NewSQLStore(ctx context.Context, db *storage.DB) (*SQLStore, error) {
+	if err := db.Migrate(ctx, "vault", migrations, "migrations"); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Create(ctx context.Context, e Entry) error {
+	res, err := s.db.Exec(ctx, `INSERT INTO card_tokens (token, tenant, fingerprint, sealed, created_at)
+		VALUES (?, ?, ?, ?, ?) ON CONFLICT (tenant, fingerprint) DO NOTHING`,
+		e.Token, e.Tenant, e.Fingerprint, base64.StdEncoding.EncodeToString(e.Sealed), e.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrExists
+	}
+	return nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, tenant, token string) (Entry, error) {
+	return scanEntry(s.db.QueryRow(ctx, `SELECT token, tenant, fingerprint, sealed, created_at
+		FROM card_tokens WHERE token = ? AND tenant = ?`, token, tenant))
+}
+
+func (s *SQLStore) Find(ctx context.Context, tenant, fingerprint string) (Entry, error) {
+	return scanEntry(s.db.QueryRow(ctx, `SELECT token, tenant, fingerprint, sealed, created_at
+		FROM card_tokens WHERE tenant = ? AND fingerprint = ?`, tenant, fingerprint))
+}
+
+func scanEntry(row *sql.Row) (Entry, error) {
+	var e Entry
+	var sealed string
+	err := row.Scan(&e.Token, &e.Tenant, &e.Fingerprint, &sealed, &e.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entry{}, ErrNotFound
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Sealed, err = base64.StdEncoding.DecodeString(sealed)
+	return e, err
+}
@@ -0,0 +1,170 @@
+// Package vault swaps card numbers for opaque tokens, so systems that only
+// need to refer to a card never hold its number. Numbers are stored
+// encrypted with AES-256-GCM under the token they belong to, and found again
+// by a keyed hash, so the same card always gets the same token.
+package vault
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TokenPrefix starts every token, telling them apart from card numbers
+const TokenPrefix = "tok_"
+
+// KeySize is the length of vault keys in bytes
+const KeySize = 32
+
+var (
+	// ErrNotFound is returned for tokens the vault doesn't hold
+	ErrNotFound = errors.New("token not found")
+	// ErrExists is returned by a Store creating a second token for a card
+	ErrExists = errors.New("card already tokenized")
+)
+
+// Entry is a stored token
+type Entry struct {
+	Token  string
+	Tenant string
+	// Fingerprint is the keyed hash the card number is found by
+	Fingerprint string
+	// Sealed is the encrypted card number, prefixed with its nonce
+	Sealed    []byte
+	CreatedAt time.Time
+}
+
+// Store persists tokens. Tenants never see each other's tokens.
+type Store interface {
+	// Create stores e, or returns ErrExists when the tenant already has a
+	// token with e's fingerprint
+	Create(ctx context.Context, e Entry) error
+	// Get returns the token of a tenant, or ErrNotFound
+	Get(ctx context.Context, tenant, token string) (Entry, error)
+	// Find returns the token of a tenant with fingerprint, or ErrNotFound
+	Find(ctx context.Context, tenant, fingerprint string) (Entry, error)
+}
+
+// Vault tokenizes and detokenizes card numbers
+type Vault struct {
+	store    Store
+	aead     cipher.AEAD
+	indexKey []byte
+}
+
+// ParseKey decodes a base64 vault key, as generated by
+// openssl rand -base64 32
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("vault: key isn't base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("vault: key has %d bytes instead of %d", len(key), KeySize)
+	}
+	return key, nil
+}
+
+// New creates a Vault keeping tokens in store. The encryption and index
+// keys are derived from key, which must have KeySize bytes.
+func New(store Store, key []byte) (*Vault, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("vault: key has %d bytes instead of %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(derive(key, "card-token-encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{store: store, aead: aead, indexKey: derive(key, "card-token-index")}, nil
+}
+
+func derive(key []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(purpose))
+	return h.Sum(nil)
+}
+
+// fingerprint is the keyed hash of a tenant's card number
+func (v *Vault) fingerprint(tenant, number string) string {
+	h := hmac.New(sha256.New, v.indexKey)
+	h.Write([]byte(tenant + "\x00" + number))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Tokenize returns the token of number, a normalized card number, for
+// tenant, creating it the first time the tenant tokenizes the number
+func (v *Vault) Tokenize(ctx context.Context, tenant, number string) (string, error) {
+	fp := v.fingerprint(tenant, number)
+	e, err := v.store.Find(ctx, tenant, fp)
+	if err == nil {
+		return e.Token, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	e = Entry{
+		Token:       token,
+		Tenant:      tenant,
+		Fingerprint: fp,
+		// sealed under the token so entries can't be swapped
+		Sealed:    v.aead.Seal(nonce, nonce, []byte(number), []byte(token)),
+		CreatedAt: time.Now().UTC(),
+	}
+	err = v.store.Create(ctx, e)
+	if errors.Is(err, ErrExists) {
+		// tokenized concurrently, answer with the token that won
+		e, err = v.store.Find(ctx, tenant, fp)
+		return e.Token, err
+	}
+	return token, err
+}
+
+// Detokenize returns the card number of a tenant's token
+func (v *Vault) Detokenize(ctx context.Context, tenant, token string) (string, error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return "", ErrNotFound
+	}
+	e, err := v.store.Get(ctx, tenant, token)
+	if err != nil {
+		return "", err
+	}
+	n := v.aead.NonceSize()
+	if len(e.Sealed) < n {
+		return "", errors.New("vault: sealed number is truncated")
+	}
+	number, err := v.aead.Open(nil, e.Sealed[:n], e.Sealed[n:], []byte(token))
+	if err != nil {
+		return "", fmt.Errorf("vault: opening token %s: %w", token, err)
+	}
+	return string(number), nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
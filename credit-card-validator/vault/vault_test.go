@@ -0,0 +1,266 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/storage"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// stores returns a fresh store of every kind by name
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	ctx := context.Background()
+	db, err := storage.Open(ctx, filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sqlStore, err := NewSQLStore(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": NewMemoryStore(), "sql": sqlStore}
+}
+
+func TestSealerRoundTrip(t *testing.T) {
+	sealer, err := NewSealer(testKey(t), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"card numbers", []byte(`["4111111111111111","5555555555554444"]`)},
+		{"binary", []byte{0, 1, 2, 0xff, 0xfe}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := sealer.Seal(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.data) > 0 && bytes.Contains(sealed, tt.data) {
+				t.Fatal("sealed data holds the plaintext")
+			}
+			opened, err := sealer.Open(sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(opened, tt.data) {
+				t.Fatalf("opened %q, want %q", opened, tt.data)
+			}
+		})
+	}
+}
+
+func TestSealerOpenFails(t *testing.T) {
+	key := testKey(t)
+	sealer, err := NewSealer(key, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSealer(key, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealer.Seal([]byte("4111111111111111"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name   string
+		sealer *Sealer
+		sealed []byte
+	}{
+		{"tampered", sealer, tampered},
+		{"truncated", sealer, sealed[:4]},
+		{"other purpose", other, sealed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.sealer.Open(tt.sealed); err == nil {
+				t.Fatal("opened without an error")
+			}
+		})
+	}
+}
+
+func TestTokenizeRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			v, err := New(store, testKey(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				tenant, number string
+			}{
+				{"", "4111111111111111"},
+				{"acme", "4111111111111111"},
+				{"acme", "5555555555554444"},
+			}
+			for _, tt := range tests {
+				token, err := v.Tokenize(ctx, tt.tenant, tt.number)
+				if err != nil {
+					t.Fatal(err)
+				}
+				again, err := v.Tokenize(ctx, tt.tenant, tt.number)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if again != token {
+					t.Errorf("tenant %q got %s, then %s for the same card", tt.tenant, token, again)
+				}
+				number, err := v.Detokenize(ctx, tt.tenant, token)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if number != tt.number {
+					t.Errorf("tenant %q detokenized %s, want %s", tt.tenant, number, tt.number)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreTenants(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			e := Entry{Token: "tok_a", Tenant: "acme", Fingerprint: "fp", Sealed: []byte{1, 2, 3}, CreatedAt: time.Now().UTC()}
+			if err := store.Create(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				name    string
+				lookup  func() (Entry, error)
+				wantErr error
+			}{
+				{"get by owner", func() (Entry, error) { return store.Get(ctx, "acme", "tok_a") }, nil},
+				{"find by owner", func() (Entry, error) { return store.Find(ctx, "acme", "fp") }, nil},
+				{"get by other tenant", func() (Entry, error) { return store.Get(ctx, "globex", "tok_a") }, ErrNotFound},
+				{"find by other tenant", func() (Entry, error) { return store.Find(ctx, "globex", "fp") }, ErrNotFound},
+				{"get by default tenant", func() (Entry, error) { return store.Get(ctx, "", "tok_a") }, ErrNotFound},
+				{"get unknown token", func() (Entry, error) { return store.Get(ctx, "acme", "tok_b") }, ErrNotFound},
+			}
+			for _, tt := range tests {
+				got, err := tt.lookup()
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+					continue
+				}
+				if err == nil && (got.Token != e.Token || !bytes.Equal(got.Sealed, e.Sealed)) {
+					t.Errorf("%s: got %+v, want %+v", tt.name, got, e)
+				}
+			}
+
+			// the fingerprint is only unique within a tenant
+			other := Entry{Token: "tok_b", Tenant: "globex", Fingerprint: "fp", Sealed: []byte{4}, CreatedAt: time.Now().UTC()}
+			if err := store.Create(ctx, other); err != nil {
+				t.Errorf("second tenant with the same fingerprint: %v", err)
+			}
+			again := Entry{Token: "tok_c", Tenant: "acme", Fingerprint: "fp", Sealed: []byte{5}, CreatedAt: time.Now().UTC()}
+			if err := store.Create(ctx, again); !errors.Is(err, ErrExists) {
+				t.Errorf("same tenant and fingerprint: error %v, want %v", err, ErrExists)
+			}
+		})
+	}
+}
+
+// lateStore misses its tenant's entry on the first Find, as when another
+// request tokenizes the same card between Tokenize's Find and Create
+type lateStore struct {
+	Store
+	mu     sync.Mutex
+	missed bool
+}
+
+func (s *lateStore) Find(ctx context.Context, tenant, fingerprint string) (Entry, error) {
+	s.mu.Lock()
+	missed := s.missed
+	s.missed = true
+	s.mu.Unlock()
+	if !missed {
+		return Entry{}, ErrNotFound
+	}
+	return s.Store.Find(ctx, tenant, fingerprint)
+}
+
+func TestTokenizeLosesRace(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			key := testKey(t)
+			winner, err := New(store, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := winner.Tokenize(ctx, "acme", "4111111111111111")
+			if err != nil {
+				t.Fatal(err)
+			}
+			loser, err := New(&lateStore{Store: store}, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := loser.Tokenize(ctx, "acme", "4111111111111111")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("got token %s, want the winner's %s", got, want)
+			}
+		})
+	}
+}
+
+func TestTokenizeConcurrently(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			v, err := New(store, testKey(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens := make([]string, 8)
+			errs := make([]error, len(tokens))
+			var wg sync.WaitGroup
+			for i := range tokens {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					tokens[i], errs[i] = v.Tokenize(ctx, "acme", "4111111111111111")
+				}(i)
+			}
+			wg.Wait()
+			for i := range tokens {
+				if errs[i] != nil {
+					t.Fatal(errs[i])
+				}
+				if tokens[i] != tokens[0] {
+					t.Fatalf("the same card got tokens %s and %s", tokens[0], tokens[i])
+				}
+			}
+		})
+	}
+}
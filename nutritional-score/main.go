@@ -1,17 +1,48 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/nutritional-score/nutriscore"
+	"github.com/ixmorrow/go-projects/shared/config"
+	"github.com/ixmorrow/go-projects/shared/logging"
+	"github.com/ixmorrow/go-projects/shared/serverless"
 )
 
 func main() {
-	r := mux.NewRouter()
-	r.HandleFunc("/getNutritionalScore", GetNutritionalScore).Methods("GET")
+	var cfg nutriscore.Config
+	if err := config.Load(nutriscore.Name, os.Args[1:], &cfg); err != nil {
+		log.Fatal(err)
+	}
+	cfg.Server.Listen = serverless.ListenAddr(cfg.Server.Listen)
 
-	fmt.Println("Starting server at port 8000...")
-	log.Fatal(http.ListenAndServe(":8000", r))
+	level := new(slog.LevelVar)
+	level.Set(logging.ParseLevel(cfg.Log.Level))
+	logger := logging.New(logging.Options{
+		Service:         nutriscore.Name,
+		Level:           level,
+		SensitiveFields: cfg.Log.SensitiveFields,
+	})
+	slog.SetDefault(logger)
+
+	svc, err := nutriscore.New(nutriscore.Options{
+		Config: cfg,
+		Args:   os.Args[1:],
+		Logger: logger,
+		Level:  level,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := svc.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
 }
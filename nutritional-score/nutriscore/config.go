@@ -0,0 +1,19 @@
+package nutriscore
+
+import (
+	"github.com/ixmorrow/go-projects/shared/config"
+)
+
+// DefaultListen is where the service listens unless configured otherwise.
+// It's next to the credit card validator's :8000 so both run side by side.
+const DefaultListen = ":8001"
+
+// Config is the Nutri-Score service's configuration
+type Config struct {
+	config.Base `yaml:",inline"`
+}
+
+// Defaults moves the service off the shared default port
+func (c *Config) Defaults() {
+	c.Server.Listen = DefaultListen
+}
@@ -1,12 +1,18 @@
 // Package nutriscore provides utilities for calculating nutritional score and
 // Nutri-Score.
 // More about-score: https://en.wikipedia.org/wiki/Nutri-Score
-package main
+//
+// The nutritional-score command serves it over HTTP; other programs can
+// embed the same service with New and Run.
+package nutriscore
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+
+	"github.com/ixmorrow/go-projects/shared/codec"
 )
 
 type ScoreType int
@@ -19,15 +25,15 @@ const (
 )
 
 type NutritionalData struct {
-	Energy              EnergyKJ            `json:"energyKj"`
-	Sugars              SugarGram           `json:"sugar"`
-	SaturatedFattyAcids SaturatedFattyAcids `json:"saturatedFattyAcids"`
-	Sodium              SodiumMilligram     `json:"sodiumMg"`
-	Fruits              FruitsPercent       `json:"fruitesPercent"`
-	Fiber               FiberGram           `json:"fiberGram"`
-	Protein             ProteinGram         `json:"proteinGram"`
+	Energy              EnergyKJ            `json:"energyKj" schema:"minimum=0"`
+	Sugars              SugarGram           `json:"sugar" schema:"minimum=0"`
+	SaturatedFattyAcids SaturatedFattyAcids `json:"saturatedFattyAcids" schema:"minimum=0"`
+	Sodium              SodiumMilligram     `json:"sodiumMg" schema:"minimum=0"`
+	Fruits              FruitsPercent       `json:"fruitesPercent" schema:"minimum=0,maximum=100"`
+	Fiber               FiberGram           `json:"fiberGram" schema:"minimum=0"`
+	Protein             ProteinGram         `json:"proteinGram" schema:"minimum=0"`
 	IsWater             bool                `json:"isWater"`
-	FoodType            ScoreType           `json:"foodType"`
+	FoodType            ScoreType           `json:"foodType" schema:"enum=0|1|2|3"`
 }
 
 var gradeScale = []string{"A", "B", "C", "D", "E"}
@@ -48,6 +54,18 @@ type NutritionalScore struct {
 	Positive  int
 	Negative  int
 	ScoreType ScoreType
+	Points    NutrientPoints
+}
+
+// NutrientPoints are the points each nutrient contributed to a score
+type NutrientPoints struct {
+	Energy              int
+	Sugars              int
+	SaturatedFattyAcids int
+	Sodium              int
+	Fruits              int
+	Fiber               int
+	Protein             int
 }
 
 // EnergyKJ represents the energy density in kJ/100g
@@ -144,16 +162,26 @@ func CalcNutritionalScore(n NutritionalData) NutritionalScore {
 	value := 0
 	positive := 0
 	negative := 0
+	var points NutrientPoints
 	st := n.FoodType
 	// Water is always graded A page 30
 	if st != Water {
-		fruitPoints := n.Fruits.GetPoints(st)
-		fibrePoints := n.Fiber.GetPoints(st)
+		points = NutrientPoints{
+			Energy:              n.Energy.GetPoints(st),
+			Sugars:              n.Sugars.GetPoints(st),
+			SaturatedFattyAcids: n.SaturatedFattyAcids.GetPoints(st),
+			Sodium:              n.Sodium.GetPoints(st),
+			Fruits:              n.Fruits.GetPoints(st),
+			Fiber:               n.Fiber.GetPoints(st),
+			Protein:             n.Protein.GetPoints(st),
+		}
+		fruitPoints := points.Fruits
+		fibrePoints := points.Fiber
 		//negative points are the negative things like calories (it says energy but these are what people are avoiding as these are calories)
 		//sugars, saturated fats and sodium
 		//positives are fruit points, fiber points and proteins
-		negative = n.Energy.GetPoints(st) + n.Sugars.GetPoints(st) + n.SaturatedFattyAcids.GetPoints(st) + n.Sodium.GetPoints(st)
-		positive = fruitPoints + fibrePoints + n.Protein.GetPoints(st)
+		negative = points.Energy + points.Sugars + points.SaturatedFattyAcids + points.Sodium
+		positive = fruitPoints + fibrePoints + points.Protein
 
 		if st == Cheese {
 			// Cheeses always use (negative - positive) page 29
@@ -173,6 +201,7 @@ func CalcNutritionalScore(n NutritionalData) NutritionalScore {
 		Positive:  positive,
 		Negative:  negative,
 		ScoreType: st,
+		Points:    points,
 	}
 }
 
@@ -197,14 +226,25 @@ func getPointsFromRange(v float64, levels []float64) int {
 }
 
 func GetNutritionalScore(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
 	var nutritionalInfo NutritionalData
-	_ = json.NewDecoder(r.Body).Decode(&nutritionalInfo)
-	fmt.Println("Nutritional Data Received:", nutritionalInfo)
+	err := codec.Decode(r, &nutritionalInfo)
+	if errors.Is(err, codec.ErrUnsupportedMediaType) {
+		codec.Error(w, r, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		codec.Error(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body over %d bytes", tooLarge.Limit))
+		return
+	}
+	if err != nil {
+		codec.Error(w, r, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	slog.InfoContext(r.Context(), "nutritional data received", "data", nutritionalInfo)
 
 	nutri_score := CalcNutritionalScore(nutritionalInfo)
-	fmt.Printf("Nutritional Score: %d\n", nutri_score.Value)
-	fmt.Printf("Nutritional Grade: %s\n", nutri_score.Grade)
+	slog.InfoContext(r.Context(), "nutritional score calculated", "value", nutri_score.Value, "grade", nutri_score.Grade)
 
-	json.NewEncoder(w).Encode(nutri_score)
+	codec.Respond(w, r, http.StatusOK, nutri_score)
 }
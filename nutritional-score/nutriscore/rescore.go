@@ -0,0 +1,65 @@
+package nutriscore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ixmorrow/go-projects/shared/codec"
+	"github.com/ixmorrow/go-projects/shared/jobs"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// rescoreJob is the job type that scores a batch of products in the background
+const rescoreJob = "rescore"
+
+// runRescore is the jobs.Handler for rescoreJob
+func runRescore(ctx context.Context, job jobs.Job) (any, error) {
+	var products []NutritionalData
+	if err := json.Unmarshal(job.Payload, &products); err != nil {
+		return nil, err
+	}
+	scores := make([]NutritionalScore, len(products))
+	for i, p := range products {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		scores[i] = CalcNutritionalScore(p)
+	}
+	return scores, nil
+}
+
+// RescoreProducts queues a background job scoring every product in the
+// request body, which may be JSON, XML, CSV or MessagePack. Its status and results are available from /jobs/{id}.
+func RescoreProducts(runner *jobs.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var products []NutritionalData
+		err := codec.Decode(r, &products)
+		if errors.Is(err, codec.ErrUnsupportedMediaType) {
+			codec.Error(w, r, http.StatusUnsupportedMediaType, err.Error())
+			return
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			codec.Error(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body over %d bytes", tooLarge.Limit))
+			return
+		}
+		if err != nil {
+			codec.Error(w, r, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		job, err := runner.Enqueue(r.Context(), rescoreJob, products)
+		if errors.Is(err, jobs.ErrQueueFull) {
+			respond.Error(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err != nil {
+			respond.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		codec.Respond(w, r, http.StatusAccepted, job)
+	}
+}
@@ -0,0 +1,165 @@
+package nutriscore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/config"
+	"github.com/ixmorrow/go-projects/shared/jobs"
+	"github.com/ixmorrow/go-projects/shared/loadshed"
+	"github.com/ixmorrow/go-projects/shared/metering"
+	"github.com/ixmorrow/go-projects/shared/schema"
+	"github.com/ixmorrow/go-projects/shared/service"
+	"github.com/ixmorrow/go-projects/shared/versioning"
+)
+
+// Name is the service name used in logs, metrics and configuration
+const Name = "nutritional-score"
+
+// scopeScore lets an API key call the scoring endpoints
+const scopeScore = "score"
+
+// thresholdsVersion identifies the Nutri-Score point thresholds reported by
+// /version
+const thresholdsVersion = "2017"
+
+// getWithBodyDeprecated is when sending the product in the body of a GET was
+// deprecated in favour of POST, which proxies and caches handle properly
+var getWithBodyDeprecated = time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC)
+
+// Options configures a Service
+type Options struct {
+	// Config is the service configuration, normally read with config.Load
+	Config Config
+	// Args are the command line arguments the configuration is read from
+	// again when it is reloaded. Without them a reload only reads the file
+	// and the environment.
+	Args []string
+	// Logger is used for request logs. It defaults to a JSON logger at
+	// Config.Log.Level.
+	Logger *slog.Logger
+	// Level is set to the new log level on reloads. The default Logger reads
+	// its level from it; a Logger of your own only does if you built it so.
+	Level *slog.LevelVar
+}
+
+// Service is a Nutri-Score calculator that can be embedded in another
+// program, either by serving its Handler on a router of its own or by
+// letting Run serve it on the configured listeners
+type Service struct {
+	core     *service.Core
+	reloader *config.Reloader[Config]
+}
+
+// New opens the stores described by opts.Config, starts the batch job
+// runner and builds the routes. Call Shutdown when done with the Service,
+// unless Run was used, which shuts it down itself.
+func New(opts Options) (*Service, error) {
+	core, err := service.New(opts.Config.Base, service.Options{
+		Name:       Name,
+		Prefix:     "nutriscore:",
+		RateGroups: []string{"score", "batch"},
+		Logger:     opts.Logger,
+		Level:      opts.Level,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{core: core}
+	if err := s.build(opts.Config, opts.Args); err != nil {
+		return nil, errors.Join(err, s.Shutdown(context.Background()))
+	}
+	return s, nil
+}
+
+// build registers the job types and routes of the Nutri-Score calculator
+func (s *Service) build(cfg Config, args []string) error {
+	c := s.core
+	c.Runner.Register(rescoreJob, runRescore)
+	if err := c.Runner.Start(context.Background()); err != nil {
+		return err
+	}
+	c.AddComponent("nutriScoreThresholds", func() string { return thresholdsVersion })
+
+	r := c.Router
+	r.PathPrefix("/ui/").Handler(uiHandler()).Methods("GET")
+	r.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently)).Methods("GET")
+
+	// cheap and expensive routes shed load separately so a flood of batch
+	// or report requests can't starve the single validations
+	cheapLimits, expensiveLimits := cfg.ShedLimits()
+	shedder := loadshed.New(c.Metrics.Registry())
+	shedCheap := shedder.Limit("score", cheapLimits)
+	shedExpensive := shedder.Limit("batch", expensiveLimits)
+	deprecations := versioning.NewDeprecations(c.Metrics.Registry())
+	getWithBody := deprecations.Deprecate(versioning.Policy{
+		Deprecated: getWithBodyDeprecated,
+		Successor:  "/api/v1/getNutritionalScore",
+	})
+	scoreRoutes := func(score *mux.Router) {
+		score.Use(c.Faults, c.Auth.Require(scopeScore))
+		single := score.NewRoute().Subrouter()
+		single.Use(c.Limiters["score"].Middleware, c.Meter.Middleware)
+		scoreHandler := shedCheap(c.Record(c.Mirror(schema.Body[NutritionalData]()(http.HandlerFunc(GetNutritionalScore)))))
+		single.Handle("/getNutritionalScore", scoreHandler).Methods("POST")
+		single.Handle("/getNutritionalScore", getWithBody(scoreHandler)).Methods("GET")
+		batch := score.NewRoute().Subrouter()
+		batch.Use(c.Limiters["batch"].Middleware, c.Meter.Middleware, shedExpensive)
+		batch.Handle("/rescore", schema.Body[[]NutritionalData]()(RescoreProducts(c.Runner))).Methods("POST")
+		jobs.RegisterRoutes(batch, c.Jobs)
+	}
+	versions := versioning.New(r, "/api").WithDeprecations(deprecations)
+	scoreRoutes(versions.Version("v1", versioning.Policy{}))
+	scoreRoutes(versions.Alias("/v1", "v1"))
+	// the unversioned routes stay for existing clients, answering like v1
+	scoreRoutes(versions.Unversioned("v1"))
+
+	// usage reports aren't metered so callers can still check them once
+	// their quota is used up
+	usage := r.NewRoute().Subrouter()
+	usage.Use(c.Auth.Require(scopeScore), shedExpensive)
+	metering.RegisterRoutes(usage, c.Usage)
+
+	s.reloader = config.NewReloader(Name, args, cfg)
+	s.reloader.OnReload(func(cfg Config) { c.Reload(cfg.Base) })
+	c.Admin(s.reloader)
+	return nil
+}
+
+// Handler serves the API, the UI and the admin routes. Mount it under a
+// prefix with http.StripPrefix; Start must be running for usage to be
+// recorded and for the dashboard to show traffic.
+func (s *Service) Handler() http.Handler {
+	return s.core.Router
+}
+
+// Start runs the background work of the Service until ctx is done, see
+// service.Core.Start
+func (s *Service) Start(ctx context.Context) {
+	s.core.Start(ctx)
+}
+
+// Shutdown waits for running batch jobs, flushes the usage counts and
+// closes the database and log files
+func (s *Service) Shutdown(ctx context.Context) error {
+	return s.core.Shutdown(ctx)
+}
+
+// Run serves the Service until ctx is done, see service.Core.Run. It shuts
+// the Service down before returning.
+func (s *Service) Run(ctx context.Context) error {
+	return s.core.Run(ctx)
+}
+
+// Run creates a Service from opts and runs it until ctx is done
+func Run(ctx context.Context, opts Options) error {
+	s, err := New(opts)
+	if err != nil {
+		return err
+	}
+	return s.Run(ctx)
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// APIKeyHeader is the header clients send their API key in
+const APIKeyHeader = "X-API-Key"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID     string
+	Name   string
+	Scopes []string
+	// Tenant is the team whose data the caller may see
+	Tenant string
+	// Claims holds the token claims when the caller used a bearer token
+	Claims Claims
+}
+
+// HasScope reports whether the principal was granted scope
+func (p Principal) HasScope(scope string) bool {
+	return Key{Scopes: p.Scopes}.HasScope(scope)
+}
+
+// CanAccess reports whether the principal may see data owned by tenant.
+// Callers only see their own tenant's data, except operators, which are
+// admins belonging to no tenant.
+func (p Principal) CanAccess(tenant string) bool {
+	return p.Tenant == tenant || p.Operator()
+}
+
+// Operator reports whether the principal is an admin of the deployment
+// rather than of a single tenant
+func (p Principal) Operator() bool {
+	return p.Tenant == "" && p.HasScope(ScopeAdmin)
+}
+
+// Tenant returns the tenant of the caller stored in ctx, empty for the
+// default tenant
+func Tenant(ctx context.Context) string {
+	p, _ := FromContext(ctx)
+	return p.Tenant
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx by the auth middleware
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator checks request credentials against a key store and,
+// optionally, an OIDC token verifier
+type Authenticator struct {
+	keys   Store
+	tokens *TokenVerifier
+}
+
+// New creates an Authenticator backed by keys
+func New(keys Store) *Authenticator {
+	return &Authenticator{keys: keys}
+}
+
+// WithTokens also accepts JWT bearer tokens checked by v as an alternative to
+// API keys
+func (a *Authenticator) WithTokens(v *TokenVerifier) *Authenticator {
+	a.tokens = v
+	return a
+}
+
+// Require returns middleware that rejects requests without a valid API key or
+// bearer token granting scope, answering 401 for missing or invalid
+// credentials and 403 for credentials lacking the scope. API keys are sent in
+// the X-API-Key header or, from browsers, as the basic auth password.
+func (a *Authenticator) Require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := a.authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="API key as password"`)
+				respond.Error(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if !p.HasScope(scope) {
+				respond.Error(w, http.StatusForbidden, "credentials lack scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// RequireOperator wraps handlers behind Require that act on the whole
+// deployment, such as reloading its config, answering 403 to tenant admins
+func RequireOperator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, _ := FromContext(r.Context()); !p.Operator() {
+			respond.Error(w, http.StatusForbidden, "only operators can do this")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (Principal, error) {
+	if token, ok := bearerToken(r); ok && a.tokens != nil {
+		claims, err := a.tokens.Verify(r.Context(), token)
+		if err != nil {
+			return Principal{}, err
+		}
+		return a.tokens.Principal(claims), nil
+	}
+
+	secret := r.Header.Get(APIKeyHeader)
+	if _, password, ok := r.BasicAuth(); ok && secret == "" {
+		// browsers can send a key as the basic auth password, e.g. for the
+		// admin dashboard
+		secret = password
+	}
+	if secret == "" {
+		return Principal{}, errors.New("missing credentials")
+	}
+	k, err := a.keys.Lookup(r.Context(), HashSecret(secret))
+	if err != nil || k.Revoked() {
+		return Principal{}, errors.New("invalid api key")
+	}
+	return Principal{ID: k.ID, Name: k.Name, Scopes: k.Scopes, Tenant: k.Tenant}, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+type createKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant"`
+}
+
+type createKeyResponse struct {
+	Key
+	Secret string `json:"key"`
+}
+
+// RegisterKeyRoutes adds key management endpoints to r, which is normally a
+// subrouter mounted at /admin that already requires the admin scope:
+//
+//	GET    /keys       list keys
+//	POST   /keys       create a key, the secret is only returned here
+//	DELETE /keys/{id}  revoke a key
+//
+// Admins of a tenant only manage their own tenant's keys. Operators manage
+// every key and pick the tenant of new keys.
+func RegisterKeyRoutes(r *mux.Router, store Store) {
+	r.HandleFunc("/keys", listKeys(store)).Methods("GET")
+	r.HandleFunc("/keys", createKey(store)).Methods("POST")
+	r.HandleFunc("/keys/{id}", revokeKey(store)).Methods("DELETE")
+}
+
+func listKeys(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := store.List(r.Context())
+		if err != nil {
+			respond.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		p, _ := FromContext(r.Context())
+		visible := make([]Key, 0, len(keys))
+		for _, k := range keys {
+			if p.CanAccess(k.Tenant) {
+				k.Hash = ""
+				visible = append(visible, k)
+			}
+		}
+		respond.JSON(w, http.StatusOK, visible)
+	}
+}
+
+func createKey(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req createKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respond.Error(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if req.Name == "" || len(req.Scopes) == 0 {
+			respond.Error(w, http.StatusBadRequest, "name and scopes are required")
+			return
+		}
+		p, _ := FromContext(r.Context())
+		if req.Tenant == "" {
+			req.Tenant = p.Tenant
+		}
+		if !p.CanAccess(req.Tenant) {
+			respond.Error(w, http.StatusForbidden, "cannot create keys for another tenant")
+			return
+		}
+		k, secret, err := NewKey(req.Name, req.Scopes)
+		k.Tenant = req.Tenant
+		if err == nil {
+			err = store.Create(r.Context(), k)
+		}
+		if err != nil {
+			respond.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		k.Hash = ""
+		respond.JSON(w, http.StatusCreated, createKeyResponse{Key: k, Secret: secret})
+	}
+}
+
+func revokeKey(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		err := ErrKeyNotFound
+		keys, listErr := store.List(r.Context())
+		if listErr != nil {
+			err = listErr
+		}
+		p, _ := FromContext(r.Context())
+		for _, k := range keys {
+			if k.ID == id && p.CanAccess(k.Tenant) {
+				err = store.Revoke(r.Context(), id)
+				break
+			}
+		}
+		if errors.Is(err, ErrKeyNotFound) {
+			respond.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			respond.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,105 @@
+// Package auth authenticates API clients and carries their identity through
+// the request context.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ScopeAdmin grants access to every route, including key management
+const ScopeAdmin = "admin"
+
+// ErrKeyNotFound is returned by a Store when no key matches
+var ErrKeyNotFound = errors.New("api key not found")
+
+// Key is a stored API key. Only the SHA-256 hash of the secret is kept.
+type Key struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash,omitempty"`
+	Scopes []string `json:"scopes"`
+	// Tenant is the team the key belongs to, empty for the default tenant
+	Tenant    string     `json:"tenant,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Revoked reports whether the key has been revoked
+func (k Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// HasScope reports whether the key grants scope. Admin keys grant every scope.
+func (k Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists API keys
+type Store interface {
+	// Lookup returns the key whose secret hashes to hash
+	Lookup(ctx context.Context, hash string) (Key, error)
+	Create(ctx context.Context, k Key) error
+	Revoke(ctx context.Context, id string) error
+	List(ctx context.Context) ([]Key, error)
+}
+
+// HashSecret returns the hex encoded SHA-256 of an API key secret
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewKey generates a key with the given name and scopes. The returned secret
+// is only available here; the Key only holds its hash.
+func NewKey(name string, scopes []string) (Key, string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, "", err
+	}
+	plain := "gp_" + base64.RawURLEncoding.EncodeToString(secret)
+	return Key{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Hash:      HashSecret(plain),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}, plain, nil
+}
+
+// KeyFromSecret builds a key for a secret chosen by the operator, such as a
+// bootstrap admin key read from the environment
+func KeyFromSecret(name, secret string, scopes []string) Key {
+	hash := HashSecret(secret)
+	return Key{
+		ID:        hash[:16],
+		Name:      name,
+		Hash:      hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// Ensure adds k to store unless a key with the same secret already exists
+func Ensure(ctx context.Context, store Store, k Key) error {
+	if _, err := store.Lookup(ctx, k.Hash); err == nil {
+		return nil
+	} else if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	return store.Create(ctx, k)
+}
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE api_keys ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
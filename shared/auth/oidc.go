@@ -0,0 +1,412 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/breaker"
+	"github.com/ixmorrow/go-projects/shared/httpclient"
+)
+
+// OIDCConfig configures bearer token validation against an OIDC issuer
+type OIDCConfig struct {
+	// Issuer must match the iss claim, and is used to discover the JWKS URL
+	Issuer string
+	// Audience must be one of the aud claim values. It's required so tokens
+	// the issuer minted for other services aren't accepted.
+	Audience string
+	// JWKSURL skips discovery when set
+	JWKSURL string
+	// ScopeMap translates token scopes to the scopes routes require, e.g.
+	// "cards:validate" to "validate". Unmapped scopes are dropped, so a token
+	// only gets admin when the map grants it.
+	ScopeMap map[string]string
+	// TenantClaim names the claim holding the caller's tenant, defaults to
+	// "tenant"
+	TenantClaim string
+	// Leeway allows for clock skew when checking exp and nbf
+	Leeway time.Duration
+	// Client is used to fetch discovery documents and keys, defaults to an
+	// httpclient with a 10s timeout
+	Client *http.Client
+	// Breaker guards the fetches so an unreachable provider fails fast,
+	// one named "oidc" is created when nil
+	Breaker *breaker.Breaker
+}
+
+// TokenVerifier validates JWT bearer tokens issued by an OIDC provider
+type TokenVerifier struct {
+	cfg OIDCConfig
+
+	mu        sync.Mutex
+	jwksURL   string
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// keysTTL is how long fetched signing keys are trusted before refetching
+const keysTTL = time.Hour
+
+// NewTokenVerifier creates a verifier. Keys are fetched lazily on first use.
+func NewTokenVerifier(cfg OIDCConfig) (*TokenVerifier, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, errors.New("auth: OIDC needs an issuer and an audience")
+	}
+	if cfg.Breaker == nil {
+		cfg.Breaker = breaker.New("oidc", breaker.Config{})
+	}
+	if cfg.Client == nil {
+		cfg.Client = httpclient.New(httpclient.Options{Timeout: 10 * time.Second, Breaker: cfg.Breaker})
+	} else {
+		client := *cfg.Client
+		client.Transport = cfg.Breaker.Transport(client.Transport)
+		cfg.Client = &client
+	}
+	if cfg.Leeway == 0 {
+		cfg.Leeway = time.Minute
+	}
+	if cfg.TenantClaim == "" {
+		cfg.TenantClaim = "tenant"
+	}
+	return &TokenVerifier{cfg: cfg, jwksURL: cfg.JWKSURL}, nil
+}
+
+// Claims are the decoded claims of a verified token
+type Claims map[string]any
+
+// Subject returns the sub claim
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// String returns the claim name when it is a string, for handlers that
+// tailor their behaviour to custom claims of the caller
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Scopes returns the space separated scope claim, or the scp array some
+// providers send instead
+func (c Claims) Scopes() []string {
+	if s, ok := c["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	var scopes []string
+	if list, ok := c["scp"].([]any); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
+
+func (c Claims) audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		var out []string
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	f, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature and standard claims of token and returns its
+// claims
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return nil, errors.New("token issuer mismatch")
+	}
+	if !contains(claims.audience(), v.cfg.Audience) {
+		return nil, errors.New("token audience mismatch")
+	}
+	now := time.Now()
+	if exp, ok := claims.time("exp"); !ok || now.After(exp.Add(v.cfg.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Before(nbf.Add(-v.cfg.Leeway)) {
+		return nil, errors.New("token not yet valid")
+	}
+	return claims, nil
+}
+
+// Principal converts verified claims into a principal, mapping token scopes
+// through the configured ScopeMap and dropping those it doesn't name
+func (v *TokenVerifier) Principal(claims Claims) Principal {
+	var scopes []string
+	for _, s := range claims.Scopes() {
+		if mapped, ok := v.cfg.ScopeMap[s]; ok {
+			scopes = append(scopes, mapped)
+		}
+	}
+	tenant := claims.String(v.cfg.TenantClaim)
+	return Principal{ID: claims.Subject(), Name: claims.Subject(), Scopes: scopes, Tenant: tenant, Claims: claims}
+}
+
+// key returns the signing key for kid, refetching the key set when the kid is
+// unknown or the cached set is stale
+func (v *TokenVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	stale := time.Since(v.fetchedAt) > keysTTL
+	if key, ok := v.keys[kid]; ok && !stale {
+		return key, nil
+	}
+	// don't let a flood of tokens with made up kids hammer the provider
+	if !stale && time.Since(v.fetchedAt) < time.Minute {
+		return nil, errors.New("unknown token signing key")
+	}
+	if err := v.fetchKeys(ctx); err != nil {
+		// keep trusting the keys we have while the provider is down
+		if key, ok := v.keys[kid]; ok {
+			slog.WarnContext(ctx, "using stale token signing keys", "error", err)
+			return key, nil
+		}
+		return nil, fmt.Errorf("fetching signing keys: %w", err)
+	}
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown token signing key")
+}
+
+func (v *TokenVerifier) fetchKeys(ctx context.Context) error {
+	if v.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		url := strings.TrimSuffix(v.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := v.getJSON(ctx, url, &discovery); err != nil {
+			return err
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("discovery document has no jwks_uri")
+		}
+		v.jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, v.jwksURL, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return nil
+}
+
+func (v *TokenVerifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jwk is a single JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return errors.New("token algorithm does not match key")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(sig) != 2*size {
+			return errors.New("token algorithm does not match key")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+	return errors.New("unsupported signing key")
+}
+
+func decodeSegment(seg string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopeMap parses a ScopeMap written as "token=scope,token=scope"
+func ParseScopeMap(s string) map[string]string {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && from != "" && to != "" {
+			m[from] = to
+		}
+	}
+	return m
+}
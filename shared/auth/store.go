@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/storage"
+)
+
+// MemoryStore keeps keys in memory
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]Key // by ID
+}
+
+// NewMemoryStore creates a MemoryStore holding keys
+func NewMemoryStore(keys ...Key) *MemoryStore {
+	s := &MemoryStore{keys: make(map[string]Key)}
+	for _, k := range keys {
+		s.keys[k.ID] = k
+	}
+	return s
+}
+
+func (s *MemoryStore) Lookup(ctx context.Context, hash string) (Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return Key{}, ErrKeyNotFound
+}
+
+func (s *MemoryStore) Create(ctx context.Context, k Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+	return nil
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	now := time.Now().UTC()
+	k.RevokedAt = &now
+	s.keys[id] = k
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// fileKey is a key as written in a key file. Operators may put the plain
+// secret in "key" and it is hashed on load.
+type fileKey struct {
+	Key
+	Secret string `json:"key,omitempty"`
+}
+
+// FileStore is a MemoryStore backed by a JSON file. Changes made through the
+// API are written back to the file, always with hashed secrets.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore loads keys from the JSON file at path. A missing file is
+// treated as an empty store and created on the first write.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []fileKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	for _, fk := range keys {
+		k := fk.Key
+		if fk.Secret != "" {
+			k.Hash = HashSecret(fk.Secret)
+		}
+		if k.ID == "" && k.Hash != "" {
+			k.ID = k.Hash[:16]
+		}
+		s.keys[k.ID] = k
+	}
+	return s, nil
+}
+
+func (s *FileStore) Create(ctx context.Context, k Key) error {
+	if err := s.MemoryStore.Create(ctx, k); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+func (s *FileStore) Revoke(ctx context.Context, id string) error {
+	if err := s.MemoryStore.Revoke(ctx, id); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+func (s *FileStore) save(ctx context.Context) error {
+	keys, _ := s.List(ctx)
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".apikeys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLStore keeps keys in the api_keys table of the shared database
+type SQLStore struct {
+	db *storage.DB
+}
+
+// NewSQLStore migrates the api_keys table and returns a store using it
+func NewSQLStore(ctx context.Context, db *storage.DB) (*SQLStore, error) {
+	if err := db.Migrate(ctx, "auth", migrations, "migrations"); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Lookup(ctx context.Context, hash string) (Key, error) {
+	row := s.db.QueryRow(ctx,
+		`SELECT id, name, hash, scopes, tenant, created_at, revoked_at FROM api_keys WHERE hash = ?`, hash)
+	k, err := scanKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, ErrKeyNotFound
+	}
+	return k, err
+}
+
+func (s *SQLStore) Create(ctx context.Context, k Key) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO api_keys (id, name, hash, scopes, tenant, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		k.ID, k.Name, k.Hash, strings.Join(k.Scopes, ","), k.Tenant, k.CreatedAt)
+	return err
+}
+
+func (s *SQLStore) Revoke(ctx context.Context, id string) error {
+	res, err := s.db.Exec(ctx,
+		`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]Key, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id, name, hash, scopes, tenant, created_at, revoked_at FROM api_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []Key
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanKey(row scanner) (Key, error) {
+	var k Key
+	var scopes string
+	var revoked sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Hash, &scopes, &k.Tenant, &k.CreatedAt, &revoked); err != nil {
+		return Key{}, err
+	}
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	if revoked.Valid {
+		k.RevokedAt = &revoked.Time
+	}
+	return k, nil
+}
@@ -0,0 +1,173 @@
+// Package breaker wraps calls to external dependencies in circuit breakers.
+// After repeated failures a breaker opens and fails calls immediately, so a
+// slow or broken third party can't stall request handling. Once the open
+// period has passed it lets a probe through and closes again if it succeeds.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrOpen is returned without calling the dependency while the breaker is
+// open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a breaker
+type State int
+
+const (
+	// Closed lets every call through
+	Closed State = iota
+	// HalfOpen lets a probe through to test whether the dependency recovered
+	HalfOpen
+	// Open fails calls immediately
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "closed"
+}
+
+// Config configures a breaker. Zero values take the defaults.
+type Config struct {
+	// Failures is how many calls in a row must fail to open the breaker,
+	// defaults to 5
+	Failures int
+	// OpenFor is how long the breaker stays open before probing, defaults
+	// to 30s
+	OpenFor time.Duration
+	// Timeout bounds every call made with Do so a slow dependency counts as
+	// failing, defaults to 10s. Clients using Transport set their own.
+	Timeout time.Duration
+}
+
+// Breaker is a circuit breaker for one dependency. It is safe for concurrent
+// use.
+type Breaker struct {
+	name string
+	cfg  Config
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// New creates a closed breaker for the dependency name
+func New(name string, cfg Config) *Breaker {
+	if cfg.Failures <= 0 {
+		cfg.Failures = 5
+	}
+	if cfg.OpenFor <= 0 {
+		cfg.OpenFor = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Breaker{name: name, cfg: cfg, now: time.Now}
+}
+
+// Name returns the name of the dependency
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.cfg.OpenFor {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Do calls fn unless the breaker is open, in which case it returns ErrOpen.
+// Errors from fn, including running past the timeout, count as failures.
+// Callers fall back to cached or degraded results on error.
+func (b *Breaker) Do(ctx context.Context, fn func(context.Context) error) error {
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, b.cfg.Timeout)
+	defer cancel()
+	err = fn(ctx)
+	// the caller giving up says nothing about the dependency
+	b.done(probe, err == nil || errors.Is(err, context.Canceled))
+	return err
+}
+
+// allow reports whether a call may go ahead and whether it is the probe of a
+// half-open breaker
+func (b *Breaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Closed:
+		return false, nil
+	case Open:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenFor {
+			return false, ErrOpen
+		}
+		b.setState(HalfOpen)
+	}
+	// half-open: one probe at a time, everyone else keeps failing fast
+	if b.probing {
+		return false, ErrOpen
+	}
+	b.probing = true
+	return true, nil
+}
+
+func (b *Breaker) done(probe, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if ok {
+		b.failures = 0
+		if b.state != Closed {
+			b.setState(Closed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.cfg.Failures {
+		b.openedAt = b.now()
+		if b.state != Open {
+			b.setState(Open)
+		}
+	}
+}
+
+// setState is called with b.mu held
+func (b *Breaker) setState(s State) {
+	slog.Warn("circuit breaker changed state", "dependency", b.name, "from", b.state.String(), "to", s.String())
+	b.state = s
+}
+
+// Register exports the breaker's state as circuit_breaker_state, 0 closed,
+// 1 half-open and 2 open, labelled with the dependency
+func (b *Breaker) Register(reg prometheus.Registerer) {
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "circuit_breaker_state",
+		Help:        "State of the circuit breaker of an external dependency: 0 closed, 1 half-open, 2 open.",
+		ConstLabels: prometheus.Labels{"dependency": b.name},
+	}, func() float64 { return float64(b.State()) }))
+}
@@ -0,0 +1,31 @@
+package breaker
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Transport wraps base, or http.DefaultTransport when nil, so requests go
+// through the breaker. Connection errors and 5xx responses count as
+// failures.
+func (b *Breaker) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{b: b, base: base}
+}
+
+type transport struct {
+	b    *Breaker
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	probe, err := t.b.allow()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, err)
+	}
+	resp, err := t.base.RoundTrip(req)
+	t.b.done(probe, err == nil && resp.StatusCode < 500)
+	return resp, err
+}
@@ -0,0 +1,89 @@
+// Package buildinfo reports how a service binary was built and which
+// versions of its algorithms and datasets are active.
+package buildinfo
+
+import (
+	"net/http"
+	"runtime/debug"
+	"sort"
+
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// Version and BuildTime are set at link time, e.g.
+//
+//	go build -ldflags "-X github.com/ixmorrow/go-projects/shared/buildinfo.Version=v1.2.0 -X github.com/ixmorrow/go-projects/shared/buildinfo.BuildTime=$(date -u +%FT%TZ)"
+//
+// Without them the module version and VCS data recorded by the Go toolchain
+// are reported.
+var (
+	Version   string
+	BuildTime string
+)
+
+// Info describes a service binary
+type Info struct {
+	Service    string            `json:"service"`
+	Module     string            `json:"module,omitempty"`
+	Version    string            `json:"version"`
+	Commit     string            `json:"commit,omitempty"`
+	CommitTime string            `json:"commitTime,omitempty"`
+	Modified   bool              `json:"modified,omitempty"`
+	BuildTime  string            `json:"buildTime,omitempty"`
+	GoVersion  string            `json:"goVersion"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// Components maps the algorithms and datasets of a service to functions
+// returning their active version, which may change while the service runs
+type Components map[string]func() string
+
+// Names returns the component names in order
+func (c Components) Names() []string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Read returns the build info of the running binary of service
+func Read(service string, components Components) Info {
+	info := Info{Service: service, Version: Version, BuildTime: BuildTime}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Module = bi.Main.Path
+		info.GoVersion = bi.GoVersion
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				info.CommitTime = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	if len(components) > 0 {
+		info.Components = make(map[string]string, len(components))
+		for name, version := range components {
+			info.Components[name] = version()
+		}
+	}
+	return info
+}
+
+// Handler serves the build info of service as JSON, it is mounted at
+// GET /version
+func Handler(service string, components Components) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respond.JSON(w, http.StatusOK, Read(service, components))
+	}
+}
@@ -0,0 +1,68 @@
+// Package cache provides a small cache interface with in-memory and Redis
+// implementations shared by the services.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Cache stores byte values under string keys. A ttl of zero means the entry
+// never expires.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Ping reports whether the backing store is reachable
+	Ping(ctx context.Context) error
+}
+
+// Config selects and configures a cache backend
+type Config struct {
+	// Backend is "memory" (the default) or "redis"
+	Backend string
+	// RedisURL is a redis:// URL used by the redis backend
+	RedisURL string
+	// MaxEntries bounds the memory backend, defaults to 10000
+	MaxEntries int
+	// Prefix namespaces keys so services can share one Redis
+	Prefix string
+}
+
+// New creates the cache described by cfg
+func New(cfg Config) (Cache, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		if cfg.MaxEntries == 0 {
+			cfg.MaxEntries = 10000
+		}
+		return NewMemory(cfg.MaxEntries), nil
+	case "redis":
+		return NewRedis(cfg.RedisURL, cfg.Prefix)
+	}
+	return nil, fmt.Errorf("cache: unknown backend %q", cfg.Backend)
+}
+
+// GetJSON reads key and decodes it into a T
+func GetJSON[T any](ctx context.Context, c Cache, key string) (T, bool, error) {
+	var v T
+	data, ok, err := c.Get(ctx, key)
+	if err != nil || !ok {
+		return v, false, err
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, false, err
+	}
+	return v, true, nil
+}
+
+// SetJSON encodes v as JSON and stores it under key
+func SetJSON(ctx context.Context, c Cache, key string, v any, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, data, ttl)
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Memory is an in-process LRU cache
+type Memory struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // most recently used at the front
+	entries map[string]*list.Element
+}
+
+// NewMemory creates a Memory cache holding at most maxEntries entries
+func NewMemory(maxEntries int) *Memory {
+	return &Memory{
+		max:     maxEntries,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*entry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		m.remove(el)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	if el, ok := m.entries[key]; ok {
+		el.Value = &entry{key: key, value: value, expires: expires}
+		m.order.MoveToFront(el)
+		return nil
+	}
+	m.entries[key] = m.order.PushFront(&entry{key: key, value: value, expires: expires})
+	for m.max > 0 && m.order.Len() > m.max {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.remove(el)
+	}
+	return nil
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+func (m *Memory) remove(el *list.Element) {
+	m.order.Remove(el)
+	delete(m.entries, el.Value.(*entry).key)
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Instrumented wraps a Cache and counts hits, misses and errors
+type Instrumented struct {
+	Cache
+	hits, misses, errors prometheus.Counter
+}
+
+var lookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_lookups_total",
+	Help: "Cache lookups by cache name and result (hit, miss or error).",
+}, []string{"cache", "result"})
+
+// WithMetrics counts lookups on c under name in the cache_lookups_total
+// counter registered with reg. The counter is shared, so several caches can be
+// instrumented against the same registry.
+func WithMetrics(c Cache, name string, reg prometheus.Registerer) *Instrumented {
+	if err := reg.Register(lookups); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			panic(err)
+		}
+	}
+	return &Instrumented{
+		Cache:  c,
+		hits:   lookups.WithLabelValues(name, "hit"),
+		misses: lookups.WithLabelValues(name, "miss"),
+		errors: lookups.WithLabelValues(name, "error"),
+	}
+}
+
+func (i *Instrumented) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	data, ok, err := i.Cache.Get(ctx, key)
+	switch {
+	case err != nil:
+		i.errors.Inc()
+	case ok:
+		i.hits.Inc()
+	default:
+		i.misses.Inc()
+	}
+	return data, ok, err
+}
@@ -0,0 +1,103 @@
+// Package chaos injects faults into a share of requests so client teams can
+// test their retry and timeout handling against the services. It must be
+// switched on explicitly and should never run in production.
+package chaos
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/respond"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FaultHeader names the fault injected into a response, where one is sent
+const FaultHeader = "X-Injected-Fault"
+
+// Config sets the share of requests, in percent, that get each fault. A
+// request gets at most one of error and drop, and may be delayed as well.
+type Config struct {
+	// Latency is added to LatencyPercent of requests
+	Latency        time.Duration
+	LatencyPercent float64
+	// ErrorPercent of requests are answered 503 without being served
+	ErrorPercent float64
+	// DropPercent of requests have their connection closed without an
+	// answer
+	DropPercent float64
+}
+
+// Injector injects the configured faults
+type Injector struct {
+	faults *prometheus.CounterVec
+
+	mu  sync.Mutex
+	cfg Config
+	rnd *rand.Rand
+}
+
+// New creates an injector counting the faults it injects in
+// chaos_faults_total on reg
+func New(cfg Config, reg prometheus.Registerer) *Injector {
+	i := &Injector{
+		cfg: cfg,
+		rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+		faults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chaos_faults_total",
+			Help: "Faults injected into requests by kind.",
+		}, []string{"kind"}),
+	}
+	reg.MustRegister(i.faults)
+	return i
+}
+
+// SetConfig changes the faults, e.g. after a configuration reload
+func (i *Injector) SetConfig(cfg Config) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.cfg = cfg
+}
+
+// roll decides the faults of one request
+func (i *Injector) roll() (delay time.Duration, fail, drop bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.rnd.Float64()*100 < i.cfg.LatencyPercent {
+		delay = i.cfg.Latency
+	}
+	n := i.rnd.Float64() * 100
+	fail = n < i.cfg.ErrorPercent
+	drop = !fail && n < i.cfg.ErrorPercent+i.cfg.DropPercent
+	return delay, fail, drop
+}
+
+// Middleware injects faults before requests reach next
+func (i *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, fail, drop := i.roll()
+		if delay > 0 {
+			i.faults.WithLabelValues("latency").Inc()
+			w.Header().Set(FaultHeader, "latency")
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		switch {
+		case fail:
+			i.faults.WithLabelValues("error").Inc()
+			w.Header().Set(FaultHeader, "error")
+			respond.Error(w, http.StatusServiceUnavailable, "injected fault")
+		case drop:
+			i.faults.WithLabelValues("drop").Inc()
+			// aborts the response and closes the connection, or resets the
+			// stream with HTTP/2, without logging a panic
+			panic(http.ErrAbortHandler)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
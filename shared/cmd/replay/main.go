@@ -0,0 +1,51 @@
+// Command replay sends recorded exchanges to a build of a service and
+// reports the responses that changed:
+//
+//	replay -target http://localhost:8000 -api-key $KEY recording.jsonl
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/replay"
+)
+
+func main() {
+	target := flag.String("target", "http://localhost:8000", "base URL of the build to replay against")
+	apiKey := flag.String("api-key", os.Getenv("API_KEY"), "API key to send the requests with")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: replay [flags] recording.jsonl...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	t := replay.Target{BaseURL: *target, Header: make(http.Header)}
+	if *apiKey != "" {
+		t.Header.Set(auth.APIKeyHeader, *apiKey)
+	}
+	failed := false
+	for _, path := range flag.Args() {
+		replayed, mismatches, err := replay.Replay(context.Background(), path, t)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		for _, m := range mismatches {
+			fmt.Printf("%s: %s\n", path, m)
+		}
+		fmt.Printf("%s: %d replayed, %d changed\n", path, replayed, len(mismatches))
+		failed = failed || len(mismatches) > 0
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,196 @@
+// Package codec negotiates request and response formats so handlers can
+// accept and emit JSON, XML, CSV and MessagePack without caring which one a
+// client speaks.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ixmorrow/go-projects/shared/respond"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes and decodes one media type
+type Codec interface {
+	ContentType() string
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// MaxBodyBytes bounds the request bodies Decode reads. Bigger ones fail
+// with an *http.MaxBytesError, for handlers to answer 413.
+const MaxBodyBytes = 10 << 20
+
+// ErrUnsupportedMediaType is returned by Decode for request bodies in a
+// format no codec handles
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+var (
+	JSON    Codec = jsonCodec{}
+	XML     Codec = xmlCodec{}
+	CSV     Codec = csvCodec{}
+	MsgPack Codec = msgpackCodec{}
+	// Form only decodes, from HTML forms and curl -d
+	Form Codec = formCodec{}
+)
+
+// codecs are matched against Accept and Content-Type, JSON first as the
+// default
+var codecs = []Codec{JSON, XML, CSV, MsgPack}
+
+var aliases = map[string]Codec{
+	"text/json":               JSON,
+	"text/xml":                XML,
+	"application/x-msgpack":   MsgPack,
+	"application/vnd.msgpack": MsgPack,
+}
+
+// ForContentType returns the codec for a media type, ignoring parameters
+func ForContentType(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	for _, c := range codecs {
+		if c.ContentType() == mediaType {
+			return c, true
+		}
+	}
+	c, ok := aliases[mediaType]
+	return c, ok
+}
+
+// ContentTypes lists the media types Decode reads, for telling clients
+// what to send instead of an unsupported type
+func ContentTypes() []string {
+	types := make([]string, len(codecs), len(codecs)+1)
+	for i, c := range codecs {
+		types[i] = c.ContentType()
+	}
+	return append(types, Form.ContentType())
+}
+
+// Negotiate picks the codec that best matches an Accept header, honouring
+// q-values. It falls back to JSON when nothing acceptable is supported.
+func Negotiate(accept string) Codec {
+	type candidate struct {
+		codec Codec
+		q     float64
+		order int
+	}
+	var candidates []candidate
+	for i, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(qs, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		var c Codec
+		switch {
+		case mediaType == "*/*", mediaType == "application/*":
+			c = JSON
+		default:
+			c, _ = ForContentType(mediaType)
+		}
+		if c != nil {
+			candidates = append(candidates, candidate{c, q, i})
+		}
+	}
+	if len(candidates) == 0 {
+		return JSON
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].codec
+}
+
+// Decode reads the request body into v using the codec matching its
+// Content-Type. Bodies without a Content-Type are decoded as JSON, and
+// form-encoded ones holding JSON too, since that is what curl -d sends by
+// default. At most MaxBodyBytes are read.
+func Decode(r *http.Request, v any) error {
+	c, err := ForRequest(r)
+	if err != nil {
+		return err
+	}
+	return c.Decode(http.MaxBytesReader(nil, r.Body, MaxBodyBytes), v)
+}
+
+// ForRequest returns the codec Decode uses for the body of r
+func ForRequest(r *http.Request) (Codec, error) {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return JSON, nil
+	}
+	if strings.HasPrefix(ct, Form.ContentType()) {
+		return Form, nil
+	}
+	c, ok := ForContentType(ct)
+	if !ok {
+		return nil, ErrUnsupportedMediaType
+	}
+	return c, nil
+}
+
+// Respond writes v with the given status in the format the request's Accept
+// header asks for. Values the format can't hold, such as maps with other
+// than string keys in XML, are answered with a JSON 500 rather than a
+// truncated body.
+func Respond(w http.ResponseWriter, r *http.Request, status int, v any) {
+	c := Negotiate(r.Header.Get("Accept"))
+	var body bytes.Buffer
+	if err := c.Encode(&body, v); err != nil {
+		slog.ErrorContext(r.Context(), "encoding response", "content_type", c.ContentType(), "error", err)
+		w.Header().Add("Vary", "Accept")
+		respond.Error(w, http.StatusInternalServerError, "the response can't be encoded as "+c.ContentType())
+		return
+	}
+	w.Header().Set("Content-Type", c.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+}
+
+// Error answers with msg in respond's error body, in the format the client
+// accepts, for clients that can't read JSON
+func Error(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	Respond(w, r, status, respond.ErrorBody{Error: msg})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string             { return "application/json" }
+func (jsonCodec) Encode(w io.Writer, v any) error { return json.NewEncoder(w).Encode(v) }
+func (jsonCodec) Decode(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Encode(w io.Writer, v any) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+func (msgpackCodec) Decode(r io.Reader, v any) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
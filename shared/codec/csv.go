@@ -0,0 +1,275 @@
+package codec
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvCodec writes one row per value with a header row taken from the json
+// field names. Nested structs become dotted columns such as director.lastname.
+type csvCodec struct{}
+
+func (csvCodec) ContentType() string { return "text/csv" }
+
+type column struct {
+	name  string
+	index []int
+}
+
+func (csvCodec) Encode(w io.Writer, v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	var rows []reflect.Value
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		for i := 0; i < rv.Len(); i++ {
+			rows = append(rows, rv.Index(i))
+		}
+	} else {
+		rows = []reflect.Value{rv}
+	}
+
+	elem := rv.Type()
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		elem = elem.Elem()
+	}
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+
+	cw := csv.NewWriter(w)
+	if elem.Kind() != reflect.Struct || elem == reflect.TypeOf(time.Time{}) {
+		cw.Write([]string{"value"})
+		for _, row := range rows {
+			cw.Write([]string{formatCSV(row)})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	cols := columns(elem, "", nil)
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.name
+	}
+	cw.Write(header)
+	record := make([]string, len(cols))
+	for _, row := range rows {
+		for i, c := range cols {
+			record[i] = formatCSV(fieldByIndex(row, c.index))
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (csvCodec) Decode(r io.Reader, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("csv: decode target must be a non-nil pointer")
+	}
+	target := rv.Elem()
+	elem := target.Type()
+	if target.Kind() == reflect.Slice {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("csv: cannot decode into %s", target.Type())
+	}
+
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("csv: reading header: %w", err)
+	}
+	byName := make(map[string][]int)
+	for _, c := range columns(elem, "", nil) {
+		byName[strings.ToLower(c.name)] = c.index
+	}
+
+	line := 1
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line++
+		item := reflect.New(elem).Elem()
+		for i, value := range record {
+			if i >= len(header) || value == "" {
+				continue
+			}
+			index, ok := byName[strings.ToLower(strings.TrimSpace(header[i]))]
+			if !ok {
+				continue
+			}
+			if err := parseCSV(allocField(item, index), value); err != nil {
+				return fmt.Errorf("csv: line %d, column %s: %w", line, header[i], err)
+			}
+		}
+		if target.Kind() != reflect.Slice {
+			target.Set(item)
+			return nil
+		}
+		target.Set(reflect.Append(target, item))
+	}
+}
+
+// columns lists the exported fields of t, named like encoding/json would
+// name them, flattening nested structs
+func columns(t reflect.Type, prefix string, index []int) []column {
+	var cols []column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, tagged := f.Name, false
+		if tag := f.Tag.Get("json"); tag != "" {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name, tagged = tagName, true
+			}
+		}
+		idx := append(append([]int{}, index...), i)
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			// like encoding/json, untagged embedded structs add their
+			// fields to the outer one
+			if f.Anonymous && !tagged {
+				cols = append(cols, columns(ft, prefix, idx)...)
+				continue
+			}
+			cols = append(cols, columns(ft, prefix+name+".", idx)...)
+			continue
+		}
+		cols = append(cols, column{prefix + name, idx})
+	}
+	return cols
+}
+
+// fieldByIndex follows index through v, returning an invalid Value when it
+// hits a nil pointer
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+// allocField is fieldByIndex for writing, allocating nil pointers on the way
+func allocField(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func formatCSV(v reflect.Value) string {
+	for v.IsValid() && v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return ""
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.Interface:
+		data, _ := json.Marshal(v.Interface())
+		return string(data)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func parseCSV(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return json.Unmarshal([]byte(s), v.Addr().Interface())
+	}
+	return nil
+}
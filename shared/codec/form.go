@@ -0,0 +1,61 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+)
+
+type formCodec struct{}
+
+func (formCodec) ContentType() string { return "application/x-www-form-urlencoded" }
+
+// Encode fails, forms are only read. Negotiate never picks Form.
+func (formCodec) Encode(w io.Writer, v any) error {
+	return errors.New("form: responses can't be form encoded")
+}
+
+// Decode reads form fields into the struct fields with their JSON names.
+// Bodies holding JSON are decoded as JSON, as curl -d sends JSON with the
+// form Content-Type unless told otherwise.
+func (formCodec) Decode(r io.Reader, v any) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return io.EOF
+	}
+	if trimmed[0] == '{' || trimmed[0] == '[' {
+		return JSON.Decode(bytes.NewReader(data), v)
+	}
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return fmt.Errorf("form: %w", err)
+	}
+	return DecodeValues(values, v)
+}
+
+// DecodeValues sets the fields of the struct v points to from values,
+// matching keys to JSON field names, so query parameters and form fields
+// read like a body. Nested fields are named with dots, as in CSV headers.
+func DecodeValues(values url.Values, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("form: cannot decode into %T", v)
+	}
+	for _, c := range columns(rv.Elem().Type(), "", nil) {
+		value := values.Get(c.name)
+		if value == "" {
+			continue
+		}
+		if err := parseCSV(allocField(rv.Elem(), c.index), value); err != nil {
+			return fmt.Errorf("form: field %s: %w", c.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// xmlCodec names elements after the json field names, like the other
+// codecs, so "cardNumber" in JSON is <cardNumber> in XML. An xml tag
+// overrides the name. The root element is named after the type, slices are
+// <items> of <item> elements and slice fields repeat their element.
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string { return "application/xml" }
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	xmlNameType = reflect.TypeOf(xml.Name{})
+)
+
+func (xmlCodec) Encode(w io.Writer, v any) error {
+	rv := reflect.ValueOf(v)
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	if err := encodeXML(enc, rootName(rv), rv); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func (xmlCodec) Decode(r io.Reader, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("xml: decode target must be a non-nil pointer")
+	}
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return decodeXML(dec, start, rv.Elem())
+		}
+	}
+}
+
+// xmlField is a struct field with the name of its element
+type xmlField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// xmlFields lists the exported fields of t with their json names, or their
+// xml names where they have them. Untagged embedded structs add their
+// fields to the outer one, as in encoding/json.
+func xmlFields(t reflect.Type, index []int) []xmlField {
+	var fields []xmlField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Type == xmlNameType {
+			continue
+		}
+		name, tagged := f.Name, false
+		tagName, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tagName == "-" {
+			continue
+		}
+		if tagName != "" {
+			name, tagged = tagName, true
+		}
+		if tag := f.Tag.Get("xml"); tag != "" {
+			xmlName, _, _ := strings.Cut(tag, ",")
+			if xmlName == "-" {
+				continue
+			}
+			if xmlName != "" {
+				name, tagged = xmlName, true
+			}
+		}
+		idx := append(append([]int{}, index...), i)
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && !tagged && ft.Kind() == reflect.Struct {
+			fields = append(fields, xmlFields(ft, idx)...)
+			continue
+		}
+		fields = append(fields, xmlField{name, idx, strings.Contains(opts, "omitempty")})
+	}
+	return fields
+}
+
+// rootName names the element v is encoded as: the XMLName of a struct,
+// else its type name
+func rootName(v reflect.Value) string {
+	if !v.IsValid() {
+		return "value"
+	}
+	t := v.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 || t.Kind() == reflect.Array {
+		return "items"
+	}
+	if t.Kind() == reflect.Struct {
+		if f, ok := t.FieldByName("XMLName"); ok && f.Type == xmlNameType {
+			if name, _, _ := strings.Cut(f.Tag.Get("xml"), ","); name != "" {
+				return name
+			}
+		}
+	}
+	if t.Name() == "" {
+		return "value"
+	}
+	return t.Name()
+}
+
+// encodeXML writes v as the element name
+func encodeXML(enc *xml.Encoder, name string, v reflect.Value) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch {
+	case v.Type() == timeType:
+		return encodeText(enc, start, formatCSV(v))
+	case v.Kind() == reflect.Struct:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, f := range xmlFields(v.Type(), nil) {
+			fv := fieldByIndex(v, f.index)
+			if !fv.IsValid() || f.omitEmpty && emptyValue(fv) {
+				continue
+			}
+			if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 || fv.Kind() == reflect.Array {
+				for i := 0; i < fv.Len(); i++ {
+					if err := encodeXML(enc, f.name, fv.Index(i)); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := encodeXML(enc, f.name, fv); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case v.Kind() == reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("xml: can't encode %s, map keys must be strings", v.Type())
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			if !elementName(k.String()) {
+				return fmt.Errorf("xml: map key %q is not an element name", k.String())
+			}
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := encodeXML(enc, k, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		// base64, like encoding/json
+		return encodeText(enc, start, base64.StdEncoding.EncodeToString(v.Bytes()))
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeXML(enc, "item", v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case v.Kind() == reflect.Chan, v.Kind() == reflect.Func, v.Kind() == reflect.Complex64, v.Kind() == reflect.Complex128:
+		return fmt.Errorf("xml: can't encode %s", v.Type())
+	}
+	return encodeText(enc, start, formatCSV(v))
+}
+
+func encodeText(enc *xml.Encoder, start xml.StartElement, text string) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// emptyValue is what omitempty leaves out in encoding/json
+func emptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Struct:
+		return false
+	}
+	return v.IsZero()
+}
+
+// elementName reports whether s can name an element
+func elementName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, c := range s {
+		letter := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || c != '-' && c != '.' && (c < '0' || c > '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeXML reads the element start into v. Struct fields and map entries
+// are its children, slices hold one child per item.
+func decodeXML(dec *xml.Decoder, start xml.StartElement, v reflect.Value) error {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		byName := make(map[string][]int)
+		for _, f := range xmlFields(v.Type(), nil) {
+			byName[f.name] = f.index
+		}
+		return decodeChildren(dec, func(child xml.StartElement) error {
+			index, ok := byName[child.Name.Local]
+			if !ok {
+				return dec.Skip()
+			}
+			field := allocField(v, index)
+			if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 {
+				return appendXML(dec, child, field)
+			}
+			return decodeXML(dec, child, field)
+		})
+	case v.Kind() == reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("xml: can't decode into %s, map keys must be strings", v.Type())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		return decodeChildren(dec, func(child xml.StartElement) error {
+			item := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeXML(dec, child, item); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(child.Name.Local).Convert(v.Type().Key()), item)
+			return nil
+		})
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		return decodeChildren(dec, func(child xml.StartElement) error {
+			return appendXML(dec, child, v)
+		})
+	}
+
+	var text string
+	if err := dec.DecodeElement(&text, &start); err != nil {
+		return err
+	}
+	text = strings.TrimSpace(text)
+	switch {
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		v.Set(reflect.ValueOf(text))
+	case v.Kind() == reflect.Slice:
+		data, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return fmt.Errorf("xml: element %s: %w", start.Name.Local, err)
+		}
+		v.SetBytes(data)
+	case text == "" && v.Kind() != reflect.String:
+		// empty elements leave the zero value, like missing ones
+	default:
+		if err := parseCSV(v, text); err != nil {
+			return fmt.Errorf("xml: element %s: %w", start.Name.Local, err)
+		}
+	}
+	return nil
+}
+
+// appendXML decodes the element start into a new item of slice
+func appendXML(dec *xml.Decoder, start xml.StartElement, slice reflect.Value) error {
+	item := reflect.New(slice.Type().Elem()).Elem()
+	if err := decodeXML(dec, start, item); err != nil {
+		return err
+	}
+	slice.Set(reflect.Append(slice, item))
+	return nil
+}
+
+// decodeChildren calls child for each element in the one just started,
+// which it reads to its end
+func decodeChildren(dec *xml.Decoder, child func(xml.StartElement) error) error {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if err := child(t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
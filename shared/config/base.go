@@ -0,0 +1,448 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/cache"
+	"github.com/ixmorrow/go-projects/shared/chaos"
+	"github.com/ixmorrow/go-projects/shared/cors"
+	"github.com/ixmorrow/go-projects/shared/flags"
+	"github.com/ixmorrow/go-projects/shared/jobs"
+	"github.com/ixmorrow/go-projects/shared/loadshed"
+	"github.com/ixmorrow/go-projects/shared/logging"
+	"github.com/ixmorrow/go-projects/shared/metering"
+	"github.com/ixmorrow/go-projects/shared/metrics"
+	"github.com/ixmorrow/go-projects/shared/mirror"
+	"github.com/ixmorrow/go-projects/shared/ratelimit"
+	"github.com/ixmorrow/go-projects/shared/schedule"
+	"github.com/ixmorrow/go-projects/shared/server"
+	"github.com/ixmorrow/go-projects/shared/webhook"
+)
+
+// Base is the configuration every service shares. Services embed it inline
+// in their own config struct and add their specific settings next to it.
+type Base struct {
+	Server      Server      `yaml:"server"`
+	Compression Compression `yaml:"compression"`
+	CORS        CORS        `yaml:"cors"`
+	TLS         TLS         `yaml:"tls"`
+	Log         Log         `yaml:"log"`
+	AccessLog   AccessLog   `yaml:"accessLog"`
+	Auth        Auth        `yaml:"auth"`
+	Database    Database    `yaml:"database"`
+	Cache       Cache       `yaml:"cache"`
+	RateLimit   RateLimit   `yaml:"rateLimit"`
+	Quota       Quota       `yaml:"quota"`
+	LoadShed    LoadShed    `yaml:"loadShed"`
+	Jobs        Jobs        `yaml:"jobs"`
+	Scheduler   Scheduler   `yaml:"scheduler"`
+	Debug       Debug       `yaml:"debug"`
+	StatsD      StatsD      `yaml:"statsd"`
+	Record      Record      `yaml:"record"`
+	Mirror      Mirror      `yaml:"mirror"`
+	Chaos       Chaos       `yaml:"chaos"`
+	Webhook     Webhook     `yaml:"webhook"`
+	// Features lists feature flags that are switched on for everyone
+	Features []string `yaml:"features" env:"FEATURES" flag:"features" usage:"comma separated feature flags to enable"`
+	// Flags configures gradual rollouts, it can only be set in the YAML file
+	Flags map[string]flags.Flag `yaml:"flags"`
+	// Tenants overrides settings per tenant, it can only be set in the YAML
+	// file
+	Tenants map[string]Tenant `yaml:"tenants"`
+}
+
+// Tenant holds the settings a tenant changes from the service defaults.
+// Unset values keep the default.
+type Tenant struct {
+	// RateLimit applies to the route groups without limits of their own
+	RateLimit RateLimits `yaml:"rateLimit"`
+	Quota     *Quota     `yaml:"quota"`
+	// Features lists feature flags switched on for the tenant's callers
+	Features []string `yaml:"features"`
+}
+
+type Server struct {
+	Listen            string        `yaml:"listen" env:"LISTEN_ADDR" flag:"listen" default:":8000" usage:"address to listen on, empty to only use the socket"`
+	Socket            string        `yaml:"socket" env:"LISTEN_SOCKET" flag:"listen-socket" usage:"path of a Unix socket to listen on as well"`
+	H2C               bool          `yaml:"h2c" env:"H2C" flag:"h2c" usage:"serve cleartext HTTP/2 for a trusted load balancer"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" default:"30s" usage:"how long to wait for in-flight requests on shutdown"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"READ_HEADER_TIMEOUT" flag:"read-header-timeout" default:"10s" usage:"how long clients get to send request headers"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" env:"READ_TIMEOUT" flag:"read-timeout" default:"2m" usage:"how long clients get to send a whole request, 0 for no limit"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" env:"WRITE_TIMEOUT" flag:"write-timeout" default:"2m" usage:"how long writing a response may take, 0 for no limit"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" env:"IDLE_TIMEOUT" flag:"idle-timeout" default:"2m" usage:"how long keep-alive connections wait for the next request"`
+	TrustedProxies    []string      `yaml:"trustedProxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma separated addresses or CIDRs of proxies whose X-Forwarded-For names the client"`
+	// Listeners adds addresses to serve on, each with its own TLS settings.
+	// They can only be set in the YAML file, e.g.
+	//
+	//	listeners:
+	//	  - {network: tcp4, addr: "0.0.0.0:8000"}
+	//	  - {network: tcp6, addr: "[::]:8000"}
+	//	  - {addr: ":8443", tls: {certFile: cert.pem, keyFile: key.pem}}
+	Listeners []Listener `yaml:"listeners"`
+}
+
+type Compression struct {
+	Enabled bool `yaml:"enabled" env:"COMPRESSION" flag:"compression" default:"true" usage:"gzip responses for clients accepting it"`
+	MinSize int  `yaml:"minSize" env:"COMPRESSION_MIN_SIZE" flag:"compression-min-size" default:"1024" usage:"smallest response in bytes that is gzipped"`
+}
+
+type CORS struct {
+	AllowedOrigins []string      `yaml:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS" flag:"cors-allowed-origins" usage:"comma separated origins browsers may call from, e.g. https://*.example.com, off when empty"`
+	AllowedMethods []string      `yaml:"allowedMethods" env:"CORS_ALLOWED_METHODS" flag:"cors-allowed-methods" default:"GET,POST" usage:"comma separated methods cross-origin requests may use"`
+	AllowedHeaders []string      `yaml:"allowedHeaders" env:"CORS_ALLOWED_HEADERS" flag:"cors-allowed-headers" default:"Content-Type,Authorization,X-API-Key,X-Request-ID" usage:"comma separated headers cross-origin requests may send"`
+	MaxAge         time.Duration `yaml:"maxAge" env:"CORS_MAX_AGE" flag:"cors-max-age" default:"10m" usage:"how long browsers may cache preflight answers"`
+}
+
+type Listener struct {
+	Network   string `yaml:"network"`
+	Addr      string `yaml:"addr"`
+	TLS       *TLS   `yaml:"tls"`
+	Plaintext bool   `yaml:"plaintext"`
+}
+
+type TLS struct {
+	CertFile          string   `yaml:"certFile" env:"TLS_CERT_FILE" flag:"tls-cert" usage:"TLS certificate file"`
+	KeyFile           string   `yaml:"keyFile" env:"TLS_KEY_FILE" flag:"tls-key" usage:"TLS private key file"`
+	AutocertHosts     []string `yaml:"autocertHosts" env:"TLS_AUTOCERT_HOSTS" flag:"tls-autocert-hosts" usage:"hosts to obtain Let's Encrypt certificates for"`
+	AutocertCacheDir  string   `yaml:"autocertCacheDir" env:"TLS_AUTOCERT_CACHE_DIR" flag:"tls-autocert-cache" usage:"directory to cache Let's Encrypt certificates in, autocert in the user cache directory by default"`
+	ClientCAFile      string   `yaml:"clientCAFile" env:"TLS_CLIENT_CA_FILE" flag:"tls-client-ca" usage:"CA bundle to verify client certificates with"`
+	RequireClientCert bool     `yaml:"requireClientCert" env:"TLS_REQUIRE_CLIENT_CERT" flag:"tls-require-client-cert" usage:"reject clients without a valid certificate, needs a client CA"`
+}
+
+type Log struct {
+	Level           string   `yaml:"level" env:"LOG_LEVEL" flag:"log-level" default:"info" usage:"debug, info, warn or error"`
+	SensitiveFields []string `yaml:"sensitiveFields" env:"LOG_REDACT_FIELDS" flag:"log-redact-fields" usage:"extra log fields to mask"`
+}
+
+type AccessLog struct {
+	File        string        `yaml:"file" env:"ACCESS_LOG_FILE" flag:"access-log" usage:"file to write the access log to, off when empty"`
+	Format      string        `yaml:"format" env:"ACCESS_LOG_FORMAT" flag:"access-log-format" default:"combined" usage:"combined or json"`
+	MaxSizeMB   int           `yaml:"maxSizeMB" env:"ACCESS_LOG_MAX_SIZE_MB" flag:"access-log-max-size" default:"100" usage:"rotate the access log at this size, 0 for no limit"`
+	RotateEvery time.Duration `yaml:"rotateEvery" env:"ACCESS_LOG_ROTATE_EVERY" flag:"access-log-rotate-every" default:"24h" usage:"rotate the access log this often, 0 for never"`
+	MaxBackups  int           `yaml:"maxBackups" env:"ACCESS_LOG_MAX_BACKUPS" flag:"access-log-max-backups" default:"14" usage:"rotated access logs to keep, 0 keeps all"`
+	Compress    bool          `yaml:"compress" env:"ACCESS_LOG_COMPRESS" flag:"access-log-compress" default:"true" usage:"gzip rotated access logs"`
+}
+
+type Auth struct {
+	KeysFile        string        `yaml:"keysFile" env:"API_KEYS_FILE" flag:"api-keys-file" default:"apikeys.json" usage:"JSON file of API keys, used without a database"`
+	AdminKey        string        `yaml:"adminKey" env:"ADMIN_API_KEY" usage:"bootstrap admin API key"`
+	OIDCIssuer      string        `yaml:"oidcIssuer" env:"OIDC_ISSUER" flag:"oidc-issuer" usage:"accept bearer tokens from this OIDC issuer"`
+	OIDCAudience    string        `yaml:"oidcAudience" env:"OIDC_AUDIENCE" flag:"oidc-audience" usage:"required bearer token audience, needed with an issuer"`
+	OIDCJWKSURL     string        `yaml:"oidcJwksUrl" env:"OIDC_JWKS_URL" flag:"oidc-jwks-url" usage:"JWKS URL, discovered from the issuer when empty"`
+	OIDCScopeMap    string        `yaml:"oidcScopeMap" env:"OIDC_SCOPE_MAP" flag:"oidc-scope-map" usage:"token to route scope mapping, token=scope,..., unmapped token scopes are dropped"`
+	OIDCTenantClaim string        `yaml:"oidcTenantClaim" env:"OIDC_TENANT_CLAIM" flag:"oidc-tenant-claim" default:"tenant" usage:"bearer token claim naming the caller's tenant"`
+	OIDCLeeway      time.Duration `yaml:"oidcLeeway" env:"OIDC_LEEWAY" flag:"oidc-leeway" default:"1m" usage:"clock skew allowed when checking token expiry"`
+}
+
+type Database struct {
+	URL string `yaml:"url" env:"DATABASE_URL" flag:"database-url" usage:"SQLite path or postgres:// URL"`
+}
+
+type Cache struct {
+	Backend    string `yaml:"backend" env:"CACHE_BACKEND" flag:"cache-backend" default:"memory" usage:"memory or redis"`
+	RedisURL   string `yaml:"redisUrl" env:"REDIS_URL" flag:"redis-url" usage:"redis:// URL for the redis cache backend"`
+	MaxEntries int    `yaml:"maxEntries" env:"CACHE_MAX_ENTRIES" flag:"cache-max-entries" default:"10000" usage:"size of the memory cache"`
+}
+
+type RateLimit struct {
+	Rate  float64 `yaml:"rate" env:"RATE_LIMIT" flag:"rate-limit" default:"20" usage:"requests per second per client"`
+	Burst int     `yaml:"burst" env:"RATE_LIMIT_BURST" flag:"rate-limit-burst" default:"40" usage:"request burst per client"`
+	// Groups sets the limits of route groups by name, e.g. batch, in place
+	// of Rate, Burst and the tenants' overrides. It can only be set in the
+	// YAML file.
+	Groups map[string]RateLimits `yaml:"groups"`
+}
+
+// RateLimits overrides the default rate limits, zero values keep them
+type RateLimits struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+type Quota struct {
+	Daily   int64 `yaml:"daily" env:"QUOTA_DAILY" flag:"quota-daily" usage:"requests per API key and day, 0 for unlimited"`
+	Monthly int64 `yaml:"monthly" env:"QUOTA_MONTHLY" flag:"quota-monthly" usage:"requests per API key and month, 0 for unlimited"`
+}
+
+type LoadShed struct {
+	MaxInFlight      int           `yaml:"maxInFlight" env:"MAX_IN_FLIGHT" flag:"max-in-flight" default:"256" usage:"validation requests served at once"`
+	MaxInFlightBatch int           `yaml:"maxInFlightBatch" env:"MAX_IN_FLIGHT_BATCH" flag:"max-in-flight-batch" default:"16" usage:"batch and report requests served at once"`
+	MaxWait          time.Duration `yaml:"maxWait" env:"LOAD_SHED_MAX_WAIT" flag:"load-shed-max-wait" default:"100ms" usage:"how long a request waits for capacity before it is shed"`
+}
+
+type Jobs struct {
+	Workers     int           `yaml:"workers" env:"JOB_WORKERS" flag:"job-workers" default:"4" usage:"background jobs run at once"`
+	QueueSize   int           `yaml:"queueSize" env:"JOB_QUEUE_SIZE" flag:"job-queue-size" default:"1000" usage:"background jobs waiting to run"`
+	MaxAttempts int           `yaml:"maxAttempts" env:"JOB_MAX_ATTEMPTS" flag:"job-max-attempts" default:"3" usage:"tries before a job fails"`
+	Backoff     time.Duration `yaml:"backoff" env:"JOB_BACKOFF" flag:"job-backoff" default:"1s" usage:"delay before the first retry"`
+	Lease       time.Duration `yaml:"lease" env:"JOB_LEASE" flag:"job-lease" default:"1m" usage:"how long a replica holds a job without renewing it, jobs of replicas that died run again after it"`
+	Retention   time.Duration `yaml:"retention" env:"JOB_RETENTION" flag:"job-retention" default:"720h" usage:"how long finished jobs are kept, 0 keeps them forever"`
+}
+
+type Scheduler struct {
+	LeaseTTL time.Duration `yaml:"leaseTtl" env:"SCHEDULER_LEASE_TTL" flag:"scheduler-lease-ttl" default:"30s" usage:"how long scheduler leadership lasts without renewal"`
+}
+
+type Debug struct {
+	Listen    string `yaml:"listen" env:"DEBUG_ADDR" flag:"debug-addr" usage:"address of the pprof and expvar listener, off when empty"`
+	LocalOnly bool   `yaml:"localOnly" env:"DEBUG_LOCAL_ONLY" flag:"debug-local-only" default:"true" usage:"only answer debug requests from loopback addresses"`
+}
+
+type StatsD struct {
+	Addr     string        `yaml:"addr" env:"STATSD_ADDR" flag:"statsd-addr" usage:"UDP address of a StatsD agent to push metrics to, off when empty"`
+	Flavor   string        `yaml:"flavor" env:"STATSD_FLAVOR" flag:"statsd-flavor" default:"dogstatsd" usage:"dogstatsd or statsd"`
+	Prefix   string        `yaml:"prefix" env:"STATSD_PREFIX" flag:"statsd-prefix" usage:"prefix of the pushed metric names"`
+	Tags     []string      `yaml:"tags" env:"STATSD_TAGS" flag:"statsd-tags" usage:"comma separated name:value tags added to every metric"`
+	Interval time.Duration `yaml:"interval" env:"STATSD_INTERVAL" flag:"statsd-interval" default:"10s" usage:"how often metrics are pushed"`
+}
+
+type Record struct {
+	File   string  `yaml:"file" env:"RECORD_FILE" flag:"record" usage:"file to record sanitized exchanges to for replaying, off when empty"`
+	Sample float64 `yaml:"sample" env:"RECORD_SAMPLE" flag:"record-sample" default:"1" usage:"share of requests to record"`
+}
+
+type Mirror struct {
+	URL    string  `yaml:"url" env:"MIRROR_URL" flag:"mirror" usage:"base URL of a secondary backend to copy sampled API requests to, off when empty"`
+	Sample float64 `yaml:"sample" env:"MIRROR_SAMPLE" flag:"mirror-sample" default:"0.1" usage:"share of requests to mirror"`
+	APIKey string  `yaml:"apiKey" env:"MIRROR_API_KEY" usage:"API key the secondary backend expects"`
+}
+
+type Chaos struct {
+	Enabled        bool          `yaml:"enabled" env:"CHAOS_ENABLED" flag:"chaos" usage:"inject faults into API requests, never in production"`
+	Latency        time.Duration `yaml:"latency" env:"CHAOS_LATENCY" flag:"chaos-latency" default:"2s" usage:"latency added to delayed requests"`
+	LatencyPercent float64       `yaml:"latencyPercent" env:"CHAOS_LATENCY_PERCENT" flag:"chaos-latency-percent" usage:"percentage of requests to delay"`
+	ErrorPercent   float64       `yaml:"errorPercent" env:"CHAOS_ERROR_PERCENT" flag:"chaos-error-percent" usage:"percentage of requests to answer with 503"`
+	DropPercent    float64       `yaml:"dropPercent" env:"CHAOS_DROP_PERCENT" flag:"chaos-drop-percent" usage:"percentage of requests to drop the connection of"`
+}
+
+type Webhook struct {
+	Secret       string `yaml:"secret" env:"WEBHOOK_SECRET" usage:"key signing webhook callbacks, callbacks are off when empty"`
+	AllowPrivate bool   `yaml:"allowPrivate" env:"WEBHOOK_ALLOW_PRIVATE" flag:"webhook-allow-private" usage:"let callbacks reach private addresses, for development"`
+}
+
+// ServerConfig converts the server and TLS settings for server.New
+func (b Base) ServerConfig() server.Config {
+	cfg := server.Config{
+		Addr:              b.Server.Listen,
+		Socket:            b.Server.Socket,
+		H2C:               b.Server.H2C,
+		TLS:               b.TLS.serverConfig(),
+		ShutdownTimeout:   b.Server.ShutdownTimeout,
+		ReadHeaderTimeout: b.Server.ReadHeaderTimeout,
+		ReadTimeout:       b.Server.ReadTimeout,
+		WriteTimeout:      b.Server.WriteTimeout,
+		IdleTimeout:       b.Server.IdleTimeout,
+		Restartable:       true,
+		Activation:        true,
+	}
+	for _, l := range b.Server.Listeners {
+		listener := server.Listener{Network: l.Network, Addr: l.Addr, Plaintext: l.Plaintext}
+		if l.TLS != nil {
+			tls := l.TLS.serverConfig()
+			listener.TLS = &tls
+		}
+		cfg.Listeners = append(cfg.Listeners, listener)
+	}
+	return cfg
+}
+
+// CORSConfig converts the CORS settings, reporting false when no origin is
+// allowed
+func (b Base) CORSConfig() (cors.Config, bool) {
+	return cors.Config{
+		AllowedOrigins: b.CORS.AllowedOrigins,
+		AllowedMethods: b.CORS.AllowedMethods,
+		AllowedHeaders: b.CORS.AllowedHeaders,
+		MaxAge:         b.CORS.MaxAge,
+	}, len(b.CORS.AllowedOrigins) > 0
+}
+
+func (t TLS) serverConfig() server.TLSConfig {
+	return server.TLSConfig{
+		CertFile:          t.CertFile,
+		KeyFile:           t.KeyFile,
+		AutocertHosts:     t.AutocertHosts,
+		AutocertCacheDir:  t.AutocertCacheDir,
+		ClientCAFile:      t.ClientCAFile,
+		RequireClientCert: t.RequireClientCert,
+	}
+}
+
+// OIDCConfig converts the OIDC settings, reporting false when no issuer is
+// configured
+func (b Base) OIDCConfig() (auth.OIDCConfig, bool) {
+	return auth.OIDCConfig{
+		Issuer:      b.Auth.OIDCIssuer,
+		Audience:    b.Auth.OIDCAudience,
+		JWKSURL:     b.Auth.OIDCJWKSURL,
+		ScopeMap:    auth.ParseScopeMap(b.Auth.OIDCScopeMap),
+		TenantClaim: b.Auth.OIDCTenantClaim,
+		Leeway:      b.Auth.OIDCLeeway,
+	}, b.Auth.OIDCIssuer != ""
+}
+
+// CacheConfig converts the cache settings, namespacing keys with prefix
+func (b Base) CacheConfig(prefix string) cache.Config {
+	return cache.Config{
+		Backend:    b.Cache.Backend,
+		RedisURL:   b.Cache.RedisURL,
+		MaxEntries: b.Cache.MaxEntries,
+		Prefix:     prefix,
+	}
+}
+
+// RateLimitConfigs converts the rate limit settings of the service's route
+// groups, keying clients behind the trusted proxies by their forwarded
+// address. Limits set for other groups than these are an error.
+func (b Base) RateLimitConfigs(groups ...string) (map[string]ratelimit.Config, error) {
+	for name := range b.RateLimit.Groups {
+		if !slices.Contains(groups, name) {
+			return nil, fmt.Errorf("config: rate limits for unknown route group %q, the groups are %s",
+				name, strings.Join(groups, ", "))
+		}
+	}
+	proxies, err := ratelimit.ParseProxies(b.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string]ratelimit.Config, len(groups))
+	for _, group := range groups {
+		l := b.GroupLimits(group)
+		configs[group] = ratelimit.Config{Rate: l.Rate, Burst: l.Burst, TrustedProxies: proxies}
+	}
+	return configs, nil
+}
+
+// GroupLimits returns the rate limits of a route group
+func (b Base) GroupLimits(group string) ratelimit.Limits {
+	return b.RateLimit.Groups[group].or(ratelimit.Limits{Rate: b.RateLimit.Rate, Burst: b.RateLimit.Burst})
+}
+
+// TenantLimits returns the rate limits of the tenants that override them in
+// a route group. Groups with limits of their own have no overrides.
+func (b Base) TenantLimits(group string) map[string]ratelimit.Limits {
+	limits := make(map[string]ratelimit.Limits)
+	if _, ok := b.RateLimit.Groups[group]; ok {
+		return limits
+	}
+	for name, t := range b.Tenants {
+		if t.RateLimit == (RateLimits{}) {
+			continue
+		}
+		limits[name] = t.RateLimit.or(b.GroupLimits(group))
+	}
+	return limits
+}
+
+// or fills the zero values of l from defaults
+func (l RateLimits) or(defaults ratelimit.Limits) ratelimit.Limits {
+	if l.Rate != 0 {
+		defaults.Rate = l.Rate
+	}
+	if l.Burst != 0 {
+		defaults.Burst = l.Burst
+	}
+	return defaults
+}
+
+// Quotas converts the default quota and the tenants' quota overrides
+func (b Base) Quotas() (metering.Quota, map[string]metering.Quota) {
+	tenants := make(map[string]metering.Quota)
+	for name, t := range b.Tenants {
+		if t.Quota != nil {
+			tenants[name] = metering.Quota(*t.Quota)
+		}
+	}
+	return metering.Quota(b.Quota), tenants
+}
+
+// ShedLimits converts the load shedding settings of the cheap validation
+// routes and of the expensive batch and report routes
+func (b Base) ShedLimits() (cheap, expensive loadshed.Limits) {
+	cheap = loadshed.Limits{MaxInFlight: b.LoadShed.MaxInFlight, MaxWait: b.LoadShed.MaxWait}
+	expensive = loadshed.Limits{MaxInFlight: b.LoadShed.MaxInFlightBatch, MaxWait: b.LoadShed.MaxWait}
+	return cheap, expensive
+}
+
+// AccessLogRotation converts the access log rotation settings
+func (b Base) AccessLogRotation() logging.RotateOptions {
+	return logging.RotateOptions{
+		MaxSize:    int64(b.AccessLog.MaxSizeMB) << 20,
+		Every:      b.AccessLog.RotateEvery,
+		MaxBackups: b.AccessLog.MaxBackups,
+		Compress:   b.AccessLog.Compress,
+	}
+}
+
+// ChaosConfig converts the fault injection settings
+func (b Base) ChaosConfig() chaos.Config {
+	return chaos.Config{
+		Latency:        b.Chaos.Latency,
+		LatencyPercent: b.Chaos.LatencyPercent,
+		ErrorPercent:   b.Chaos.ErrorPercent,
+		DropPercent:    b.Chaos.DropPercent,
+	}
+}
+
+// MirrorOptions converts the traffic mirroring settings. Services add their
+// own Sanitize.
+func (b Base) MirrorOptions() mirror.Options {
+	opts := mirror.Options{Target: b.Mirror.URL, Sample: b.Mirror.Sample}
+	if b.Mirror.APIKey != "" {
+		opts.Header = http.Header{auth.APIKeyHeader: {b.Mirror.APIKey}}
+	}
+	return opts
+}
+
+// WebhookOptions converts the webhook settings, reporting false when no
+// secret is configured
+func (b Base) WebhookOptions() (webhook.Options, bool) {
+	return webhook.Options{Secret: b.Webhook.Secret, AllowPrivate: b.Webhook.AllowPrivate}, b.Webhook.Secret != ""
+}
+
+// StatsDConfig converts the StatsD push settings
+func (b Base) StatsDConfig() metrics.StatsDConfig {
+	return metrics.StatsDConfig(b.StatsD)
+}
+
+// JobOptions converts the job runner settings
+func (b Base) JobOptions() jobs.Options {
+	return jobs.Options{
+		Workers:     b.Jobs.Workers,
+		QueueSize:   b.Jobs.QueueSize,
+		MaxAttempts: b.Jobs.MaxAttempts,
+		Backoff:     b.Jobs.Backoff,
+		Lease:       b.Jobs.Lease,
+	}
+}
+
+// ScheduleOptions converts the scheduler settings
+func (b Base) ScheduleOptions() schedule.Options {
+	return schedule.Options{LeaseTTL: b.Scheduler.LeaseTTL}
+}
+
+// FeatureFlags merges Features and the tenants' features into Flags
+func (b Base) FeatureFlags() map[string]flags.Flag {
+	merged := make(map[string]flags.Flag, len(b.Flags)+len(b.Features))
+	for name, f := range b.Flags {
+		merged[name] = f
+	}
+	for _, name := range b.Features {
+		f := merged[name]
+		f.Enabled = true
+		merged[name] = f
+	}
+	for tenant, t := range b.Tenants {
+		for _, name := range t.Features {
+			f := merged[name]
+			f.Tenants = append(slices.Clip(f.Tenants), tenant)
+			merged[name] = f
+		}
+	}
+	return merged
+}
@@ -0,0 +1,188 @@
+// Package config loads service configuration from defaults, an optional YAML
+// file, environment variables and command-line flags, in that order of
+// increasing precedence.
+//
+// Configuration is a struct whose fields are tagged with where a value may
+// come from:
+//
+//	Listen string `yaml:"listen" env:"LISTEN_ADDR" flag:"listen" default:":8000" usage:"address to listen on"`
+//
+// Supported field types are strings, bools, ints, floats, time.Duration and
+// string slices, which are written comma separated in env vars and flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Defaulter is implemented by configurations that change the defaults of
+// the fields they embed, e.g. to give a service its own port
+type Defaulter interface {
+	Defaults()
+}
+
+// FileEnv names the environment variable pointing at the YAML config file.
+// The -config flag takes precedence over it.
+const FileEnv = "CONFIG_FILE"
+
+// Load fills cfg, a pointer to a struct, from its defaults, the YAML file
+// given by -config or CONFIG_FILE, the environment and the flags in args
+func Load(name string, args []string, cfg any) error {
+	root := reflect.ValueOf(cfg)
+	if root.Kind() != reflect.Pointer || root.Elem().Kind() != reflect.Struct {
+		return errors.New("config: Load needs a pointer to a struct")
+	}
+	fields := collect(root.Elem(), nil)
+
+	for _, f := range fields {
+		if def := f.tag.Get("default"); def != "" {
+			if err := set(f.value, def); err != nil {
+				return fmt.Errorf("config: default for %s: %w", f.name, err)
+			}
+		}
+	}
+	if d, ok := cfg.(Defaulter); ok {
+		d.Defaults()
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("config", os.Getenv(FileEnv), "path to a YAML config file")
+	flagValues := make(map[string]string)
+	for _, f := range fields {
+		fl := f.tag.Get("flag")
+		if fl == "" {
+			continue
+		}
+		usage := f.tag.Get("usage")
+		if env := f.tag.Get("env"); env != "" {
+			usage += " (env " + env + ")"
+		}
+		record := func(s string) error {
+			flagValues[fl] = s
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(fl, usage, record)
+		} else {
+			fs.Func(fl, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("config: parsing %s: %w", *file, err)
+		}
+	}
+
+	for _, f := range fields {
+		env := f.tag.Get("env")
+		if env == "" {
+			continue
+		}
+		if v, ok := os.LookupEnv(env); ok && v != "" {
+			if err := set(f.value, v); err != nil {
+				return fmt.Errorf("config: %s: %w", env, err)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if v, ok := flagValues[f.tag.Get("flag")]; ok {
+			if err := set(f.value, v); err != nil {
+				return fmt.Errorf("config: -%s: %w", f.tag.Get("flag"), err)
+			}
+		}
+	}
+	return nil
+}
+
+type field struct {
+	name  string
+	tag   reflect.StructTag
+	value reflect.Value
+}
+
+// collect lists the settable leaf fields of v, descending into nested structs
+func collect(v reflect.Value, path []string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		name := append(append([]string{}, path...), sf.Name)
+		if fv.Kind() == reflect.Struct {
+			fields = append(fields, collect(fv, name)...)
+			continue
+		}
+		fields = append(fields, field{strings.Join(name, "."), sf.Tag, fv})
+	}
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
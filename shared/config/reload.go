@@ -0,0 +1,90 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// Reloader loads the configuration again on SIGHUP or an admin request and
+// passes it to the parts of a service that can change while it runs, such as
+// the log level and rate limits. Settings like the listen address or the
+// database only take effect after a restart.
+type Reloader[T any] struct {
+	name string
+	args []string
+
+	mu        sync.Mutex
+	current   T
+	callbacks []func(T)
+}
+
+// NewReloader creates a Reloader for a configuration first loaded with
+// Load(name, args, &current)
+func NewReloader[T any](name string, args []string, current T) *Reloader[T] {
+	return &Reloader[T]{name: name, args: args, current: current}
+}
+
+// OnReload registers f to be called with every newly loaded configuration
+func (r *Reloader[T]) OnReload(f func(T)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.callbacks = append(r.callbacks, f)
+}
+
+// Current returns the configuration loaded last
+func (r *Reloader[T]) Current() T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload loads the configuration and applies it. When loading fails the
+// current configuration stays in place.
+func (r *Reloader[T]) Reload() error {
+	var cfg T
+	if err := Load(r.name, r.args, &cfg); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = cfg
+	for _, f := range r.callbacks {
+		f(cfg)
+	}
+	slog.Info("configuration reloaded")
+	return nil
+}
+
+// Watch reloads the configuration on every SIGHUP until ctx is done
+func (r *Reloader[T]) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := r.Reload(); err != nil {
+				slog.Error("reloading configuration", "error", err)
+			}
+		}
+	}
+}
+
+// Handler reloads the configuration, it is meant to be mounted on the admin
+// subrouter as POST /reload
+func (r *Reloader[T]) Handler(w http.ResponseWriter, req *http.Request) {
+	if err := r.Reload(); err != nil {
+		respond.Error(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	respond.JSON(w, http.StatusOK, map[string]bool{"reloaded": true})
+}
@@ -0,0 +1,109 @@
+// Package cors lets browser-based tools on other origins call the API
+// directly, answering CORS preflight requests and marking responses to
+// allowed origins as readable.
+package cors
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config says which origins may call the API and how
+type Config struct {
+	// AllowedOrigins are origins like https://tools.example.com. A * in
+	// place of the leftmost host label allows every subdomain, a lone *
+	// allows every origin. CORS is off without any.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers browsers may send
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight answer
+	MaxAge time.Duration
+}
+
+// Defaults for an empty Config, covering what the services' clients send
+// and the headers they're told about
+var (
+	DefaultMethods        = []string{http.MethodGet, http.MethodPost}
+	DefaultAllowedHeaders = []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID"}
+	DefaultExposedHeaders = []string{"X-Request-ID", "Retry-After", "X-Quota-Limit", "X-Quota-Remaining", "X-Quota-Reset", "X-Duplicate-Count", "Deprecation", "Sunset", "Link"}
+)
+
+// Middleware adds the CORS headers for requests from allowed origins and
+// answers their preflight requests itself. Preflights carry no credentials,
+// so it has to run before authentication, and the router has to route
+// OPTIONS requests for it to see them, see Preflight.
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	methods := strings.Join(orDefault(cfg.AllowedMethods, DefaultMethods), ", ")
+	headers := strings.Join(orDefault(cfg.AllowedHeaders, DefaultAllowedHeaders), ", ")
+	exposed := strings.Join(orDefault(cfg.ExposedHeaders, DefaultExposedHeaders), ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if !allowed(cfg.AllowedOrigins, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h.Set("Access-Control-Allow-Origin", origin)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", methods)
+				h.Set("Access-Control-Allow-Headers", headers)
+				if cfg.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.Set("Access-Control-Expose-Headers", exposed)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Preflight answers OPTIONS requests the middleware didn't, e.g. from
+// origins that aren't allowed. Routers register it for OPTIONS on every path
+// so preflights reach the middleware instead of a 405.
+func Preflight(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func orDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+// allowed reports whether origin matches one of patterns
+func allowed(patterns []string, origin string) bool {
+	return slices.ContainsFunc(patterns, func(p string) bool {
+		if p == "*" || strings.EqualFold(p, origin) {
+			return true
+		}
+		// https://*.example.com allows https://a.example.com
+		scheme, host, ok := strings.Cut(p, "://*.")
+		if !ok {
+			return false
+		}
+		prefix, rest, ok := strings.Cut(origin, "://")
+		if !ok || !strings.EqualFold(prefix, scheme) {
+			return false
+		}
+		label, domain, ok := strings.Cut(rest, ".")
+		return ok && label != "" && strings.EqualFold(domain, host)
+	})
+}
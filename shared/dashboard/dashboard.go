@@ -0,0 +1,312 @@
+// Package dashboard serves a server-side rendered admin dashboard with live
+// traffic, error rates, running jobs and service specific details. The
+// templates are embedded in the binary.
+package dashboard
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/jobs"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+//go:embed templates/*.html
+var templates embed.FS
+
+var page = template.Must(template.New("dashboard.html").Funcs(template.FuncMap{
+	"percent":   func(f float64) string { return strconv.FormatFloat(f*100, 'f', 1, 64) + "%" },
+	"rate":      func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) },
+	"sparkline": sparkline,
+}).ParseFS(templates, "templates/*.html"))
+
+const (
+	// sampleEvery is how often traffic is sampled for the charts
+	sampleEvery = 5 * time.Second
+	// keepSamples covers the last 15 minutes
+	keepSamples = 180
+)
+
+// sample is a reading of the request counters
+type sample struct {
+	at           time.Time
+	requests     float64
+	clientErrors float64
+	serverErrors float64
+}
+
+// Dashboard renders the admin dashboard of one service
+type Dashboard struct {
+	service  string
+	gatherer prometheus.Gatherer
+	jobs     jobs.Store
+	started  time.Time
+
+	mu      sync.Mutex
+	info    []infoItem
+	links   []link
+	samples []sample
+}
+
+type infoItem struct {
+	name  string
+	value func() string
+}
+
+type link struct {
+	Name string
+	URL  string
+}
+
+// New creates the dashboard of service, reading traffic from the metrics in
+// gatherer and batch jobs from jobStore
+func New(service string, gatherer prometheus.Gatherer, jobStore jobs.Store) *Dashboard {
+	return &Dashboard{service: service, gatherer: gatherer, jobs: jobStore, started: time.Now()}
+}
+
+// AddInfo shows name with the value returned by value, e.g. the version of a
+// dataset or algorithm the service uses
+func (d *Dashboard) AddInfo(name string, value func() string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.info = append(d.info, infoItem{name, value})
+}
+
+// AddLink adds a quick link, e.g. to an audit or usage query
+func (d *Dashboard) AddLink(name, url string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.links = append(d.links, link{name, url})
+}
+
+// Run samples the traffic for the charts until ctx is done
+func (d *Dashboard) Run(ctx context.Context) {
+	t := time.NewTicker(sampleEvery)
+	defer t.Stop()
+	d.sample()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			d.sample()
+		}
+	}
+}
+
+func (d *Dashboard) sample() {
+	routes, err := d.routes()
+	if err != nil {
+		slog.Warn("sampling dashboard traffic", "error", err)
+		return
+	}
+	s := sample{at: time.Now()}
+	for _, r := range routes {
+		s.requests += r.Requests
+		s.clientErrors += r.ClientErrors
+		s.serverErrors += r.ServerErrors
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.samples = append(d.samples, s)
+	if len(d.samples) > keepSamples {
+		d.samples = d.samples[len(d.samples)-keepSamples:]
+	}
+}
+
+// RouteStats are the request counts of one route since the service started
+type RouteStats struct {
+	Route        string
+	Method       string
+	Requests     float64
+	ClientErrors float64
+	ServerErrors float64
+}
+
+// ErrorRate is the share of requests that failed with a server error
+func (s RouteStats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.ServerErrors / s.Requests
+}
+
+// routes sums http_requests_total by route and method
+func (d *Dashboard) routes() ([]RouteStats, error) {
+	families, err := d.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	byRoute := make(map[string]*RouteStats)
+	for _, family := range families {
+		if family.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := labelMap(m)
+			key := labels["route"] + " " + labels["method"]
+			stats, ok := byRoute[key]
+			if !ok {
+				stats = &RouteStats{Route: labels["route"], Method: labels["method"]}
+				byRoute[key] = stats
+			}
+			n := m.GetCounter().GetValue()
+			stats.Requests += n
+			switch {
+			case strings.HasPrefix(labels["code"], "5"):
+				stats.ServerErrors += n
+			case strings.HasPrefix(labels["code"], "4"):
+				stats.ClientErrors += n
+			}
+		}
+	}
+	routes := make([]RouteStats, 0, len(byRoute))
+	for _, stats := range byRoute {
+		routes = append(routes, *stats)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Requests > routes[j].Requests })
+	return routes, nil
+}
+
+func labelMap(m *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	return labels
+}
+
+// traffic is the request rate and error rates over the sampled window
+type traffic struct {
+	Window         string
+	RequestsPerSec float64
+	ClientErrors   float64
+	ServerErrors   float64
+	// Rates holds the requests per second between consecutive samples
+	Rates []float64
+}
+
+func (d *Dashboard) traffic() traffic {
+	d.mu.Lock()
+	samples := append([]sample(nil), d.samples...)
+	d.mu.Unlock()
+	var t traffic
+	if len(samples) < 2 {
+		return t
+	}
+	for i := 1; i < len(samples); i++ {
+		t.Rates = append(t.Rates, (samples[i].requests-samples[i-1].requests)/samples[i].at.Sub(samples[i-1].at).Seconds())
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	window := last.at.Sub(first.at)
+	t.Window = window.Round(time.Second).String()
+	requests := last.requests - first.requests
+	t.RequestsPerSec = requests / window.Seconds()
+	if requests > 0 {
+		t.ClientErrors = (last.clientErrors - first.clientErrors) / requests
+		t.ServerErrors = (last.serverErrors - first.serverErrors) / requests
+	}
+	return t
+}
+
+type view struct {
+	Service   string
+	Now       time.Time
+	Uptime    string
+	Traffic   traffic
+	Routes    []RouteStats
+	Running   []jobs.Job
+	Queued    []jobs.Job
+	Failed    []jobs.Job
+	Info      []infoValue
+	Links     []link
+	Errors    []string
+	RefreshIn int
+}
+
+type infoValue struct {
+	Name  string
+	Value string
+}
+
+// ServeHTTP renders the dashboard. It refreshes itself every few seconds.
+// Tenant admins only see the jobs of their own tenant.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v := view{
+		Service:   d.service,
+		Now:       time.Now().UTC(),
+		Uptime:    time.Since(d.started).Round(time.Second).String(),
+		Traffic:   d.traffic(),
+		RefreshIn: int(sampleEvery.Seconds()),
+	}
+	var err error
+	if v.Routes, err = d.routes(); err != nil {
+		v.Errors = append(v.Errors, "reading metrics: "+err.Error())
+	}
+	if d.jobs != nil {
+		p, _ := auth.FromContext(r.Context())
+		lists := []struct {
+			status jobs.Status
+			into   *[]jobs.Job
+		}{{jobs.Running, &v.Running}, {jobs.Queued, &v.Queued}, {jobs.Failed, &v.Failed}}
+		for _, l := range lists {
+			found, err := d.jobs.List(r.Context(), jobs.Filter{
+				Status:     l.status,
+				Limit:      20,
+				Tenant:     p.Tenant,
+				AllTenants: p.Operator(),
+			})
+			if err != nil {
+				v.Errors = append(v.Errors, fmt.Sprintf("listing %s jobs: %v", l.status, err))
+			}
+			*l.into = found
+		}
+	}
+
+	d.mu.Lock()
+	for _, item := range d.info {
+		v.Info = append(v.Info, infoValue{item.name, item.value()})
+	}
+	v.Links = append(v.Links, d.links...)
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := page.Execute(w, v); err != nil {
+		slog.ErrorContext(r.Context(), "rendering dashboard", "error", err)
+	}
+}
+
+// sparkline draws values as the points of an SVG polyline 300 by 60 wide
+func sparkline(values []float64) string {
+	if len(values) < 2 {
+		return ""
+	}
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := float64(i) * 300 / float64(len(values)-1)
+		y := 58 - v/max*56
+		points[i] = strconv.FormatFloat(x, 'f', 1, 64) + "," + strconv.FormatFloat(y, 'f', 1, 64)
+	}
+	return strings.Join(points, " ")
+}
@@ -0,0 +1,122 @@
+// Package flags provides config-backed feature flags that can be rolled out
+// to a share of API keys or requests before they are switched on for
+// everyone.
+package flags
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/logging"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// Flag describes who a feature is switched on for
+type Flag struct {
+	// Enabled switches the feature on for everyone
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Percent switches the feature on for this share of callers, 0 to 100.
+	// Authenticated callers are bucketed by key so they see the same
+	// behaviour on every request, anonymous requests are bucketed one by
+	// one.
+	Percent int `yaml:"percent" json:"percent,omitempty"`
+	// Keys lists API key or token subject IDs the feature is always on for
+	Keys []string `yaml:"keys" json:"keys,omitempty"`
+	// Tenants lists tenants the feature is always on for
+	Tenants []string `yaml:"tenants" json:"tenants,omitempty"`
+}
+
+// Set holds the current flags and can be updated while the service runs
+type Set struct {
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// New creates a Set from flags
+func New(flags map[string]Flag) *Set {
+	s := &Set{}
+	s.Update(flags)
+	return s
+}
+
+// Update replaces all flags, e.g. after a configuration reload
+func (s *Set) Update(flags map[string]Flag) {
+	copied := make(map[string]Flag, len(flags))
+	for name, f := range flags {
+		copied[name] = f
+	}
+	s.mu.Lock()
+	s.flags = copied
+	s.mu.Unlock()
+}
+
+// Enabled reports whether the feature name is on for the request ctx belongs
+// to. Unknown flags are off.
+func (s *Set) Enabled(ctx context.Context, name string) bool {
+	s.mu.RLock()
+	f, ok := s.flags[name]
+	s.mu.RUnlock()
+	return ok && f.enabledFor(ctx, name)
+}
+
+// Switch serves requests with on when the feature name is on for them and
+// with off otherwise, e.g. to roll out a new response schema
+func (s *Set) Switch(name string, on, off http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Enabled(r.Context(), name) {
+			on.ServeHTTP(w, r)
+			return
+		}
+		off.ServeHTTP(w, r)
+	})
+}
+
+func (f Flag) enabledFor(ctx context.Context, name string) bool {
+	if f.Enabled || f.Percent >= 100 {
+		return true
+	}
+
+	unit := logging.RequestID(ctx)
+	if p, ok := auth.FromContext(ctx); ok {
+		if slices.Contains(f.Keys, p.ID) || (p.Tenant != "" && slices.Contains(f.Tenants, p.Tenant)) {
+			return true
+		}
+		unit = p.ID
+	}
+	if f.Percent <= 0 || unit == "" {
+		return false
+	}
+	return bucket(name, unit) < f.Percent
+}
+
+// bucket maps a flag and caller to 0-99. The flag name is part of the hash so
+// every flag picks a different share of callers.
+func bucket(name, unit string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(unit))
+	return int(h.Sum32() % 100)
+}
+
+// Handler lists the flags and whether each is on for the caller, it is meant
+// to be mounted on the admin subrouter as GET /flags
+func (s *Set) Handler(w http.ResponseWriter, r *http.Request) {
+	type flagState struct {
+		Flag
+		EnabledForCaller bool `json:"enabledForCaller"`
+	}
+	s.mu.RLock()
+	flags := s.flags
+	s.mu.RUnlock()
+
+	states := make(map[string]flagState, len(flags))
+	for name, f := range flags {
+		states[name] = flagState{f, f.enabledFor(r.Context(), name)}
+	}
+	respond.JSON(w, http.StatusOK, states)
+}
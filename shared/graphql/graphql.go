@@ -0,0 +1,471 @@
+// Package graphql serves read-only GraphQL APIs over a service's existing
+// logic, so clients can fetch several things in one request and pick the
+// fields they need. It executes queries with variables, aliases and
+// arguments; fragments, directives, mutations and introspection beyond
+// __typename aren't supported.
+//
+//	schema := graphql.NewSchema(&graphql.Object{
+//		Name: "Query",
+//		Fields: map[string]*graphql.Field{
+//			"greeting": {Type: "String", Args: map[string]string{"name": "String!"},
+//				Resolve: func(ctx context.Context, _ any, args map[string]any) (any, error) {
+//					return "hello " + args["name"].(string), nil
+//				}},
+//		},
+//	})
+//	r.Handle("/graphql", graphql.Handler(schema))
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Object is an object type and its fields
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+// Field is a field of an object
+type Field struct {
+	// Type is String, Int, Float, Boolean, ID or the name of an object, in
+	// brackets for a list, e.g. [Issuer]
+	Type string
+	// Args maps the field's arguments to their types, which end in ! when
+	// they're required. Resolve gets Int arguments as ints, Float ones as
+	// float64s and lists as []any.
+	Args map[string]string
+	// Resolve computes the field from the object it belongs to, source,
+	// which is nil for the fields of the query. Without Resolve the field
+	// is read from source: a map by key or a struct by its json tags.
+	Resolve func(ctx context.Context, source any, args map[string]any) (any, error)
+}
+
+// Schema is the query type and the object types reachable from it
+type Schema struct {
+	query   *Object
+	objects map[string]*Object
+}
+
+// NewSchema creates a schema answering queries with query. objects are the
+// types its fields return.
+func NewSchema(query *Object, objects ...*Object) *Schema {
+	s := &Schema{query: query, objects: map[string]*Object{query.Name: query}}
+	for _, o := range objects {
+		s.objects[o.Name] = o
+	}
+	return s
+}
+
+// Request is a GraphQL request as clients send it
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is the result of a request. Data is missing when the request
+// failed before it could be executed.
+type Response struct {
+	Data   any      `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// Path names the field the error happened in
+	Path []any `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Location is a place in a query
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// scalars are the built-in scalar types
+var scalars = map[string]bool{"String": true, "Int": true, "Float": true, "Boolean": true, "ID": true}
+
+// Execute runs the query of req against s
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	ops, err := parse(req.Query)
+	if err != nil {
+		return Response{Errors: []*Error{err.(*Error)}}
+	}
+	op, err := pickOperation(ops, req.OperationName)
+	if err != nil {
+		return Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+	vars, errs := coerceVariables(op.variables, req.Variables)
+	if errs != nil {
+		return Response{Errors: errs}
+	}
+	if errs := s.validate(s.query, op.selection, vars); errs != nil {
+		return Response{Errors: errs}
+	}
+	e := &executor{schema: s, vars: vars}
+	data := e.object(ctx, s.query, nil, op.selection, nil)
+	return Response{Data: data, Errors: e.errors}
+}
+
+func pickOperation(ops []operation, name string) (operation, error) {
+	if name == "" {
+		if len(ops) > 1 {
+			return operation{}, fmt.Errorf("the document has %d operations, name one with operationName", len(ops))
+		}
+		return ops[0], nil
+	}
+	for _, op := range ops {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return operation{}, fmt.Errorf("the document has no operation %q", name)
+}
+
+// coerceVariables checks the values sent for the variables of an operation
+// and fills in their defaults
+func coerceVariables(defs []variableDef, values map[string]any) (map[string]any, []*Error) {
+	vars := make(map[string]any, len(defs))
+	var errs []*Error
+	for _, def := range defs {
+		v, ok := values[def.name]
+		if !ok && def.hasValue {
+			v, ok = def.fallback, true
+		}
+		if err := checkValue(def.typ, v, ok); err != nil {
+			errs = append(errs, &Error{Message: fmt.Sprintf("variable $%s: %v", def.name, err)})
+			continue
+		}
+		if ok {
+			vars[def.name] = v
+		}
+	}
+	return vars, errs
+}
+
+// checkValue checks v fits typ. present tells a missing value from null.
+func checkValue(typ string, v any, present bool) error {
+	required := strings.HasSuffix(typ, "!")
+	typ = strings.TrimSuffix(typ, "!")
+	if !present || v == nil {
+		if required {
+			return fmt.Errorf("a %s is required", typ)
+		}
+		return nil
+	}
+	if strings.HasPrefix(typ, "[") {
+		list, ok := v.([]any)
+		if !ok {
+			// a single value stands for a list of one
+			return checkValue(typ[1:len(typ)-1], v, true)
+		}
+		for _, item := range list {
+			if err := checkValue(typ[1:len(typ)-1], item, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	ok := false
+	switch typ {
+	case "String":
+		_, ok = v.(string)
+	case "ID":
+		switch v.(type) {
+		case string, int, float64:
+			ok = true
+		}
+	case "Int":
+		switch n := v.(type) {
+		case int:
+			ok = true
+		case float64:
+			ok = n == float64(int32(n))
+		}
+	case "Float":
+		switch v.(type) {
+		case int, float64:
+			ok = true
+		}
+	case "Boolean":
+		_, ok = v.(bool)
+	default:
+		return fmt.Errorf("unknown input type %s", typ)
+	}
+	if !ok {
+		return fmt.Errorf("expected a %s, got %s", typ, describeValue(v))
+	}
+	return nil
+}
+
+// normalizeNumber makes Int arguments ints and Float arguments float64s
+// whether they were written in the query or sent as JSON variables
+func normalizeNumber(typ string, v any) any {
+	typ = strings.TrimSuffix(typ, "!")
+	switch n := v.(type) {
+	case float64:
+		if typ == "Int" {
+			return int(n)
+		}
+	case int:
+		if typ == "Float" {
+			return float64(n)
+		}
+	case []any:
+		if strings.HasPrefix(typ, "[") {
+			out := make([]any, len(n))
+			for i, item := range n {
+				out[i] = normalizeNumber(typ[1:len(typ)-1], item)
+			}
+			return out
+		}
+	}
+	return v
+}
+
+func describeValue(v any) string {
+	switch v := v.(type) {
+	case enum:
+		return string(v)
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// validate checks a selection against obj before anything is resolved
+func (s *Schema) validate(obj *Object, selection []field, vars map[string]any) []*Error {
+	var errs []*Error
+	fail := func(f field, format string, args ...any) {
+		errs = append(errs, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{{f.line, f.col}}})
+	}
+	for _, f := range selection {
+		if f.name == "__typename" {
+			if f.selection != nil {
+				fail(f, "__typename is a String and can't have a selection")
+			}
+			continue
+		}
+		def, ok := obj.Fields[f.name]
+		if !ok {
+			fail(f, "%s has no field %q", obj.Name, f.name)
+			continue
+		}
+		for _, arg := range f.args {
+			typ, ok := def.Args[arg.name]
+			if !ok {
+				fail(f, "%s.%s has no argument %q", obj.Name, f.name, arg.name)
+				continue
+			}
+			v, err := resolveVariables(arg.value, vars)
+			if err == nil {
+				err = checkValue(typ, v, true)
+			}
+			if err != nil {
+				fail(f, "argument %s of %s.%s: %v", arg.name, obj.Name, f.name, err)
+			}
+		}
+		for name, typ := range def.Args {
+			if strings.HasSuffix(typ, "!") && !hasArg(f.args, name) {
+				fail(f, "%s.%s needs the argument %s", obj.Name, f.name, name)
+			}
+		}
+		named := strings.Trim(def.Type, "[]!")
+		child, isObject := s.objects[named]
+		switch {
+		case !isObject && !scalars[named]:
+			fail(f, "%s.%s has the unknown type %s", obj.Name, f.name, named)
+		case isObject && f.selection == nil:
+			fail(f, "%s.%s is a %s, select its fields", obj.Name, f.name, named)
+		case !isObject && f.selection != nil:
+			fail(f, "%s.%s is a %s and can't have a selection", obj.Name, f.name, named)
+		case isObject:
+			errs = append(errs, s.validate(child, f.selection, vars)...)
+		}
+	}
+	return errs
+}
+
+func hasArg(args []argument, name string) bool {
+	for _, a := range args {
+		if a.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveVariables replaces the variables in an argument value with their
+// values
+func resolveVariables(v any, vars map[string]any) (any, error) {
+	switch v := v.(type) {
+	case variable:
+		value, ok := vars[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s isn't defined", v)
+		}
+		return value, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			var err error
+			if out[i], err = resolveVariables(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			var err error
+			if out[k], err = resolveVariables(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// executor resolves a validated query
+type executor struct {
+	schema *Schema
+	vars   map[string]any
+	errors []*Error
+}
+
+// object resolves selection on source, an obj. Failed fields are null and
+// their errors collected.
+func (e *executor) object(ctx context.Context, obj *Object, source any, selection []field, path []any) *orderedMap {
+	out := &orderedMap{}
+	var fields map[string]any
+	for _, f := range selection {
+		if f.name == "__typename" {
+			out.set(f.key(), obj.Name)
+			continue
+		}
+		def := obj.Fields[f.name]
+		fieldPath := append(append([]any(nil), path...), f.key())
+		var v any
+		var err error
+		if def.Resolve != nil {
+			args := make(map[string]any, len(f.args))
+			for _, a := range f.args {
+				// validation has checked the variables exist
+				v, _ := resolveVariables(a.value, e.vars)
+				args[a.name] = normalizeNumber(def.Args[a.name], v)
+			}
+			v, err = def.Resolve(ctx, source, args)
+		} else {
+			if fields == nil {
+				fields, err = asFields(source)
+			}
+			v = fields[f.name]
+		}
+		if err != nil {
+			e.errors = append(e.errors, &Error{Message: err.Error(), Locations: []Location{{f.line, f.col}}, Path: fieldPath})
+			out.set(f.key(), nil)
+			continue
+		}
+		out.set(f.key(), e.value(ctx, def.Type, v, f.selection, fieldPath))
+	}
+	return out
+}
+
+// value completes the resolved value v of a field of type typ
+func (e *executor) value(ctx context.Context, typ string, v any, selection []field, path []any) any {
+	typ = strings.TrimSuffix(typ, "!")
+	if isNil(v) {
+		return nil
+	}
+	if strings.HasPrefix(typ, "[") {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			e.errors = append(e.errors, &Error{Message: "expected a list", Path: path})
+			return nil
+		}
+		list := make([]any, rv.Len())
+		for i := range list {
+			list[i] = e.value(ctx, typ[1:len(typ)-1], rv.Index(i).Interface(), selection, append(append([]any(nil), path...), i))
+		}
+		return list
+	}
+	if obj, ok := e.schema.objects[typ]; ok {
+		return e.object(ctx, obj, v, selection, path)
+	}
+	return v
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// asFields reads the fields of source by their JSON names
+func asFields(source any) (map[string]any, error) {
+	if m, ok := source.(map[string]any); ok {
+		return m, nil
+	}
+	b, err := json.Marshal(source)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var m map[string]any
+	err = dec.Decode(&m)
+	return m, err
+}
+
+// orderedMap is a JSON object that keeps the order of the query's fields
+type orderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func (m *orderedMap) set(key string, v any) {
+	if m.values == nil {
+		m.values = make(map[string]any)
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteByte(':')
+		v, err := json.Marshal(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,55 @@
+package graphql
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// maxQueryBytes bounds the size of request bodies
+const maxQueryBytes = 1 << 20
+
+// Handler serves s over HTTP. Queries come as a JSON body with query,
+// operationName and variables, as an application/graphql body holding the
+// query, or in the query string of a GET. Answers are 200 with the errors
+// in the body, like GraphQL clients expect, unless the request itself is
+// malformed.
+func Handler(s *Schema) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := readRequest(r)
+		if err != nil {
+			respond.JSON(w, http.StatusBadRequest, Response{Errors: []*Error{{Message: err.Error()}}})
+			return
+		}
+		if req.Query == "" {
+			respond.JSON(w, http.StatusBadRequest, Response{Errors: []*Error{{Message: "a query is required"}}})
+			return
+		}
+		respond.JSON(w, http.StatusOK, s.Execute(r.Context(), req))
+	})
+}
+
+func readRequest(r *http.Request) (Request, error) {
+	var req Request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return req, err
+			}
+		}
+		return req, nil
+	}
+	body := http.MaxBytesReader(nil, r.Body, maxQueryBytes)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/graphql" {
+		b, err := io.ReadAll(body)
+		req.Query = string(b)
+		return req, err
+	}
+	err := json.NewDecoder(body).Decode(&req)
+	return req, err
+}
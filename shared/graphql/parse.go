@@ -0,0 +1,546 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// operation is a query of a document
+type operation struct {
+	name      string
+	variables []variableDef
+	selection []field
+}
+
+type variableDef struct {
+	name     string
+	typ      string
+	fallback any
+	hasValue bool
+}
+
+// field is a selected field with its arguments and sub-selection
+type field struct {
+	alias     string
+	name      string
+	args      []argument
+	selection []field
+	line, col int
+}
+
+// key is the name the field is answered under
+func (f field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type argument struct {
+	name  string
+	value any
+}
+
+// variable is an argument value naming a variable
+type variable string
+
+// enum is an unquoted argument value
+type enum string
+
+// tokKind is the kind of a lexical token
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind      tokKind
+	text      string
+	line, col int
+}
+
+// parser reads the executable subset of GraphQL: queries with variables,
+// aliases and arguments. Fragments, directives, mutations and subscriptions
+// are rejected.
+type parser struct {
+	src       string
+	pos       int
+	line, col int
+	tok       token
+}
+
+// parse reads a document into its operations
+func parse(src string) ([]operation, error) {
+	p := &parser{src: src, line: 1, col: 1}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var ops []operation
+	for p.tok.kind != tokEOF {
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return nil, p.errorf("the document has no operations")
+	}
+	return ops, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{{p.tok.line, p.tok.col}}}
+}
+
+func (p *parser) is(kind tokKind, text string) bool {
+	return p.tok.kind == kind && p.tok.text == text
+}
+
+// expect consumes the punctuator text
+func (p *parser) expect(text string) error {
+	if !p.is(tokPunct, text) {
+		return p.errorf("expected %q, found %s", text, p.describe())
+	}
+	return p.next()
+}
+
+func (p *parser) describe() string {
+	if p.tok.kind == tokEOF {
+		return "the end of the document"
+	}
+	return strconv.Quote(p.tok.text)
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.errorf("expected a name, found %s", p.describe())
+	}
+	name := p.tok.text
+	return name, p.next()
+}
+
+func (p *parser) operation() (operation, error) {
+	var op operation
+	if p.is(tokPunct, "{") {
+		sel, err := p.selectionSet()
+		op.selection = sel
+		return op, err
+	}
+	if p.tok.kind != tokName {
+		return op, p.errorf("expected an operation, found %s", p.describe())
+	}
+	switch p.tok.text {
+	case "query":
+	case "mutation", "subscription":
+		return op, p.errorf("%ss aren't supported, only queries", p.tok.text)
+	case "fragment":
+		return op, p.errorf("fragments aren't supported")
+	default:
+		return op, p.errorf("expected an operation, found %s", p.describe())
+	}
+	if err := p.next(); err != nil {
+		return op, err
+	}
+	if p.tok.kind == tokName {
+		op.name = p.tok.text
+		if err := p.next(); err != nil {
+			return op, err
+		}
+	}
+	if p.is(tokPunct, "(") {
+		vars, err := p.variableDefs()
+		if err != nil {
+			return op, err
+		}
+		op.variables = vars
+	}
+	if p.is(tokPunct, "@") {
+		return op, p.errorf("directives aren't supported")
+	}
+	sel, err := p.selectionSet()
+	op.selection = sel
+	return op, err
+}
+
+func (p *parser) variableDefs() ([]variableDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var defs []variableDef
+	for !p.is(tokPunct, ")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		def := variableDef{name: name, typ: typ}
+		if p.is(tokPunct, "=") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if def.fallback, err = p.value(true); err != nil {
+				return nil, err
+			}
+			def.hasValue = true
+		}
+		defs = append(defs, def)
+	}
+	return defs, p.next()
+}
+
+// typeRef reads a type like String!, [Int] or [String!]!
+func (p *parser) typeRef() (string, error) {
+	var typ string
+	if p.is(tokPunct, "[") {
+		if err := p.next(); err != nil {
+			return "", err
+		}
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.is(tokPunct, "!") {
+		typ += "!"
+		return typ, p.next()
+	}
+	return typ, nil
+}
+
+func (p *parser) selectionSet() ([]field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []field
+	for !p.is(tokPunct, "}") {
+		if p.is(tokPunct, "...") {
+			return nil, p.errorf("fragments aren't supported")
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, p.errorf("selections can't be empty")
+	}
+	return fields, p.next()
+}
+
+func (p *parser) field() (field, error) {
+	f := field{line: p.tok.line, col: p.tok.col}
+	name, err := p.name()
+	if err != nil {
+		return f, err
+	}
+	f.name = name
+	if p.is(tokPunct, ":") {
+		if err := p.next(); err != nil {
+			return f, err
+		}
+		if f.name, err = p.name(); err != nil {
+			return f, err
+		}
+		f.alias = name
+	}
+	if p.is(tokPunct, "(") {
+		if err := p.next(); err != nil {
+			return f, err
+		}
+		for !p.is(tokPunct, ")") {
+			arg, err := p.name()
+			if err != nil {
+				return f, err
+			}
+			if err := p.expect(":"); err != nil {
+				return f, err
+			}
+			v, err := p.value(false)
+			if err != nil {
+				return f, err
+			}
+			f.args = append(f.args, argument{arg, v})
+		}
+		if err := p.next(); err != nil {
+			return f, err
+		}
+	}
+	if p.is(tokPunct, "@") {
+		return f, p.errorf("directives aren't supported")
+	}
+	if p.is(tokPunct, "{") {
+		if f.selection, err = p.selectionSet(); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// value reads an argument value, which may only be a variable when it
+// isn't constant
+func (p *parser) value(constant bool) (any, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokPunct && tok.text == "$" && !constant:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return variable(name), err
+	case tok.kind == tokPunct && tok.text == "[":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !p.is(tokPunct, "]") {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.next()
+	case tok.kind == tokPunct && tok.text == "{":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		obj := map[string]any{}
+		for !p.is(tokPunct, "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.next()
+	case tok.kind == tokString:
+		return tok.text, p.next()
+	case tok.kind == tokInt:
+		n, err := strconv.ParseInt(tok.text, 10, 32)
+		if err != nil {
+			return nil, p.errorf("%s doesn't fit a 32-bit integer", tok.text)
+		}
+		return int(n), p.next()
+	case tok.kind == tokFloat:
+		f, _ := strconv.ParseFloat(tok.text, 64)
+		return f, p.next()
+	case tok.kind == tokName:
+		var v any
+		switch tok.text {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = enum(tok.text)
+		}
+		return v, p.next()
+	}
+	return nil, p.errorf("expected a value, found %s", p.describe())
+}
+
+// next reads the following token into p.tok
+func (p *parser) next() error {
+	p.skipIgnored()
+	p.tok = token{line: p.line, col: p.col}
+	if p.pos >= len(p.src) {
+		p.tok.kind = tokEOF
+		return nil
+	}
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.tok.kind, p.tok.text = tokPunct, "..."
+		p.advance(3)
+	case strings.IndexByte("!$()[]{}:=@|&", c) >= 0:
+		p.tok.kind, p.tok.text = tokPunct, string(c)
+		p.advance(1)
+	case c == '_' || isLetter(c):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.advance(1)
+		}
+		p.tok.kind, p.tok.text = tokName, p.src[start:p.pos]
+	case c == '-' || isDigit(c):
+		return p.number()
+	case c == '"':
+		return p.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		return &Error{Message: fmt.Sprintf("unexpected character %q", r), Locations: []Location{{p.line, p.col}}}
+	}
+	return nil
+}
+
+// skipIgnored skips white space, commas and comments
+func (p *parser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.advance(1)
+			}
+		case c == ' ' || c == '\t' || c == ',' || c == '\n' || c == '\r':
+			p.advance(1)
+		case strings.HasPrefix(p.src[p.pos:], "\uFEFF"):
+			// a byte order mark
+			p.pos += len("\uFEFF")
+		default:
+			return
+		}
+	}
+}
+
+// advance moves n bytes forward, keeping track of lines and columns
+func (p *parser) advance(n int) {
+	for i := 0; i < n && p.pos < len(p.src); i++ {
+		if p.src[p.pos] == '\n' {
+			p.line, p.col = p.line+1, 1
+		} else {
+			p.col++
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) number() error {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.advance(1)
+	}
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.advance(1)
+			n++
+		}
+		return n
+	}
+	if digits() == 0 {
+		return &Error{Message: "expected a digit", Locations: []Location{{p.line, p.col}}}
+	}
+	p.tok.kind = tokInt
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.advance(1)
+		if digits() == 0 {
+			return &Error{Message: "expected a digit after the decimal point", Locations: []Location{{p.line, p.col}}}
+		}
+		p.tok.kind = tokFloat
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.advance(1)
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.advance(1)
+		}
+		if digits() == 0 {
+			return &Error{Message: "expected a digit in the exponent", Locations: []Location{{p.line, p.col}}}
+		}
+		p.tok.kind = tokFloat
+	}
+	p.tok.text = p.src[start:p.pos]
+	return nil
+}
+
+// string reads a quoted string. Block strings are read verbatim, without
+// the indentation handling of the spec.
+func (p *parser) string() error {
+	p.tok.kind = tokString
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			return &Error{Message: "unterminated block string", Locations: []Location{{p.tok.line, p.tok.col}}}
+		}
+		p.tok.text = strings.ReplaceAll(p.src[p.pos+3:p.pos+3+end], `\"""`, `"""`)
+		p.advance(end + 6)
+		return nil
+	}
+	p.advance(1)
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			return &Error{Message: "unterminated string", Locations: []Location{{p.tok.line, p.tok.col}}}
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.advance(1)
+			p.tok.text = b.String()
+			return nil
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				return &Error{Message: "unterminated string", Locations: []Location{{p.tok.line, p.tok.col}}}
+			}
+			esc := p.src[p.pos+1]
+			p.advance(2)
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					return &Error{Message: "bad unicode escape", Locations: []Location{{p.line, p.col}}}
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return &Error{Message: "bad unicode escape", Locations: []Location{{p.line, p.col}}}
+				}
+				b.WriteRune(rune(r))
+				p.advance(4)
+			default:
+				return &Error{Message: fmt.Sprintf("bad escape \\%c", esc), Locations: []Location{{p.line, p.col}}}
+			}
+		default:
+			b.WriteByte(c)
+			p.advance(1)
+		}
+	}
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
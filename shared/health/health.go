@@ -0,0 +1,126 @@
+// Package health serves liveness and readiness endpoints that report the
+// status of a service's dependencies.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// CheckTimeout bounds how long a single dependency check may take
+const CheckTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Report is the body returned by the health endpoints
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// Checker holds the dependency checks of a service
+type Checker struct {
+	mu       sync.RWMutex
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+// New creates a Checker with no checks
+func New() *Checker {
+	return &Checker{checks: make(map[string]Check)}
+}
+
+// Add registers a dependency check that must pass for the service to be ready
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Drain marks the service as not ready so load balancers stop sending it
+// traffic while it shuts down
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Run executes every check concurrently and returns the combined report
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		c.mu.RLock()
+		check := c.checks[name]
+		c.mu.RUnlock()
+
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+			defer cancel()
+			start := time.Now()
+			err := check(ctx)
+			results[i] = CheckResult{Status: statusOK, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				results[i].Status = statusUnavailable
+				results[i].Error = err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: statusOK, Checks: make(map[string]CheckResult, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != statusOK {
+			report.Status = statusUnavailable
+		}
+	}
+	return report
+}
+
+// Liveness answers 200 as long as the process can serve requests at all
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, Report{Status: statusOK})
+}
+
+// Readiness runs the dependency checks and answers 503 if any fail or the
+// service is draining
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	if c.draining.Load() {
+		report.Status = statusUnavailable
+		report.Checks["shutdown"] = CheckResult{Status: statusUnavailable, Error: "server is shutting down"}
+	}
+	status := http.StatusOK
+	if report.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	respond.JSON(w, status, report)
+}
@@ -0,0 +1,222 @@
+// Package httpclient builds the outbound HTTP client integrations use instead
+// of http.DefaultClient: bounded timeouts, pooled connections with a per-host
+// limit and retries with exponential backoff and jitter.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/breaker"
+	"github.com/ixmorrow/go-projects/shared/logging"
+)
+
+// Options configures a client. Zero values take the defaults.
+type Options struct {
+	// Timeout bounds a whole request including retries, defaults to 30s
+	Timeout time.Duration
+	// DialTimeout bounds connecting, defaults to 5s
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout bounds waiting for the response headers of one
+	// attempt, defaults to 10s
+	ResponseHeaderTimeout time.Duration
+	// MaxConnsPerHost caps the connections to one host, defaults to 32
+	MaxConnsPerHost int
+	// MaxIdleConnsPerHost is how many connections are kept for reuse per
+	// host, defaults to 8
+	MaxIdleConnsPerHost int
+	// Retries is how many times a failed request is retried, defaults to 2,
+	// negative disables retries
+	Retries int
+	// Backoff is the delay before the first retry, doubled for every
+	// further retry, defaults to 100ms
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries, defaults to 2s
+	MaxBackoff time.Duration
+	// Breaker, when set, fails requests fast while the dependency is down.
+	// Requests rejected by it are not retried.
+	Breaker *breaker.Breaker
+	// DenyPrivate refuses to connect to loopback, private and link-local
+	// addresses, for requests to URLs callers choose
+	DenyPrivate bool
+}
+
+// ErrPrivateAddress is returned when DenyPrivate stops a connection
+var ErrPrivateAddress = errors.New("httpclient: connecting to a private address is not allowed")
+
+func (o *Options) defaults() {
+	if o.Timeout == 0 {
+		o.Timeout = 30 * time.Second
+	}
+	if o.DialTimeout == 0 {
+		o.DialTimeout = 5 * time.Second
+	}
+	if o.ResponseHeaderTimeout == 0 {
+		o.ResponseHeaderTimeout = 10 * time.Second
+	}
+	if o.MaxConnsPerHost == 0 {
+		o.MaxConnsPerHost = 32
+	}
+	if o.MaxIdleConnsPerHost == 0 {
+		o.MaxIdleConnsPerHost = 8
+	}
+	if o.Retries == 0 {
+		o.Retries = 2
+	}
+	if o.Backoff == 0 {
+		o.Backoff = 100 * time.Millisecond
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = 2 * time.Second
+	}
+}
+
+// New creates a client configured by opts
+func New(opts Options) *http.Client {
+	opts.defaults()
+	dialer := &net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}
+	if opts.DenyPrivate {
+		// checked on the resolved address, so DNS names pointing inside
+		// are caught too
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || Private(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	var rt http.RoundTripper = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   opts.DialTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if opts.Breaker != nil {
+		rt = opts.Breaker.Transport(rt)
+	}
+	rt = requestID{base: rt}
+	if opts.Retries > 0 {
+		rt = &retrier{base: rt, opts: opts}
+	}
+	return &http.Client{Timeout: opts.Timeout, Transport: rt}
+}
+
+// Private reports whether ip is a loopback, private, link-local or
+// unspecified address
+func Private(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// requestID passes the ID of the request being served on to the requests
+// made for it, so their logs can be correlated
+type requestID struct {
+	base http.RoundTripper
+}
+
+func (t requestID) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := logging.RequestID(req.Context()); id != "" && req.Header.Get(logging.RequestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// retrier retries requests that failed in a way worth trying again
+type retrier struct {
+	base http.RoundTripper
+	opts Options
+}
+
+func (t *retrier) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt == t.opts.Retries || !retryable(req, resp, err) {
+			return resp, err
+		}
+		wait := t.backoff(attempt, resp)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		if req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryable reports whether the request can and should be tried again.
+// Only idempotent requests are, and only after connection errors or
+// responses saying the server is temporarily unable to answer.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		if req.Header.Get("Idempotency-Key") == "" {
+			return false
+		}
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, breaker.ErrOpen) && req.Context().Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff doubles the delay with every attempt and picks a random point up
+// to it, so clients that failed together don't retry together. A
+// Retry-After from the server takes precedence when it is within MaxBackoff.
+func (t *retrier) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			if d := time.Duration(secs) * time.Second; d <= t.opts.MaxBackoff {
+				return d
+			}
+		}
+	}
+	d := t.opts.Backoff << attempt
+	if d <= 0 || d > t.opts.MaxBackoff {
+		d = t.opts.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// RegisterRoutes adds the job status API to r:
+//
+//	GET /jobs       list jobs, filtered by ?type=, ?status= and ?limit=
+//	GET /jobs/{id}  get one job with its result
+//
+// Callers only see jobs of their own tenant. Payloads are left out: they're
+// the caller's own input and may hold data that shouldn't be echoed, like
+// card numbers.
+func RegisterRoutes(r *mux.Router, store Store) {
+	r.HandleFunc("/jobs", listJobs(store)).Methods("GET")
+	r.HandleFunc("/jobs/{id}", getJob(store)).Methods("GET")
+}
+
+func listJobs(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		p, _ := auth.FromContext(r.Context())
+		f := Filter{
+			Type:       q.Get("type"),
+			Status:     Status(q.Get("status")),
+			Limit:      100,
+			Tenant:     p.Tenant,
+			AllTenants: p.Operator(),
+		}
+		if limit := q.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n <= 0 {
+				respond.Error(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			f.Limit = n
+		}
+		jobs, err := store.List(r.Context(), f)
+		if err != nil {
+			respond.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for i := range jobs {
+			// results can be large, fetch them per job
+			jobs[i].Payload, jobs[i].Result = nil, nil
+		}
+		respond.JSON(w, http.StatusOK, jobs)
+	}
+}
+
+func getJob(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, err := store.Get(r.Context(), mux.Vars(r)["id"])
+		if p, _ := auth.FromContext(r.Context()); err == nil && !p.CanAccess(job.Tenant) {
+			// don't tell other tenants the job exists
+			err = ErrNotFound
+		}
+		if errors.Is(err, ErrNotFound) {
+			respond.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			respond.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		job.Payload = nil
+		respond.JSON(w, http.StatusOK, job)
+	}
+}
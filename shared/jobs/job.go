@@ -0,0 +1,93 @@
+// Package jobs runs background work such as batch validations, data
+// refreshes and imports on a bounded worker pool, retrying failures with
+// backoff and persisting job state so it survives restarts.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	Queued    Status = "queued"
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+)
+
+// Done reports whether the job has finished, successfully or not
+func (s Status) Done() bool {
+	return s == Succeeded || s == Failed
+}
+
+// ErrNotFound is returned when a job doesn't exist
+var ErrNotFound = errors.New("job not found")
+
+// Job is a unit of background work
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Tenant      string          `json:"tenant,omitempty"`
+	Status      Status          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	RunAt       time.Time       `json:"runAt"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	// Owner is the runner running the job, which holds it until LeaseUntil
+	// unless it renews the lease, so runners sharing a store never run a
+	// job at once and the jobs of runners that died are run again
+	Owner      string    `json:"-"`
+	LeaseUntil time.Time `json:"-"`
+}
+
+// Handler does the work of one job type. The returned result is stored as
+// JSON on the job. Returning an error retries the job until it runs out of
+// attempts.
+type Handler func(ctx context.Context, job Job) (any, error)
+
+// Filter narrows a job listing
+type Filter struct {
+	Type   string
+	Status Status
+	Limit  int
+	// Tenant limits the listing to one tenant's jobs unless AllTenants is
+	// set
+	Tenant     string
+	AllTenants bool
+}
+
+func (f Filter) match(job Job) bool {
+	return (f.Type == "" || job.Type == f.Type) &&
+		(f.Status == "" || job.Status == f.Status) &&
+		(f.AllTenants || job.Tenant == f.Tenant)
+}
+
+// Store persists jobs
+type Store interface {
+	Save(ctx context.Context, job Job) error
+	Get(ctx context.Context, id string) (Job, error)
+	List(ctx context.Context, f Filter) ([]Job, error)
+	// Unfinished returns queued and running jobs, for recovery on startup
+	Unfinished(ctx context.Context) ([]Job, error)
+	// Claim marks the queued job id as running for owner, holding it until
+	// until, and counts the attempt. It returns ErrNotFound when there's no
+	// queued job id, e.g. because another runner claimed it first.
+	Claim(ctx context.Context, id, owner string, until time.Time) (Job, error)
+	// Renew extends owner's lease on the running job id to until
+	Renew(ctx context.Context, id, owner string, until time.Time) error
+	// Expire queues the running jobs whose lease ran out before now again,
+	// not counting the attempt their owner didn't finish, and returns them
+	Expire(ctx context.Context, now time.Time) ([]Job, error)
+	// Prune deletes finished jobs last updated before before and returns
+	// how many it deleted
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,2 @@
+ALTER TABLE jobs ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS jobs_tenant ON jobs (tenant, created_at);
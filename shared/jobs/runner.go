@@ -0,0 +1,392 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/auth"
+)
+
+// ErrQueueFull is returned by Enqueue when the queue has no room left
+var ErrQueueFull = errors.New("job queue is full")
+
+// Options configures a Runner
+type Options struct {
+	// Workers is how many jobs run at once, defaults to 4
+	Workers int
+	// QueueSize bounds the number of jobs waiting to run, defaults to 1000
+	QueueSize int
+	// MaxAttempts is how often a failing job is tried, defaults to 3
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each
+	// following one, defaults to one second
+	Backoff time.Duration
+	// Lease is how long a runner holds a job it runs without renewing it.
+	// Jobs of runners that died are run again once their lease runs out.
+	// Defaults to a minute.
+	Lease time.Duration
+}
+
+// Runner executes jobs on a pool of workers
+type Runner struct {
+	store    Store
+	opts     Options
+	handlers map[string]Handler
+	onFinish func(Job)
+	// owner tells this runner's leases from those of other processes
+	// sharing the store
+	owner string
+
+	queue chan string
+	// overflow holds the IDs of due jobs that didn't fit the queue, in the
+	// order they came due. Workers move them over as the queue empties.
+	overflow []string
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	timers   map[string]*time.Timer
+	stopped  bool
+}
+
+// NewRunner creates a Runner persisting jobs in store
+func NewRunner(store Store, opts Options) *Runner {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		store:    store,
+		opts:     opts,
+		handlers: make(map[string]Handler),
+		owner:    newID(),
+		queue:    make(chan string, opts.QueueSize),
+		stop:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		timers:   make(map[string]*time.Timer),
+	}
+}
+
+// Register sets the handler for jobs of type typ. Call it before Start.
+func (r *Runner) Register(typ string, h Handler) {
+	r.handlers[typ] = h
+}
+
+// OnFinish sets fn to be called with every job that succeeds or fails for
+// good, once its final state is stored, e.g. to notify the caller. The
+// stored job no longer has its payload, fn still gets it. It runs on the
+// worker, so slow work belongs in a goroutine. Call it before Start.
+func (r *Runner) OnFinish(fn func(Job)) {
+	r.onFinish = fn
+}
+
+// Store returns the store jobs are persisted in
+func (r *Runner) Store() Store {
+	return r.store
+}
+
+// Start recovers unfinished jobs from the store and starts the workers.
+// Jobs other runners sharing the store are running stay theirs until their
+// lease runs out, which the runner keeps checking for.
+func (r *Runner) Start(ctx context.Context) error {
+	if _, err := r.store.Expire(ctx, time.Now()); err != nil {
+		return fmt.Errorf("jobs: recovering unfinished jobs: %w", err)
+	}
+	unfinished, err := r.store.Unfinished(ctx)
+	if err != nil {
+		return fmt.Errorf("jobs: recovering unfinished jobs: %w", err)
+	}
+	for _, job := range unfinished {
+		if job.Status == Queued {
+			r.schedule(job)
+		}
+	}
+	for i := 0; i < r.opts.Workers; i++ {
+		r.wg.Add(1)
+		go r.work()
+	}
+	r.wg.Add(1)
+	go r.expire()
+	return nil
+}
+
+// expire queues the jobs whose runner died while running them again, once
+// their lease runs out
+func (r *Runner) expire() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.opts.Lease)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			jobs, err := r.store.Expire(r.ctx, time.Now())
+			if err != nil {
+				slog.Error("recovering jobs with expired leases", "error", err)
+			}
+			for _, job := range jobs {
+				slog.Warn("job lease expired, running it again", "job", job.ID, "type", job.Type)
+				r.schedule(job)
+			}
+		}
+	}
+}
+
+// Enqueue stores a new job of type typ with payload and queues it to run.
+// The job belongs to the tenant of the caller in ctx.
+func (r *Runner) Enqueue(ctx context.Context, typ string, payload any) (Job, error) {
+	if _, ok := r.handlers[typ]; !ok {
+		return Job{}, fmt.Errorf("jobs: no handler for job type %q", typ)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, err
+	}
+	if r.full() {
+		return Job{}, ErrQueueFull
+	}
+	now := time.Now().UTC()
+	job := Job{
+		ID:          newID(),
+		Type:        typ,
+		Tenant:      auth.Tenant(ctx),
+		Status:      Queued,
+		MaxAttempts: r.opts.MaxAttempts,
+		Payload:     data,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := r.store.Save(ctx, job); err != nil {
+		return Job{}, err
+	}
+	r.schedule(job)
+	return job, nil
+}
+
+// Stop stops taking jobs off the queue and waits for running jobs to finish.
+// Jobs still running when ctx ends are cancelled and left queued in the
+// store, as are queued jobs, so they run again after a restart.
+func (r *Runner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return nil
+	}
+	r.stopped = true
+	for id, t := range r.timers {
+		t.Stop()
+		delete(r.timers, id)
+	}
+	r.mu.Unlock()
+	close(r.stop)
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// schedule queues job now or once its RunAt time arrives
+func (r *Runner) schedule(job Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+	delay := time.Until(job.RunAt)
+	if delay <= 0 {
+		if len(r.overflow) > 0 {
+			// behind the jobs already waiting
+			r.overflow = append(r.overflow, job.ID)
+			return
+		}
+		select {
+		case r.queue <- job.ID:
+		default:
+			slog.Warn("job queue full, job waits for room", "job", job.ID)
+			r.overflow = append(r.overflow, job.ID)
+		}
+		return
+	}
+	r.timers[job.ID] = time.AfterFunc(delay, func() {
+		r.mu.Lock()
+		delete(r.timers, job.ID)
+		r.mu.Unlock()
+		job.RunAt = time.Time{}
+		r.schedule(job)
+	})
+}
+
+func (r *Runner) work() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case id := <-r.queue:
+			r.refill()
+			r.run(id)
+		}
+	}
+}
+
+// full reports whether the queue has no room for new jobs
+func (r *Runner) full() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.overflow) > 0 || len(r.queue) == cap(r.queue)
+}
+
+// refill moves jobs from the overflow to the queue while it has room
+func (r *Runner) refill() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.overflow) > 0 {
+		select {
+		case r.queue <- r.overflow[0]:
+			r.overflow = r.overflow[1:]
+		default:
+			return
+		}
+	}
+}
+
+func (r *Runner) run(id string) {
+	ctx := r.ctx
+	job, err := r.store.Claim(ctx, id, r.owner, time.Now().Add(r.opts.Lease))
+	if errors.Is(err, ErrNotFound) {
+		// finished, or claimed by another runner
+		return
+	}
+	if err != nil {
+		slog.Error("claiming job", "job", id, "error", err)
+		return
+	}
+	handler := r.handlers[job.Type]
+	if handler == nil {
+		r.finish(job, Failed, nil, fmt.Errorf("no handler for job type %q", job.Type))
+		return
+	}
+
+	stopRenewing := r.renew(job.ID)
+	result, err := handler(ctx, job)
+	stopRenewing()
+	switch {
+	case err == nil:
+		r.finish(job, Succeeded, result, nil)
+	case ctx.Err() != nil:
+		// cancelled by shutdown, leave it for the next start
+		job.Attempts--
+		r.finish(job, Queued, nil, nil)
+	case job.Attempts < job.MaxAttempts:
+		job.RunAt = time.Now().UTC().Add(r.backoff(job.Attempts))
+		r.finish(job, Queued, nil, err)
+		r.schedule(job)
+	default:
+		r.finish(job, Failed, nil, err)
+	}
+}
+
+// renew keeps extending the lease on job id until the returned function is
+// called
+func (r *Runner) renew(id string) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(r.opts.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := r.store.Renew(context.Background(), id, r.owner, time.Now().Add(r.opts.Lease)); err != nil {
+					slog.Error("renewing job lease", "job", id, "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func (r *Runner) finish(job Job, status Status, result any, jobErr error) {
+	job.Status = status
+	job.Owner, job.LeaseUntil = "", time.Time{}
+	job.Error = ""
+	if jobErr != nil {
+		job.Error = jobErr.Error()
+		slog.Warn("job failed", "job", job.ID, "type", job.Type, "attempt", job.Attempts, "error", jobErr)
+	}
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			job.Status = Failed
+			job.Error = "encoding result: " + err.Error()
+		}
+		job.Result = data
+	}
+	job.UpdatedAt = time.Now().UTC()
+	stored := job
+	if job.Status.Done() {
+		// payloads can hold what callers sent, keep it no longer than needed
+		stored.Payload = nil
+	}
+	// use a fresh context so state is still written while shutting down
+	if err := r.store.Save(context.Background(), stored); err != nil {
+		slog.Error("saving job", "job", job.ID, "error", err)
+		return
+	}
+	if job.Status.Done() && r.onFinish != nil {
+		r.onFinish(job)
+	}
+}
+
+// backoff doubles the base delay for every attempt and adds up to 50% jitter
+// so retries of jobs that failed together don't all run at once
+func (r *Runner) backoff(attempt int) time.Duration {
+	d := r.opts.Backoff << (attempt - 1)
+	return d + time.Duration(mathrand.Int63n(int64(d)/2+1))
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,317 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/storage"
+)
+
+// MemoryStore keeps jobs in memory, so they are lost on restart
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, f Filter) ([]Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var jobs []Job
+	for _, job := range s.jobs {
+		if f.match(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	if f.Limit > 0 && len(jobs) > f.Limit {
+		jobs = jobs[:f.Limit]
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) Unfinished(ctx context.Context) ([]Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var jobs []Job
+	for _, job := range s.jobs {
+		if !job.Status.Done() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, id, owner string, until time.Time) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Status != Queued {
+		return Job{}, ErrNotFound
+	}
+	job.Status = Running
+	job.Attempts++
+	job.Owner, job.LeaseUntil = owner, until
+	job.UpdatedAt = time.Now().UTC()
+	s.jobs[id] = job
+	return job, nil
+}
+
+func (s *MemoryStore) Renew(ctx context.Context, id, owner string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Status != Running || job.Owner != owner {
+		return ErrNotFound
+	}
+	job.LeaseUntil = until
+	s.jobs[id] = job
+	return nil
+}
+
+func (s *MemoryStore) Expire(ctx context.Context, now time.Time) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []Job
+	for id, job := range s.jobs {
+		if job.Status == Running && job.LeaseUntil.Before(now) {
+			job.Status = Queued
+			job.Attempts--
+			job.Owner, job.LeaseUntil = "", time.Time{}
+			job.UpdatedAt = now.UTC()
+			s.jobs[id] = job
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, job := range s.jobs {
+		if job.Status.Done() && job.UpdatedAt.Before(before) {
+			delete(s.jobs, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLStore keeps jobs in the jobs table of the shared database
+type SQLStore struct {
+	db *storage.DB
+}
+
+// NewSQLStore migrates the jobs table and returns a store using it
+func NewSQLStore(ctx context.Context, db *storage.DB) (*SQLStore, error) {
+	if err := db.Migrate(ctx, "jobs", migrations, "migrations"); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+const jobColumns = `id, type, tenant, status, attempts, max_attempts, payload, result, error, run_at, created_at, updated_at, owner, lease_until`
+
+func (s *SQLStore) Save(ctx context.Context, job Job) error {
+	_, err := s.db.Exec(ctx, `INSERT INTO jobs (`+jobColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			status = excluded.status,
+			attempts = excluded.attempts,
+			payload = excluded.payload,
+			result = excluded.result,
+			error = excluded.error,
+			run_at = excluded.run_at,
+			updated_at = excluded.updated_at,
+			owner = excluded.owner,
+			lease_until = excluded.lease_until`,
+		job.ID, job.Type, job.Tenant, string(job.Status), job.Attempts, job.MaxAttempts,
+		string(job.Payload), string(job.Result), job.Error, job.RunAt, job.CreatedAt, job.UpdatedAt,
+		job.Owner, leaseMillis(job.LeaseUntil))
+	return err
+}
+
+// leaseMillis stores leases as Unix milliseconds, which compare the same in
+// every database
+func leaseMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func (s *SQLStore) Claim(ctx context.Context, id, owner string, until time.Time) (Job, error) {
+	res, err := s.db.Exec(ctx, `UPDATE jobs SET status = ?, attempts = attempts + 1, owner = ?, lease_until = ?, updated_at = ?
+		WHERE id = ? AND status = ?`,
+		string(Running), owner, leaseMillis(until), time.Now().UTC(), id, string(Queued))
+	if err != nil {
+		return Job{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Job{}, err
+	}
+	if n == 0 {
+		return Job{}, ErrNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *SQLStore) Renew(ctx context.Context, id, owner string, until time.Time) error {
+	res, err := s.db.Exec(ctx, `UPDATE jobs SET lease_until = ? WHERE id = ? AND status = ? AND owner = ?`,
+		leaseMillis(until), id, string(Running), owner)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) Expire(ctx context.Context, now time.Time) ([]Job, error) {
+	expired, err := s.query(ctx, `SELECT `+jobColumns+` FROM jobs WHERE status = ? AND lease_until < ?`,
+		string(Running), now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	for _, job := range expired {
+		// only one runner gets to requeue each job
+		res, err := s.db.Exec(ctx, `UPDATE jobs SET status = ?, attempts = attempts - 1, owner = '', lease_until = 0, updated_at = ?
+			WHERE id = ? AND status = ? AND owner = ? AND lease_until = ?`,
+			string(Queued), now.UTC(), job.ID, string(Running), job.Owner, leaseMillis(job.LeaseUntil))
+		if err != nil {
+			return jobs, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		job.Status = Queued
+		job.Attempts--
+		job.Owner, job.LeaseUntil = "", time.Time{}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Job, error) {
+	job, err := scanJob(s.db.QueryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	return job, err
+}
+
+func (s *SQLStore) List(ctx context.Context, f Filter) ([]Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE 1 = 1`
+	var args []any
+	if f.Type != "" {
+		query += ` AND type = ?`
+		args = append(args, f.Type)
+	}
+	if f.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, string(f.Status))
+	}
+	if !f.AllTenants {
+		query += ` AND tenant = ?`
+		args = append(args, f.Tenant)
+	}
+	query += ` ORDER BY created_at DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+	return s.query(ctx, query, args...)
+}
+
+func (s *SQLStore) Unfinished(ctx context.Context) ([]Job, error) {
+	return s.query(ctx, `SELECT `+jobColumns+` FROM jobs WHERE status IN (?, ?)`, string(Queued), string(Running))
+}
+
+func (s *SQLStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.Exec(ctx, `DELETE FROM jobs WHERE status IN (?, ?) AND updated_at < ?`, string(Succeeded), string(Failed), before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) ([]Job, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row scanner) (Job, error) {
+	var job Job
+	var status, payload, result string
+	var lease int64
+	err := row.Scan(&job.ID, &job.Type, &job.Tenant, &status, &job.Attempts, &job.MaxAttempts,
+		&payload, &result, &job.Error, &job.RunAt, &job.CreatedAt, &job.UpdatedAt, &job.Owner, &lease)
+	if err != nil {
+		return Job{}, err
+	}
+	job.Status = Status(status)
+	if lease != 0 {
+		job.LeaseUntil = time.UnixMilli(lease).UTC()
+	}
+	if payload != "" {
+		job.Payload = []byte(payload)
+	}
+	if result != "" {
+		job.Result = []byte(result)
+	}
+	return job, nil
+}
@@ -0,0 +1,98 @@
+// Package loadshed caps the requests a route group serves at once and sheds
+// the excess with 503 Service Unavailable, so an overloaded service keeps
+// answering the requests it accepts quickly instead of letting every
+// request's latency collapse.
+package loadshed
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/respond"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Limits configures one route group
+type Limits struct {
+	// MaxInFlight is how many requests the group serves at once
+	MaxInFlight int
+	// MaxWait is how long a request may wait for a free slot before it is
+	// shed, zero sheds immediately
+	MaxWait time.Duration
+}
+
+// Shedder creates the limits of route groups and counts what they shed
+type Shedder struct {
+	inFlight *prometheus.GaugeVec
+	shed     *prometheus.CounterVec
+}
+
+// New creates a Shedder whose loadshed_in_flight and loadshed_shed_total
+// metrics are registered with reg
+func New(reg prometheus.Registerer) *Shedder {
+	s := &Shedder{
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "loadshed_in_flight",
+			Help: "Requests being served per load shedding group.",
+		}, []string{"group"}),
+		shed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "loadshed_shed_total",
+			Help: "Requests rejected because their group was at capacity.",
+		}, []string{"group"}),
+	}
+	reg.MustRegister(s.inFlight, s.shed)
+	return s
+}
+
+// Limit returns middleware admitting at most limits.MaxInFlight requests of
+// group at once. Every route wrapped by the returned middleware shares the
+// capacity, so create it once per group.
+func (s *Shedder) Limit(group string, limits Limits) func(http.Handler) http.Handler {
+	if limits.MaxInFlight < 1 {
+		limits.MaxInFlight = 1
+	}
+	slots := make(chan struct{}, limits.MaxInFlight)
+	inFlight := s.inFlight.WithLabelValues(group)
+	shed := s.shed.WithLabelValues(group)
+	retryAfter := strconv.Itoa(max(1, int(limits.MaxWait.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acquire(r, slots, limits.MaxWait) {
+				shed.Inc()
+				w.Header().Set("Retry-After", retryAfter)
+				respond.Error(w, http.StatusServiceUnavailable, "server is overloaded, try again shortly")
+				return
+			}
+			inFlight.Inc()
+			defer func() {
+				inFlight.Dec()
+				<-slots
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquire takes a slot, waiting up to wait for one to free up
+func acquire(r *http.Request, slots chan struct{}, wait time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
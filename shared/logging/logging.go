@@ -0,0 +1,245 @@
+// Package logging sets up structured slog logging for the services, with
+// request logging middleware and redaction of card numbers and other
+// sensitive fields.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/metrics"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// RequestIDHeader carries the request ID between services
+const RequestIDHeader = "X-Request-ID"
+
+// Options configures a logger
+type Options struct {
+	Service string
+	// Level is the minimum level logged, defaults to info
+	Level slog.Leveler
+	// SensitiveFields are masked in addition to DefaultSensitiveFields
+	SensitiveFields []string
+	// Output defaults to stderr
+	Output io.Writer
+}
+
+// New creates a JSON logger whose records pass through a Redactor before
+// they are written. Records logged with the context of a request carry its
+// requestId.
+func New(opts Options) *slog.Logger {
+	if opts.Output == nil {
+		opts.Output = os.Stderr
+	}
+	redactor := NewRedactor(opts.SensitiveFields...)
+	h := slog.NewJSONHandler(opts.Output, &slog.HandlerOptions{
+		Level:       opts.Level,
+		ReplaceAttr: redactor.ReplaceAttr,
+	})
+	return slog.New(contextHandler{h}).With("service", opts.Service)
+}
+
+// contextHandler adds the request ID in the context of a record to it
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("requestId", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// ParseLevel parses debug, info, warn or error, defaulting to info
+func ParseLevel(s string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request ctx belongs to
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestID returns a copy of ctx carrying id, for work started outside
+// of a request that should be logged like one
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// maxRequestID bounds the length of request IDs taken from clients
+const maxRequestID = 128
+
+// validRequestID reports whether id, sent by a client, is safe to log and
+// echo: not too long and made of printable ASCII without spaces
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// maxLoggedBody bounds the request bodies logged at debug level, larger ones
+// are logged by size only so a card number is never cut in half where the
+// redactor can't recognize it
+const maxLoggedBody = 4 << 10
+
+// Middleware logs one line per request with its method, route, status,
+// duration and request ID. The ID is taken from the X-Request-ID header or
+// generated, stored in the request context so every line logged for the
+// request carries it, and sent back in the response header. The path is logged without the query string so
+// parameters never reach the log. At debug level it logs request bodies
+// too, through the logger's redaction like everything else: JSON bodies are
+// logged as attribute groups, so sensitive fields are masked by name at any
+// depth as well as card numbers by value.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	if _, ok := logger.Handler().(contextHandler); !ok {
+		logger = slog.New(contextHandler{logger.Handler()})
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			r = r.WithContext(WithRequestID(r.Context(), id))
+			w.Header().Set(RequestIDHeader, id)
+			if r.Body != nil && r.Body != http.NoBody && logger.Enabled(r.Context(), slog.LevelDebug) {
+				logger.LogAttrs(r.Context(), slog.LevelDebug, "request body", peekBody(r))
+			}
+
+			start := time.Now()
+			rec := respond.NewRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			level := slog.LevelInfo
+			if rec.Status >= 500 {
+				level = slog.LevelError
+			}
+			logger.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("route", metrics.Route(r)),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.Status),
+				slog.Int("bytes", rec.Bytes),
+				slog.Float64("durationMs", float64(time.Since(start).Microseconds())/1000),
+			)
+		})
+	}
+}
+
+// peekBody reads the start of the request body for logging and puts it back.
+// JSON and form bodies become attributes so sensitive fields are masked by
+// name, other bodies aren't logged at all.
+func peekBody(r *http.Request) slog.Attr {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), r.Body))
+	switch {
+	case err != nil:
+		return slog.String("body", "unreadable: "+err.Error())
+	case len(data) > maxLoggedBody:
+		return slog.String("body", fmt.Sprintf("over %d bytes, not logged", maxLoggedBody))
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// numbers stay strings, a card number as a float would slip past the
+	// redactor in exponent notation
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		return jsonAttr("body", v)
+	}
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(data)); err == nil {
+			return formAttr("body", form)
+		}
+	}
+	return slog.String("body", fmt.Sprintf("%d bytes of %q, not logged", len(data), contentType))
+}
+
+// formAttr turns a parsed form into a group with an attribute per field.
+// Repeated fields are joined rather than nested, so they're still masked by
+// name.
+func formAttr(key string, form url.Values) slog.Attr {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, len(keys))
+	for i, k := range keys {
+		attrs[i] = slog.String(k, strings.Join(form[k], ","))
+	}
+	return slog.Attr{Key: key, Value: slog.GroupValue(attrs...)}
+}
+
+// jsonAttr turns a decoded JSON value into an attribute, objects and arrays
+// becoming groups
+func jsonAttr(key string, v any) slog.Attr {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		attrs := make([]slog.Attr, len(keys))
+		for i, k := range keys {
+			attrs[i] = jsonAttr(k, v[k])
+		}
+		return slog.Attr{Key: key, Value: slog.GroupValue(attrs...)}
+	case []any:
+		attrs := make([]slog.Attr, len(v))
+		for i, item := range v {
+			attrs[i] = jsonAttr(strconv.Itoa(i), item)
+		}
+		return slog.Attr{Key: key, Value: slog.GroupValue(attrs...)}
+	case json.Number:
+		return slog.String(key, v.String())
+	case string:
+		return slog.String(key, v)
+	case bool:
+		return slog.Bool(key, v)
+	}
+	return slog.String(key, "null")
+}
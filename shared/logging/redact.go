@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// DefaultSensitiveFields are attribute keys that are always masked
+var DefaultSensitiveFields = []string{
+	"cardNumber", "pan", "cvv", "cvc", "password", "secret", "token",
+	"authorization", "x-api-key",
+}
+
+// redacted replaces the value of sensitive fields that don't look like a PAN
+const redacted = "[REDACTED]"
+
+// panPattern matches 13 to 19 digits, optionally separated by single spaces
+// or dashes the way card numbers are usually written. It has no \b so
+// numbers glued to letters, like in card_4242..., are found too; findPANs
+// checks for neighbouring digits instead.
+var panPattern = regexp.MustCompile(`(?:\d[ -]?){12,18}\d`)
+
+// findPANs returns the index pairs of the card numbers in s. Longer runs of
+// digits aren't card numbers and are left alone.
+func findPANs(s string) [][]int {
+	var pans [][]int
+	for _, loc := range panPattern.FindAllStringIndex(s, -1) {
+		if loc[0] > 0 && isDigit(s[loc[0]-1]) || loc[1] < len(s) && isDigit(s[loc[1]]) {
+			continue
+		}
+		pans = append(pans, loc)
+	}
+	return pans
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// Redactor masks sensitive values in log records
+type Redactor struct {
+	fields map[string]bool
+}
+
+// NewRedactor creates a Redactor masking DefaultSensitiveFields plus fields.
+// Field names are matched case-insensitively.
+func NewRedactor(fields ...string) *Redactor {
+	r := &Redactor{fields: make(map[string]bool)}
+	for _, f := range append(DefaultSensitiveFields, fields...) {
+		r.fields[strings.ToLower(f)] = true
+	}
+	return r
+}
+
+// ReplaceAttr is a slog.HandlerOptions.ReplaceAttr that masks sensitive
+// fields by name and anything that looks like a card number by value,
+// including inside the log message itself
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		return a
+	case slog.KindString:
+		s := a.Value.String()
+		if r.fields[strings.ToLower(a.Key)] {
+			return slog.String(a.Key, maskField(s))
+		}
+		return slog.String(a.Key, RedactString(s))
+	case slog.KindAny, slog.KindInt64, slog.KindUint64:
+		// numbers too, a card number fits in an int64
+		s := fmt.Sprintf("%+v", a.Value.Any())
+		if r.fields[strings.ToLower(a.Key)] {
+			return slog.String(a.Key, maskField(s))
+		}
+		if len(findPANs(s)) > 0 {
+			return slog.String(a.Key, RedactString(s))
+		}
+		return a
+	}
+	if r.fields[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+func maskField(s string) string {
+	if len(findPANs(s)) > 0 {
+		return RedactString(s)
+	}
+	return redacted
+}
+
+// RedactString masks every card number in s
+func RedactString(s string) string {
+	pans := findPANs(s)
+	if len(pans) == 0 {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range pans {
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(MaskPAN(s[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// MaskPAN keeps the first six and last four digits of a card number and masks
+// the rest, dropping any separators
+func MaskPAN(pan string) string {
+	digits := make([]byte, 0, len(pan))
+	for i := 0; i < len(pan); i++ {
+		if pan[i] >= '0' && pan[i] <= '9' {
+			digits = append(digits, pan[i])
+		}
+	}
+	if len(digits) < 11 {
+		return strings.Repeat("*", len(digits))
+	}
+	for i := 6; i < len(digits)-4; i++ {
+		digits[i] = '*'
+	}
+	return string(digits)
+}
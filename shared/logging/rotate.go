@@ -0,0 +1,177 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateOptions configures a RotatingFile. Zero values disable the
+// respective limit.
+type RotateOptions struct {
+	// MaxSize rotates the file once it grows past this many bytes
+	MaxSize int64
+	// Every rotates the file when it is older than this, e.g. 24h
+	Every time.Duration
+	// MaxBackups is how many rotated files are kept
+	MaxBackups int
+	// Compress gzips rotated files
+	Compress bool
+}
+
+// RotatingFile is an append-only log file that moves itself aside to
+// path.<timestamp> when it gets too big or too old. It is safe for
+// concurrent use.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	// cleanup serialises compressing and pruning rotated files
+	cleanup sync.Mutex
+}
+
+// OpenRotating opens or creates the log file at path
+func OpenRotating(path string, opts RotateOptions) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, opts: opts}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size, rf.opened = f, fi.Size(), fi.ModTime()
+	if rf.size == 0 {
+		rf.opened = time.Now()
+	}
+	return nil
+}
+
+// Write appends p, rotating first when p would take the file past its
+// limits
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+	tooBig := rf.opts.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.opts.MaxSize
+	tooOld := rf.opts.Every > 0 && time.Since(rf.opened) >= rf.opts.Every
+	if tooBig || tooOld {
+		if err := rf.rotate(); err != nil {
+			// keep logging to the current file rather than losing lines
+			slog.Error("rotating log file", "path", rf.path, "error", err)
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate is called with rf.mu held
+func (rf *RotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	rotated := rf.path + "." + time.Now().UTC().Format("20060102T150405.000")
+	renameErr := os.Rename(rf.path, rotated)
+	if err := rf.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	go rf.tidy(rotated)
+	return nil
+}
+
+// tidy compresses the file just rotated and removes the oldest backups
+func (rf *RotatingFile) tidy(rotated string) {
+	rf.cleanup.Lock()
+	defer rf.cleanup.Unlock()
+	if rf.opts.Compress {
+		if err := compress(rotated); err != nil {
+			slog.Error("compressing rotated log file", "path", rotated, "error", err)
+		}
+	}
+	if rf.opts.MaxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return
+	}
+	// timestamps sort chronologically, with or without .gz
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], ".gz") < strings.TrimSuffix(backups[j], ".gz")
+	})
+	for len(backups) > rf.opts.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			slog.Error("removing old log file", "path", backups[0], "error", err)
+		}
+		backups = backups[1:]
+	}
+}
+
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return fmt.Errorf("compressing %s: %w", path, err)
+	}
+	return os.Remove(path)
+}
+
+// Close closes the file. Writes after Close fail.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return nil
+	}
+	err := rf.f.Close()
+	rf.f = nil
+	// wait for compression of the last rotation
+	rf.cleanup.Lock()
+	rf.cleanup.Unlock()
+	return err
+}
@@ -0,0 +1,79 @@
+package metering
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// Report is the usage of a period, with the totals per outcome
+type Report struct {
+	From    string           `json:"from"`
+	To      string           `json:"to"`
+	Total   int64            `json:"total"`
+	Totals  map[string]int64 `json:"totals"`
+	Records []Record         `json:"records"`
+}
+
+// RegisterRoutes adds the usage report of the calling key to r:
+//
+//	GET /usage  usage between ?from= and ?to=, defaulting to this month
+func RegisterRoutes(r *mux.Router, store Store) {
+	r.HandleFunc("/usage", usage(store, false)).Methods("GET")
+}
+
+// RegisterAdminRoutes adds the usage report of every key to r, which is
+// normally the /admin subrouter. Admins of a tenant see their tenant's keys.
+//
+//	GET /usage  usage between ?from= and ?to=, optionally of one ?key=
+func RegisterAdminRoutes(r *mux.Router, store Store) {
+	r.HandleFunc("/usage", usage(store, true)).Methods("GET")
+}
+
+func usage(store Store, admin bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, _ := auth.FromContext(r.Context())
+		q := r.URL.Query()
+		now := time.Now().UTC()
+		f := Filter{
+			Key:    p.ID,
+			From:   q.Get("from"),
+			To:     q.Get("to"),
+			Tenant: p.Tenant,
+		}
+		if admin {
+			f.Key = q.Get("key")
+			f.AllTenants = p.Operator()
+		}
+		if f.From == "" {
+			f.From = now.Format("2006-01") + "-01"
+		}
+		if f.To == "" {
+			f.To = now.Format(time.DateOnly)
+		}
+		for _, day := range []string{f.From, f.To} {
+			if _, err := time.Parse(time.DateOnly, day); err != nil {
+				respond.Error(w, http.StatusBadRequest, "from and to must be dates like 2006-01-02")
+				return
+			}
+		}
+
+		records, err := store.Usage(r.Context(), f)
+		if err != nil {
+			respond.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		report := Report{From: f.From, To: f.To, Totals: make(map[string]int64), Records: records}
+		if report.Records == nil {
+			report.Records = []Record{}
+		}
+		for _, rec := range records {
+			report.Total += rec.Count
+			report.Totals[rec.Outcome] += rec.Count
+		}
+		respond.JSON(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,292 @@
+// Package metering counts requests per API key by route and outcome, keeps
+// the counts for usage reports and enforces daily and monthly quotas.
+package metering
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/metrics"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// Request outcomes
+const (
+	Success     = "success"
+	ClientError = "client_error"
+	ServerError = "server_error"
+	// OverQuota requests are counted but don't use up quota
+	OverQuota = "over_quota"
+)
+
+// Quota limits the requests a key may make, zero means unlimited
+type Quota struct {
+	Daily   int64
+	Monthly int64
+}
+
+// counter tracks the quota use of one key in the current day and month
+type counter struct {
+	day, month     string
+	daily, monthly int64
+}
+
+// Meter counts requests in memory and writes them to its store in batches.
+// Quota use is tracked per process unless ShareQuotas is called, so with
+// several replicas each enforces the quota on the requests it serves plus
+// what was stored when it first saw the key that month.
+type Meter struct {
+	store Store
+
+	mu       sync.Mutex
+	shared   *RedisQuotas
+	quota    Quota
+	tenants  map[string]Quota
+	counters map[string]*counter
+	pending  map[recordKey]Record
+	now      func() time.Time
+}
+
+// New creates a Meter persisting counts in store
+func New(store Store) *Meter {
+	return &Meter{
+		store:    store,
+		counters: make(map[string]*counter),
+		pending:  make(map[recordKey]Record),
+		now:      time.Now,
+	}
+}
+
+// SetQuotas sets the default quota of every key and the overrides for the
+// keys of some tenants, e.g. after a configuration reload
+func (m *Meter) SetQuotas(quota Quota, tenants map[string]Quota) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quota = quota
+	m.tenants = tenants
+}
+
+// ShareQuotas tracks quota use in q instead of in this process, so every
+// replica enforces the whole quota
+func (m *Meter) ShareQuotas(q *RedisQuotas) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shared = q
+}
+
+// Middleware meters authenticated requests and answers 429 Too Many Requests
+// once the caller's quota is used up. Callers with a quota learn how much of
+// it is left from the X-Quota-Limit, X-Quota-Remaining and X-Quota-Reset
+// headers, for whichever of their daily and monthly quota runs out first. It
+// has to run after authentication.
+func (m *Meter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.FromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := metrics.Route(r)
+		use, ok := m.take(r.Context(), p)
+		use.setHeaders(w.Header())
+		if !ok {
+			m.record(p, route, OverQuota)
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(use.reset).Seconds())+1))
+			respond.Error(w, http.StatusTooManyRequests, "quota exceeded, resets at "+use.reset.Format(time.RFC3339))
+			return
+		}
+		rec := respond.NewRecorder(w)
+		next.ServeHTTP(rec, r)
+		m.record(p, route, outcome(rec.Status))
+	})
+}
+
+// quotaUsage is the quota of a key and how much of it the key used, counting the
+// current request unless it's over quota
+type quotaUsage struct {
+	quota          Quota
+	daily, monthly int64
+	// dayEnd and monthEnd are when the counts reset
+	dayEnd, monthEnd time.Time
+	// reset is when a key over quota may try again
+	reset time.Time
+}
+
+func newUsage(quota Quota, now time.Time) quotaUsage {
+	return quotaUsage{
+		quota:    quota,
+		dayEnd:   time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+		monthEnd: time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// check reports whether another request fits the quota, setting u.reset
+// when it doesn't
+func (u *quotaUsage) check() bool {
+	switch {
+	case u.quota.Monthly > 0 && u.monthly >= u.quota.Monthly:
+		u.reset = u.monthEnd
+	case u.quota.Daily > 0 && u.daily >= u.quota.Daily:
+		u.reset = u.dayEnd
+	default:
+		return true
+	}
+	return false
+}
+
+// setHeaders describes the quota that runs out first
+func (u quotaUsage) setHeaders(h http.Header) {
+	limit, used, reset := u.quota.Daily, u.daily, u.dayEnd
+	if u.quota.Monthly > 0 && (limit == 0 || u.quota.Monthly-u.monthly < limit-used) {
+		limit, used, reset = u.quota.Monthly, u.monthly, u.monthEnd
+	}
+	if limit == 0 {
+		return
+	}
+	h.Set("X-Quota-Limit", strconv.FormatInt(limit, 10))
+	h.Set("X-Quota-Remaining", strconv.FormatInt(max(limit-used, 0), 10))
+	h.Set("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+}
+
+// take uses one request of the quota of p, in Redis when the quotas are
+// shared and in the counters of this process otherwise. It returns false
+// when the quota is used up.
+func (m *Meter) take(ctx context.Context, p auth.Principal) (quotaUsage, bool) {
+	now := m.now().UTC()
+	day, month := now.Format(time.DateOnly), now.Format("2006-01")
+
+	m.mu.Lock()
+	quota, ok := m.tenants[p.Tenant]
+	if !ok {
+		quota = m.quota
+	}
+	shared := m.shared
+	m.mu.Unlock()
+	use := newUsage(quota, now)
+	if shared != nil && (quota.Daily > 0 || quota.Monthly > 0) {
+		use, ok, err := shared.take(ctx, p.ID, use, day, month)
+		if err == nil {
+			return use, ok
+		}
+		slog.ErrorContext(ctx, "taking shared quota, counting in this replica", "key", p.ID, "error", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.counters[p.ID]
+	switch {
+	case !ok || c.month != month:
+		c = m.load(ctx, p.ID, p.Tenant, day, month)
+		m.counters[p.ID] = c
+	case c.day != day:
+		c.day, c.daily = day, 0
+	}
+
+	use.daily, use.monthly = c.daily, c.monthly
+	if !use.check() {
+		return use, false
+	}
+	c.daily++
+	c.monthly++
+	use.daily, use.monthly = c.daily, c.monthly
+	return use, true
+}
+
+// load counts the stored and pending requests of key in the current month.
+// It is called with m.mu held, once per key and month.
+func (m *Meter) load(ctx context.Context, key, tenant, day, month string) *counter {
+	c := &counter{day: day, month: month}
+	records, err := m.store.Usage(ctx, Filter{Key: key, Tenant: tenant, From: month + "-01", To: day})
+	if err != nil {
+		slog.ErrorContext(ctx, "loading usage, quota starts from zero", "key", key, "error", err)
+	}
+	for _, rec := range m.pending {
+		if rec.Key == key && rec.Day >= month+"-01" {
+			records = append(records, rec)
+		}
+	}
+	for _, rec := range records {
+		if rec.Outcome == OverQuota {
+			continue
+		}
+		c.monthly += rec.Count
+		if rec.Day == day {
+			c.daily += rec.Count
+		}
+	}
+	return c
+}
+
+func (m *Meter) record(p auth.Principal, route, outcome string) {
+	day := m.now().UTC().Format(time.DateOnly)
+	k := recordKey{p.ID, day, route, outcome}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.pending[k]
+	if !ok {
+		rec = Record{Key: p.ID, Tenant: p.Tenant, Day: day, Route: route, Outcome: outcome}
+	}
+	rec.Count++
+	m.pending[k] = rec
+}
+
+// Flush writes the pending counts to the store. It also serves as a server
+// shutdown hook so no counts are lost on restart.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	records := make([]Record, 0, len(m.pending))
+	for _, rec := range m.pending {
+		records = append(records, rec)
+	}
+	m.pending = make(map[recordKey]Record)
+	m.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+
+	err := m.store.Add(ctx, records)
+	if err != nil {
+		// put them back for the next flush
+		m.mu.Lock()
+		for _, rec := range records {
+			k := recordKey{rec.Key, rec.Day, rec.Route, rec.Outcome}
+			if pending, ok := m.pending[k]; ok {
+				rec.Count += pending.Count
+			}
+			m.pending[k] = rec
+		}
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// Run flushes the pending counts every interval until ctx is done
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := m.Flush(ctx); err != nil {
+				slog.Error("writing usage", "error", err)
+			}
+		}
+	}
+}
+
+func outcome(status int) string {
+	switch {
+	case status >= 500:
+		return ServerError
+	case status >= 400:
+		return ClientError
+	}
+	return Success
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS api_usage (
+	key_id TEXT NOT NULL,
+	tenant TEXT NOT NULL,
+	day TEXT NOT NULL,
+	route TEXT NOT NULL,
+	outcome TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (key_id, day, route, outcome)
+);
+CREATE INDEX IF NOT EXISTS api_usage_tenant_day ON api_usage (tenant, day);
@@ -0,0 +1,59 @@
+package metering
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeQuota counts a request in the daily and monthly counters in KEYS
+// unless either is at its limit in ARGV, zero meaning unlimited. The
+// counters expire once their period is over. It returns both counts and
+// whether the request was counted.
+var takeQuota = redis.NewScript(`
+local daily = tonumber(redis.call("GET", KEYS[1]) or "0")
+local monthly = tonumber(redis.call("GET", KEYS[2]) or "0")
+local dailyLimit, monthlyLimit = tonumber(ARGV[1]), tonumber(ARGV[2])
+if (monthlyLimit > 0 and monthly >= monthlyLimit) or (dailyLimit > 0 and daily >= dailyLimit) then
+	return {daily, monthly, 0}
+end
+daily = redis.call("INCR", KEYS[1])
+redis.call("EXPIREAT", KEYS[1], ARGV[3])
+monthly = redis.call("INCR", KEYS[2])
+redis.call("EXPIREAT", KEYS[2], ARGV[4])
+return {daily, monthly, 1}`)
+
+// RedisQuotas tracks the quota use of keys in Redis, so replicas share
+// their counts. Counts start from zero the first time Redis sees a key in a
+// day or month; stored usage isn't loaded into Redis.
+type RedisQuotas struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisQuotas uses client, namespacing keys with prefix
+func NewRedisQuotas(client *redis.Client, prefix string) *RedisQuotas {
+	return &RedisQuotas{client: client, prefix: prefix + "quota:"}
+}
+
+// take counts a request of key in use, the usage of its quota on day of
+// month, unless the quota is used up
+func (q *RedisQuotas) take(ctx context.Context, key string, use quotaUsage, day, month string) (quotaUsage, bool, error) {
+	keys := []string{q.prefix + key + ":" + day, q.prefix + key + ":" + month}
+	// keep the counters a day past their period for clock skew between
+	// replicas
+	res, err := takeQuota.Run(ctx, q.client, keys,
+		use.quota.Daily, use.quota.Monthly,
+		use.dayEnd.Add(24*time.Hour).Unix(), use.monthEnd.Add(24*time.Hour).Unix(),
+	).Int64Slice()
+	if err != nil {
+		return use, false, err
+	}
+	use.daily, use.monthly = res[0], res[1]
+	if res[2] == 0 {
+		use.check()
+		return use, false, nil
+	}
+	return use, true, nil
+}
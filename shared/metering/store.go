@@ -0,0 +1,168 @@
+package metering
+
+import (
+	"context"
+	"embed"
+	"sort"
+	"sync"
+
+	"github.com/ixmorrow/go-projects/shared/storage"
+)
+
+// Record counts the requests one key made to one route with one outcome on
+// one day
+type Record struct {
+	Key     string `json:"key"`
+	Tenant  string `json:"tenant,omitempty"`
+	Day     string `json:"day"`
+	Route   string `json:"route"`
+	Outcome string `json:"outcome"`
+	Count   int64  `json:"count"`
+}
+
+// Filter narrows a usage query. From and To are inclusive days in
+// YYYY-MM-DD form and may be empty.
+type Filter struct {
+	Key  string
+	From string
+	To   string
+	// Tenant limits the query to one tenant's keys unless AllTenants is set
+	Tenant     string
+	AllTenants bool
+}
+
+func (f Filter) match(r Record) bool {
+	return (f.Key == "" || r.Key == f.Key) &&
+		(f.From == "" || r.Day >= f.From) &&
+		(f.To == "" || r.Day <= f.To) &&
+		(f.AllTenants || r.Tenant == f.Tenant)
+}
+
+// Store persists usage counts
+type Store interface {
+	// Add increments the stored counts by the given records
+	Add(ctx context.Context, records []Record) error
+	Usage(ctx context.Context, f Filter) ([]Record, error)
+}
+
+type recordKey struct {
+	key, day, route, outcome string
+}
+
+// MemoryStore keeps usage in memory
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[recordKey]Record
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[recordKey]Record)}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range records {
+		k := recordKey{r.Key, r.Day, r.Route, r.Outcome}
+		if existing, ok := s.records[k]; ok {
+			r.Count += existing.Count
+		}
+		s.records[k] = r
+	}
+	return nil
+}
+
+func (s *MemoryStore) Usage(ctx context.Context, f Filter) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var records []Record
+	for _, r := range s.records {
+		if f.match(r) {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return a.Outcome < b.Outcome
+	})
+	return records, nil
+}
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLStore keeps usage in the api_usage table of the shared database
+type SQLStore struct {
+	db *storage.DB
+}
+
+// NewSQLStore migrates the api_usage table and returns a store using it
+func NewSQLStore(ctx context.Context, db *storage.DB) (*SQLStore, error) {
+	if err := db.Migrate(ctx, "metering", migrations, "migrations"); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Add(ctx context.Context, records []Record) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := s.db.Rebind(`INSERT INTO api_usage (key_id, tenant, day, route, outcome, count)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key_id, day, route, outcome) DO UPDATE SET count = api_usage.count + excluded.count`)
+	for _, r := range records {
+		if _, err := tx.ExecContext(ctx, query, r.Key, r.Tenant, r.Day, r.Route, r.Outcome, r.Count); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Usage(ctx context.Context, f Filter) ([]Record, error) {
+	query := `SELECT key_id, tenant, day, route, outcome, count FROM api_usage WHERE 1 = 1`
+	var args []any
+	if f.Key != "" {
+		query += ` AND key_id = ?`
+		args = append(args, f.Key)
+	}
+	if f.From != "" {
+		query += ` AND day >= ?`
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		query += ` AND day <= ?`
+		args = append(args, f.To)
+	}
+	if !f.AllTenants {
+		query += ` AND tenant = ?`
+		args = append(args, f.Tenant)
+	}
+	query += ` ORDER BY day, key_id, route, outcome`
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []Record
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.Key, &r.Tenant, &r.Day, &r.Route, &r.Outcome, &r.Count); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
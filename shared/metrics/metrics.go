@@ -0,0 +1,100 @@
+// Package metrics records Prometheus metrics for the HTTP services and serves
+// them on /metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/respond"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the standard HTTP metrics of one service
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// New creates the HTTP metrics for service in a fresh registry that also
+// includes the Go runtime and process collectors
+func New(service string) *Metrics {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	labels := prometheus.Labels{"service": service}
+	m := &Metrics{
+		registry: reg,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "http_requests_total",
+			Help:        "HTTP requests by route, method and status code.",
+			ConstLabels: labels,
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "http_request_duration_seconds",
+			Help:        "HTTP request latency by route and method.",
+			ConstLabels: labels,
+			Buckets:     prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		size: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "http_response_size_bytes",
+			Help:        "HTTP response body sizes by route and method.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(64, 4, 8),
+		}, []string{"route", "method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "http_requests_in_flight",
+			Help:        "HTTP requests currently being served.",
+			ConstLabels: labels,
+		}),
+	}
+	reg.MustRegister(m.requests, m.duration, m.size, m.inFlight)
+	return m
+}
+
+// Registry is where services register their own metrics
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware measures every request. It labels requests by their mux route
+// template rather than the raw path so ids in URLs don't explode cardinality.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		start := time.Now()
+		rec := respond.NewRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		route := Route(r)
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(rec.Status)).Inc()
+		m.duration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		m.size.WithLabelValues(route, r.Method).Observe(float64(rec.Bytes))
+	})
+}
+
+// Route returns the path template of the mux route that matched r
+func Route(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatsD flavours
+const (
+	// DogStatsD sends labels and tags as |#name:value tags
+	DogStatsD = "dogstatsd"
+	// StatsD appends label values to the metric name, since plain StatsD has
+	// no tags
+	StatsD = "statsd"
+)
+
+// maxPacket keeps datagrams within a typical MTU
+const maxPacket = 1432
+
+// StatsDConfig configures pushing metrics to a StatsD or DogStatsD agent
+type StatsDConfig struct {
+	// Addr is the UDP host:port of the agent
+	Addr string
+	// Flavor is DogStatsD (the default) or StatsD
+	Flavor string
+	// Prefix is put in front of every metric name, e.g. "ccv."
+	Prefix string
+	// Tags are added to every metric as name:value, DogStatsD only
+	Tags []string
+	// Interval is how often metrics are pushed, defaults to 10s
+	Interval time.Duration
+}
+
+// PushStatsD sends the registry's metrics to a StatsD agent every interval
+// until ctx is done. Counters are sent as the increase since the last push,
+// histograms and summaries as the increase of their count and sum, and
+// gauges as their value.
+func (m *Metrics) PushStatsD(ctx context.Context, cfg StatsDConfig) error {
+	if cfg.Flavor == "" {
+		cfg.Flavor = DogStatsD
+	}
+	if cfg.Flavor != DogStatsD && cfg.Flavor != StatsD {
+		return fmt.Errorf("statsd: unknown flavor %q", cfg.Flavor)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	p := &statsdPusher{cfg: cfg, conn: conn, last: make(map[string]float64)}
+	t := time.NewTicker(cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			families, err := m.registry.Gather()
+			if err != nil {
+				slog.Warn("gathering metrics for statsd", "error", err)
+			}
+			p.push(families)
+		}
+	}
+}
+
+type statsdPusher struct {
+	cfg  StatsDConfig
+	conn net.Conn
+	// last holds the previous value of counters to send increases
+	last   map[string]float64
+	primed bool
+	buf    bytes.Buffer
+}
+
+func (p *statsdPusher) push(families []*dto.MetricFamily) {
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			labels := metric.GetLabel()
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				p.counter(name, labels, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				p.send(name, labels, metric.GetGauge().GetValue(), "g")
+			case dto.MetricType_UNTYPED:
+				p.send(name, labels, metric.GetUntyped().GetValue(), "g")
+			case dto.MetricType_HISTOGRAM:
+				h := metric.GetHistogram()
+				p.counter(name+"_count", labels, float64(h.GetSampleCount()))
+				p.counter(name+"_sum", labels, h.GetSampleSum())
+			case dto.MetricType_SUMMARY:
+				s := metric.GetSummary()
+				p.counter(name+"_count", labels, float64(s.GetSampleCount()))
+				p.counter(name+"_sum", labels, s.GetSampleSum())
+			}
+		}
+	}
+	p.flush()
+	p.primed = true
+}
+
+// counter sends the increase of a counter since the last push. The first
+// push only records the values, since the agent may have seen what happened
+// before a restart, while series appearing later started from zero.
+func (p *statsdPusher) counter(name string, labels []*dto.LabelPair, value float64) {
+	key := name + labelKey(labels)
+	last := p.last[key]
+	p.last[key] = value
+	if !p.primed || value <= last {
+		// nothing new, or the counter was reset
+		return
+	}
+	p.send(name, labels, value-last, "c")
+}
+
+func (p *statsdPusher) send(name string, labels []*dto.LabelPair, value float64, kind string) {
+	var line strings.Builder
+	line.WriteString(sanitize(p.cfg.Prefix + name))
+	if p.cfg.Flavor == StatsD {
+		for _, l := range labels {
+			line.WriteString("." + sanitize(l.GetValue()))
+		}
+	}
+	line.WriteString(":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind)
+	if p.cfg.Flavor == DogStatsD {
+		tags := append([]string(nil), p.cfg.Tags...)
+		for _, l := range labels {
+			tags = append(tags, l.GetName()+":"+l.GetValue())
+		}
+		if len(tags) > 0 {
+			line.WriteString("|#" + strings.Join(tags, ","))
+		}
+	}
+	if p.buf.Len() > 0 && p.buf.Len()+1+line.Len() > maxPacket {
+		p.flush()
+	}
+	if p.buf.Len() > 0 {
+		p.buf.WriteByte('\n')
+	}
+	p.buf.WriteString(line.String())
+}
+
+func (p *statsdPusher) flush() {
+	if p.buf.Len() == 0 {
+		return
+	}
+	if _, err := p.conn.Write(p.buf.Bytes()); err != nil {
+		slog.Warn("pushing metrics to statsd", "error", err)
+	}
+	p.buf.Reset()
+}
+
+func labelKey(labels []*dto.LabelPair) string {
+	pairs := make([]string, len(labels))
+	for i, l := range labels {
+		pairs[i] = l.GetName() + "=" + l.GetValue()
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sanitize replaces the characters the StatsD line format reserves
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,204 @@
+// Package mirror forwards a sampled copy of live requests to a secondary
+// backend in the background, to load test a new deployment or compare a
+// rewritten implementation with real traffic. The secondary's responses are
+// discarded and never reach clients, and a slow or failing secondary never
+// slows down the primary: when the queue is full copies are dropped.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/httpclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxBody bounds the bodies that are mirrored, larger requests are skipped
+const maxBody = 1 << 20
+
+// forwardedHeaders are the request headers that affect responses. Anything
+// identifying the caller, like API keys, is left out.
+var forwardedHeaders = []string{"Content-Type", "Accept", "API-Version"}
+
+// Options configures a Mirror
+type Options struct {
+	// Target is the base URL of the secondary backend, request paths are
+	// appended to it
+	Target string
+	// Sample is the share of requests mirrored, defaults to all
+	Sample float64
+	// Sanitize rewrites request URIs and bodies before they leave, e.g. to
+	// replace card numbers with synthetic ones
+	Sanitize func([]byte) []byte
+	// Header is added to every mirrored request, e.g. an API key for the
+	// secondary
+	Header http.Header
+	// Queue is how many copies may wait to be sent, defaults to 256
+	Queue int
+	// Workers is how many copies are sent at once, defaults to 4
+	Workers int
+	// Timeout bounds sending one copy, defaults to 5s
+	Timeout time.Duration
+}
+
+// copied is a request waiting to be mirrored
+type copied struct {
+	method string
+	uri    string
+	header http.Header
+	body   []byte
+}
+
+// Mirror copies requests to the target
+type Mirror struct {
+	opts   Options
+	target *url.URL
+	client *http.Client
+	total  *prometheus.CounterVec
+
+	mu     sync.RWMutex
+	queue  chan copied
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New starts the workers sending copies to opts.Target and registers the
+// mirror_requests_total metric with reg
+func New(opts Options, reg prometheus.Registerer) (*Mirror, error) {
+	target, err := url.Parse(opts.Target)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, errors.New("mirror target must be an http or https URL")
+	}
+	if opts.Sample <= 0 || opts.Sample > 1 {
+		opts.Sample = 1
+	}
+	if opts.Sanitize == nil {
+		opts.Sanitize = func(b []byte) []byte { return b }
+	}
+	if opts.Queue <= 0 {
+		opts.Queue = 256
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	mr := &Mirror{
+		opts:   opts,
+		target: target,
+		// a copy that fails is not worth retrying, it would only add load
+		client: httpclient.New(httpclient.Options{Timeout: opts.Timeout, Retries: -1}),
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mirror_requests_total",
+			Help: "Requests copied to the mirror target by outcome: sent, failed or dropped.",
+		}, []string{"outcome"}),
+		queue: make(chan copied, opts.Queue),
+	}
+	reg.MustRegister(mr.total)
+	for i := 0; i < opts.Workers; i++ {
+		mr.wg.Add(1)
+		go mr.work()
+	}
+	return mr, nil
+}
+
+// Middleware queues a copy of a sample of the requests it serves
+func (mr *Mirror) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() >= mr.opts.Sample {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if len(body) <= maxBody {
+			c := copied{method: r.Method, uri: string(mr.opts.Sanitize([]byte(r.URL.RequestURI()))), header: make(http.Header), body: mr.opts.Sanitize(body)}
+			for _, h := range forwardedHeaders {
+				if v := r.Header.Get(h); v != "" {
+					c.header.Set(h, v)
+				}
+			}
+			mr.enqueue(c)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// enqueue hands c to the workers unless they're all busy
+func (mr *Mirror) enqueue(c copied) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	if mr.closed {
+		return
+	}
+	select {
+	case mr.queue <- c:
+	default:
+		mr.total.WithLabelValues("dropped").Inc()
+	}
+}
+
+func (mr *Mirror) work() {
+	defer mr.wg.Done()
+	for c := range mr.queue {
+		if err := mr.send(c); err != nil {
+			mr.total.WithLabelValues("failed").Inc()
+			continue
+		}
+		mr.total.WithLabelValues("sent").Inc()
+	}
+}
+
+func (mr *Mirror) send(c copied) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mr.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, c.method, strings.TrimSuffix(mr.target.String(), "/")+c.uri, bytes.NewReader(c.body))
+	if err != nil {
+		return err
+	}
+	req.Header = c.header
+	for k, vs := range mr.opts.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("X-Mirrored", "true")
+	resp, err := mr.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 500 {
+		return errors.New("mirror target answered " + resp.Status)
+	}
+	return nil
+}
+
+// Close stops mirroring and waits for the queued copies to be sent
+func (mr *Mirror) Close() error {
+	mr.mu.Lock()
+	if mr.closed {
+		mr.mu.Unlock()
+		return nil
+	}
+	mr.closed = true
+	close(mr.queue)
+	mr.mu.Unlock()
+	mr.wg.Wait()
+	return nil
+}
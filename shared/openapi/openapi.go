@@ -0,0 +1,218 @@
+// Package openapi describes the HTTP API of a service as an OpenAPI 3.1
+// document and serves it together with Swagger UI. Request and response
+// bodies are described by the JSON Schemas package schema generates from the
+// structs handlers decode and encode, so the document can't drift from the
+// code.
+package openapi
+
+import (
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/respond"
+	"github.com/ixmorrow/go-projects/shared/schema"
+)
+
+// Version is the OpenAPI version documents are written in
+const Version = "3.1.0"
+
+// Names of the security schemes every document declares
+const (
+	APIKeyScheme = "apiKey"
+	BearerScheme = "bearer"
+)
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components holds the security schemes operations refer to
+type Components struct {
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way for callers to authenticate
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// Operation is one method on one path
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *schema.Schema `json:"schema"`
+}
+
+// RequestBody describes what an operation reads
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one status code an operation answers with
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body in one format
+type MediaType struct {
+	Schema *schema.Schema `json:"schema"`
+}
+
+// Spec collects the operations of a service
+type Spec struct {
+	mu  sync.Mutex
+	doc Document
+}
+
+// New creates a Spec for the API title at version, declaring the API key
+// and bearer token security schemes of package auth
+func New(title, version, description string) *Spec {
+	return &Spec{doc: Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version, Description: description},
+		Paths:   make(map[string]map[string]*Operation),
+		Components: Components{SecuritySchemes: map[string]SecurityScheme{
+			APIKeyScheme: {Type: "apiKey", In: "header", Name: auth.APIKeyHeader},
+			BearerScheme: {Type: "http", Scheme: "bearer"},
+		}},
+	}}
+}
+
+// Add documents op as method on path, a mux path template. Operations
+// without responses are documented as answering 200 with no body.
+func (s *Spec) Add(method, path string, op Operation) {
+	if op.Responses == nil {
+		op.Responses = map[string]Response{"200": {Description: "OK"}}
+	}
+	for _, name := range pathParams(path) {
+		op.Parameters = append(op.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &schema.Schema{Type: "string"}})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.doc.Paths[path]
+	if !ok {
+		item = make(map[string]*Operation)
+		s.doc.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = &op
+}
+
+// pathParams lists the variables of a mux path template like /jobs/{id}
+func pathParams(path string) []string {
+	var names []string
+	for {
+		start := strings.IndexByte(path, '{')
+		end := strings.IndexByte(path, '}')
+		if start < 0 || end < start {
+			return names
+		}
+		name, _, _ := strings.Cut(path[start+1:end], ":")
+		names = append(names, name)
+		path = path[end+1:]
+	}
+}
+
+// Document returns the document as collected so far
+func (s *Spec) Document() Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.doc
+}
+
+// Handler serves the document as JSON
+func (s *Spec) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond.JSON(w, http.StatusOK, s.Document())
+	})
+}
+
+// Authenticated is the security of operations accepting an API key or a
+// bearer token
+func Authenticated() []map[string][]string {
+	return []map[string][]string{{APIKeyScheme: {}}, {BearerScheme: {}}}
+}
+
+// Body describes a required JSON request body holding a T
+func Body[T any]() *RequestBody {
+	return &RequestBody{Required: true, Content: jsonContent(reflect.TypeOf((*T)(nil)).Elem())}
+}
+
+// JSON describes a JSON response holding a T
+func JSON[T any](description string) Response {
+	return Response{Description: description, Content: jsonContent(reflect.TypeOf((*T)(nil)).Elem())}
+}
+
+// Error describes an error response with package respond's body
+func Error(description string) Response {
+	return JSON[respond.ErrorBody](description)
+}
+
+func jsonContent(t reflect.Type) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema.Of(t)}}
+}
+
+// Query describes a query parameter of type typ, a JSON Schema type
+func Query(name, typ, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &schema.Schema{Type: typ}}
+}
+
+// swaggerUI loads Swagger UI from a CDN, so nothing needs vendoring, and
+// points it at the document
+var swaggerUI = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+<script>
+window.onload = () => { window.ui = SwaggerUIBundle({ url: {{.URL}}, dom_id: "#swagger-ui" }) }
+</script>
+</body>
+</html>
+`))
+
+// UI serves Swagger UI showing the document served at url
+func (s *Spec) UI(url string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		swaggerUI.Execute(w, struct{ Title, URL string }{s.Document().Info.Title, url})
+	})
+}
@@ -0,0 +1,268 @@
+// Package ratelimit provides token-bucket rate limiting middleware keyed by
+// authenticated caller or client IP.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// KeyFunc extracts the key a request is rate limited by
+type KeyFunc func(r *http.Request) string
+
+// Config configures a Limiter. Each route group gets its own Config so cheap
+// and expensive routes can be limited independently.
+type Config struct {
+	// Rate is the number of requests per second a key may sustain
+	Rate float64
+	// Burst is the maximum number of requests a key may make at once
+	Burst int
+	// KeyFunc picks the bucket for a request, defaults to ByPrincipalOrIP
+	// with the client IP taken from behind TrustedProxies
+	KeyFunc KeyFunc
+	// TrustedProxies lists the reverse proxies in front of the service.
+	// Requests coming through them are keyed by the client address they
+	// forward instead of their own, so all clients don't share one bucket.
+	TrustedProxies []netip.Prefix
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// rate and burst the bucket was last used with, for sweeping
+	rate  float64
+	burst float64
+}
+
+// Limits overrides the rate and burst for the callers of one tenant
+type Limits struct {
+	Rate  float64
+	Burst int
+}
+
+// Limiter tracks one token bucket per key
+type Limiter struct {
+	rate    float64
+	burst   float64
+	keyFunc KeyFunc
+	tenants map[string]Limits
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New creates a Limiter from cfg
+func New(cfg Config) *Limiter {
+	if cfg.KeyFunc == nil {
+		cfg.KeyFunc = byPrincipalOr(ClientIPBehind(cfg.TrustedProxies))
+	}
+	if cfg.Burst < 1 {
+		cfg.Burst = 1
+	}
+	return &Limiter{
+		rate:      cfg.Rate,
+		burst:     float64(cfg.Burst),
+		keyFunc:   cfg.KeyFunc,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// SetLimits changes the rate and burst, e.g. after a configuration reload.
+// Existing buckets keep their tokens, capped at the new burst.
+func (l *Limiter) SetLimits(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+	l.burst = float64(burst)
+	for _, b := range l.buckets {
+		b.tokens = math.Min(l.burst, b.tokens)
+	}
+}
+
+// SetTenantLimits replaces the per-tenant overrides. Tenants are taken from
+// the authenticated caller, so the limiter has to run after authentication
+// for overrides to apply.
+func (l *Limiter) SetTenantLimits(tenants map[string]Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tenants = tenants
+}
+
+// Allow takes a token from the bucket for key. When the bucket is empty it
+// returns false and how long the caller should wait before retrying.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	return l.allow(key, "")
+}
+
+func (l *Limiter) allow(key, tenant string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rate, burst := l.rate, l.burst
+	if t, ok := l.tenants[tenant]; ok && tenant != "" {
+		rate, burst = t.Rate, math.Max(1, float64(t.Burst))
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+	}
+	b.rate, b.burst = rate, burst
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if rate <= 0 {
+		return false, time.Minute
+	}
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have been idle long enough to refill completely,
+// so memory doesn't grow with every client ever seen
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware rejects requests over the limit with 429 Too Many Requests and a
+// Retry-After header
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.allow(l.keyFunc(r), auth.Tenant(r.Context()))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respond.Error(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ByClientIP keys requests by the remote address of the connection
+func ByClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIPBehind keys requests by client IP like ByClientIP, except that
+// requests from one of proxies are keyed by the address in X-Forwarded-For.
+// The header is read from the right, skipping further trusted proxies, as
+// the entries to the left of the first untrusted one can be made up by the
+// client.
+func ClientIPBehind(proxies []netip.Prefix) KeyFunc {
+	if len(proxies) == 0 {
+		return ByClientIP
+	}
+	return func(r *http.Request) string {
+		ip := ByClientIP(r)
+		if !trusted(ip, proxies) {
+			return ip
+		}
+		var hops []string
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(v, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip = hops[i]
+			if !trusted(ip, proxies) {
+				break
+			}
+		}
+		return ip
+	}
+}
+
+func trusted(ip string, proxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseProxies parses a list of proxy addresses and CIDR ranges for
+// Config.TrustedProxies
+func ParseProxies(list []string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("ratelimit: trusted proxy %q: %w", s, err)
+			}
+			addr = addr.Unmap()
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: trusted proxy %q: %w", s, err)
+		}
+		proxies = append(proxies, p.Masked())
+	}
+	return proxies, nil
+}
+
+// ByPrincipalOrIP keys requests by the caller authentication put in their
+// context and falls back to the client IP otherwise. Credentials the
+// request merely claims are never used, or every made up API key would get
+// a fresh bucket, so the limiter belongs after authentication.
+func ByPrincipalOrIP(r *http.Request) string {
+	return byPrincipalOr(ByClientIP)(r)
+}
+
+func byPrincipalOr(clientIP KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		if p, ok := auth.FromContext(r.Context()); ok && p.ID != "" {
+			return "principal:" + p.ID
+		}
+		return "ip:" + clientIP(r)
+	}
+}
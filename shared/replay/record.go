@@ -0,0 +1,167 @@
+// Package replay records sanitized request and response pairs from real
+// traffic and replays them against another build, to check that an upgrade
+// doesn't change the answers clients get.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxBody bounds the bodies that are recorded, larger exchanges are skipped
+const maxBody = 1 << 20
+
+// recordedHeaders are the request headers that affect responses. Anything
+// identifying the caller, like API keys, is left out.
+var recordedHeaders = []string{"Content-Type", "Accept", "API-Version"}
+
+// Exchange is a recorded request with the response it got
+type Exchange struct {
+	Time     time.Time `json:"time"`
+	Request  Request   `json:"request"`
+	Response Response  `json:"response"`
+}
+
+// Request is the recorded part of a request
+type Request struct {
+	Method string            `json:"method"`
+	URI    string            `json:"uri"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   []byte            `json:"body,omitempty"`
+}
+
+// Response is the recorded part of a response
+type Response struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Options configures a Recorder
+type Options struct {
+	// Sample is the share of requests recorded, defaults to all
+	Sample float64
+	// Sanitize rewrites request URIs and request and response bodies before
+	// they are written, e.g. to replace card numbers with synthetic ones
+	Sanitize func([]byte) []byte
+}
+
+// Recorder appends exchanges to a file, one JSON object per line
+type Recorder struct {
+	opts Options
+
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewRecorder records to the file at path, appending to earlier recordings
+func NewRecorder(path string, opts Options) (*Recorder, error) {
+	if opts.Sample <= 0 || opts.Sample > 1 {
+		opts.Sample = 1
+	}
+	if opts.Sanitize == nil {
+		opts.Sanitize = func(b []byte) []byte { return b }
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{opts: opts, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Middleware records a sample of the requests it serves
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() >= rec.opts.Sample {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if len(body) > maxBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tee := &teeWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(tee, r)
+		if tee.body.Len() > maxBody {
+			return
+		}
+
+		ex := Exchange{
+			Time: time.Now().UTC(),
+			Request: Request{
+				Method: r.Method,
+				URI:    string(rec.opts.Sanitize([]byte(r.URL.RequestURI()))),
+				Header: make(map[string]string),
+				Body:   rec.opts.Sanitize(body),
+			},
+			Response: Response{
+				Status:      tee.status,
+				ContentType: w.Header().Get("Content-Type"),
+				Body:        rec.opts.Sanitize(tee.body.Bytes()),
+			},
+		}
+		for _, h := range recordedHeaders {
+			if v := r.Header.Get(h); v != "" {
+				ex.Request.Header[h] = v
+			}
+		}
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if rec.f == nil {
+			return
+		}
+		if err := rec.enc.Encode(ex); err != nil {
+			slog.ErrorContext(r.Context(), "recording exchange", "error", err)
+		}
+	})
+}
+
+// Close stops recording
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.f == nil {
+		return nil
+	}
+	err := rec.f.Close()
+	rec.f = nil
+	return err
+}
+
+// teeWriter copies the response it writes, up to just past maxBody
+type teeWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (t *teeWriter) WriteHeader(status int) {
+	t.status = status
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *teeWriter) Write(b []byte) (int, error) {
+	if t.body.Len() <= maxBody {
+		t.body.Write(b)
+	}
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *teeWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
@@ -0,0 +1,107 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Mismatch is a replayed exchange whose response differs from the recorded
+// one
+type Mismatch struct {
+	// Line is the exchange's line in the recording
+	Line     int
+	Request  Request
+	Expected Response
+	Got      Response
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("line %d: %s %s: expected %d %s, got %d %s",
+		m.Line, m.Request.Method, m.Request.URI,
+		m.Expected.Status, bytes.TrimSpace(m.Expected.Body), m.Got.Status, bytes.TrimSpace(m.Got.Body))
+}
+
+// Target is the build exchanges are replayed against
+type Target struct {
+	// BaseURL is where the build serves, e.g. http://localhost:8000
+	BaseURL string
+	// Header is added to every request, e.g. an API key
+	Header http.Header
+	Client *http.Client
+}
+
+// Replay sends every exchange recorded in the file at path to t and returns
+// the ones whose status or body differ. JSON bodies are compared by value,
+// other bodies byte for byte.
+func Replay(ctx context.Context, path string, t Target) (replayed int, mismatches []Mismatch, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	if t.Client == nil {
+		t.Client = http.DefaultClient
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 4*maxBody)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal(sc.Bytes(), &ex); err != nil {
+			return replayed, mismatches, fmt.Errorf("line %d: %w", line, err)
+		}
+		got, err := t.send(ctx, ex.Request)
+		if err != nil {
+			return replayed, mismatches, fmt.Errorf("line %d: %w", line, err)
+		}
+		replayed++
+		if got.Status != ex.Response.Status || !sameBody(ex.Response, got) {
+			mismatches = append(mismatches, Mismatch{Line: line, Request: ex.Request, Expected: ex.Response, Got: got})
+		}
+	}
+	return replayed, mismatches, sc.Err()
+}
+
+func (t Target) send(ctx context.Context, r Request) (Response, error) {
+	req, err := http.NewRequestWithContext(ctx, r.Method, strings.TrimSuffix(t.BaseURL, "/")+r.URI, bytes.NewReader(r.Body))
+	if err != nil {
+		return Response{}, err
+	}
+	for k, v := range t.Header {
+		req.Header[k] = v
+	}
+	for k, v := range r.Header {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), Body: body}, nil
+}
+
+func sameBody(expected, got Response) bool {
+	if strings.HasPrefix(expected.ContentType, "application/json") {
+		var a, b any
+		if json.Unmarshal(expected.Body, &a) == nil && json.Unmarshal(got.Body, &b) == nil {
+			return reflect.DeepEqual(a, b)
+		}
+	}
+	return bytes.Equal(expected.Body, got.Body)
+}
@@ -0,0 +1,39 @@
+package respond
+
+import "net/http"
+
+// Recorder wraps a ResponseWriter to remember the status code and number of
+// bytes written, for middleware that logs or measures responses
+type Recorder struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int
+}
+
+// NewRecorder wraps w
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	r.Status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (r *Recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,28 @@
+// Package respond contains small helpers for writing HTTP responses that are
+// shared by the services in this repo.
+package respond
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+)
+
+// ErrorBody is the JSON shape returned for every error response. In XML it
+// is <error><message>...</message></error>.
+type ErrorBody struct {
+	XMLName xml.Name `json:"-" xml:"error"`
+	Error   string   `json:"error" xml:"message"`
+}
+
+// JSON writes v as a JSON response with the given status code
+func JSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Error writes a JSON error response with the given status code
+func Error(w http.ResponseWriter, status int, msg string) {
+	JSON(w, status, ErrorBody{Error: msg})
+}
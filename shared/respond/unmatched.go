@@ -0,0 +1,40 @@
+package respond
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// methods are the methods Unmatched tries when looking for the ones a path
+// allows
+var methods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Unmatched answers the requests no route of router takes: with 405 and an
+// Allow header when the path has routes for other methods, and with 404
+// otherwise, both in JSON. Set it as router.NotFoundHandler. mux finds
+// method mismatches itself only while no subrouter comes after the route,
+// so it can't be left to MethodNotAllowedHandler.
+func Unmatched(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range methods {
+			if method == r.Method {
+				continue
+			}
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			var match mux.RouteMatch
+			if router.Match(probe, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+		if len(allowed) == 0 {
+			Error(w, http.StatusNotFound, "no such endpoint: "+r.URL.Path)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		Error(w, http.StatusMethodNotAllowed, r.Method+" is not allowed here, use "+strings.Join(allowed, " or "))
+	})
+}
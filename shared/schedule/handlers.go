@@ -0,0 +1,72 @@
+package schedule
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// Report is the state of the scheduler as seen from one replica
+type Report struct {
+	Holder string       `json:"holder"`
+	Leader bool         `json:"leader"`
+	Tasks  []TaskReport `json:"tasks"`
+}
+
+// TaskReport is a scheduled task with its latest runs
+type TaskReport struct {
+	Name    string    `json:"name"`
+	Every   string    `json:"every"`
+	NextRun time.Time `json:"nextRun"`
+	Runs    []Run     `json:"runs"`
+}
+
+// RegisterAdminRoutes adds the scheduler state and run history to r, which
+// is normally the /admin subrouter. Tasks are service wide, so only
+// operators may see them.
+//
+//	GET /schedule  the tasks with their last ?limit= runs, 10 by default
+func RegisterAdminRoutes(r *mux.Router, s *Scheduler) {
+	r.HandleFunc("/schedule", report(s)).Methods("GET")
+}
+
+func report(s *Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, _ := auth.FromContext(r.Context()); !p.Operator() {
+			respond.Error(w, http.StatusForbidden, "only operators can see scheduled tasks")
+			return
+		}
+		limit := 10
+		if l := r.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n <= 0 {
+				respond.Error(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = n
+		}
+		now := time.Now().UTC()
+		rep := Report{Holder: s.Holder(), Leader: s.Leader(), Tasks: []TaskReport{}}
+		for _, t := range s.Tasks() {
+			runs, err := s.Store().Runs(r.Context(), t.Name, limit)
+			if err != nil {
+				respond.Error(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if runs == nil {
+				runs = []Run{}
+			}
+			rep.Tasks = append(rep.Tasks, TaskReport{
+				Name:    t.Name,
+				Every:   t.Every.String(),
+				NextRun: now.Truncate(t.Every).Add(t.Every),
+				Runs:    runs,
+			})
+		}
+		respond.JSON(w, http.StatusOK, rep)
+	}
+}
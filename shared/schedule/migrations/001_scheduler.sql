@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS scheduler_leases (
+	name TEXT PRIMARY KEY,
+	holder TEXT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS scheduler_runs (
+	task TEXT NOT NULL,
+	slot BIGINT NOT NULL,
+	holder TEXT NOT NULL,
+	status TEXT NOT NULL,
+	error TEXT NOT NULL,
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (task, slot)
+);
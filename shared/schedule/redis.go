@@ -0,0 +1,114 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// runTTL is how long Redis keeps the record of a run
+const runTTL = 30 * 24 * time.Hour
+
+// renewLease extends the lease only if its holder asks
+var renewLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseLease deletes the lease only if its holder asks
+var releaseLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// RedisStore coordinates replicas through Redis. The lease is a key that
+// expires, runs are kept as JSON for 30 days with a list of the latest per
+// task.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore uses client, namespacing keys with prefix
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix + "scheduler:"}
+}
+
+func (s *RedisStore) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	key := s.prefix + "lease"
+	ok, err := s.client.SetNX(ctx, key, holder, ttl).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+	renewed, err := renewLease.Run(ctx, s.client, []string{key}, holder, ttl.Milliseconds()).Int()
+	return renewed == 1, err
+}
+
+func (s *RedisStore) Release(ctx context.Context, holder string) error {
+	return releaseLease.Run(ctx, s.client, []string{s.prefix + "lease"}, holder).Err()
+}
+
+func (s *RedisStore) runKey(run Run) string {
+	return s.prefix + "run:" + run.Task + ":" + strconv.FormatInt(run.Slot.UnixMilli(), 10)
+}
+
+func (s *RedisStore) Claim(ctx context.Context, run Run) (bool, error) {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return false, err
+	}
+	key := s.runKey(run)
+	ok, err := s.client.SetNX(ctx, key, data, runTTL).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+	list := s.prefix + "runs:" + run.Task
+	_, err = s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, list, key)
+		p.LTrim(ctx, list, 0, keepRuns-1)
+		return nil
+	})
+	return true, err
+}
+
+func (s *RedisStore) Finish(ctx context.Context, run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.runKey(run), data, redis.KeepTTL).Err()
+}
+
+func (s *RedisStore) Runs(ctx context.Context, task string, limit int) ([]Run, error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+	keys, err := s.client.LRange(ctx, s.prefix+"runs:"+task, 0, stop).Result()
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var runs []Run
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			// expired
+			continue
+		}
+		var r Run
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, nil
+}
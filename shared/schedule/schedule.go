@@ -0,0 +1,272 @@
+// Package schedule runs periodic tasks, such as data refreshes and
+// clean-ups, exactly once per interval across all replicas of a service.
+// The replicas elect a leader through a shared lease in the database or
+// Redis and only the leader runs tasks. Every run is claimed in the shared
+// store first, so a run isn't repeated when leadership changes hands
+// mid-interval.
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Status is the state of a run
+type Status string
+
+const (
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+)
+
+// Run is one execution of a task
+type Run struct {
+	Task string `json:"task"`
+	// Slot is the start of the interval the run belongs to
+	Slot time.Time `json:"slot"`
+	// Holder identifies the replica that ran the task
+	Holder     string    `json:"holder"`
+	Status     Status    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// Store coordinates the replicas and keeps the run history
+type Store interface {
+	// Acquire takes the leader lease for holder, or extends it if holder
+	// already has it, and reports whether holder is the leader
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lease if holder has it
+	Release(ctx context.Context, holder string) error
+	// Claim records run as started and reports false when a run of the
+	// same task and slot was claimed before
+	Claim(ctx context.Context, run Run) (bool, error)
+	// Finish records the outcome of a claimed run
+	Finish(ctx context.Context, run Run) error
+	// Runs lists the latest runs of task, newest first
+	Runs(ctx context.Context, task string, limit int) ([]Run, error)
+}
+
+// Task is a function run every interval
+type Task struct {
+	Name  string
+	Every time.Duration
+	Run   func(ctx context.Context) error
+}
+
+// Options configures a Scheduler. Zero values take the defaults.
+type Options struct {
+	// Holder identifies this replica, defaults to the host name and
+	// process ID
+	Holder string
+	// LeaseTTL is how long leadership lasts without being renewed, which
+	// bounds how long tasks stall when the leader dies. Defaults to 30s.
+	LeaseTTL time.Duration
+}
+
+// checkEvery is how often the scheduler looks for due tasks
+const checkEvery = time.Second
+
+// Scheduler runs tasks while this replica is the leader
+type Scheduler struct {
+	store  Store
+	opts   Options
+	leader atomic.Bool
+
+	mu      sync.Mutex
+	tasks   []Task
+	last    map[string]time.Time
+	running map[string]bool
+
+	runs        *prometheus.CounterVec
+	leaderGauge prometheus.GaugeFunc
+}
+
+// New creates a scheduler coordinating through store
+func New(store Store, opts Options) *Scheduler {
+	if opts.Holder == "" {
+		host, _ := os.Hostname()
+		opts.Holder = host + "-" + strconv.Itoa(os.Getpid())
+	}
+	if opts.LeaseTTL <= 0 {
+		opts.LeaseTTL = 30 * time.Second
+	}
+	s := &Scheduler{
+		store:   store,
+		opts:    opts,
+		last:    make(map[string]time.Time),
+		running: make(map[string]bool),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_runs_total",
+			Help: "Scheduled task runs on this replica by task and status.",
+		}, []string{"task", "status"}),
+	}
+	s.leaderGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "scheduler_leader",
+		Help: "1 while this replica is the scheduler leader.",
+	}, func() float64 {
+		if s.leader.Load() {
+			return 1
+		}
+		return 0
+	})
+	return s
+}
+
+// Register adds the scheduler metrics to reg
+func (s *Scheduler) Register(reg prometheus.Registerer) {
+	reg.MustRegister(s.runs, s.leaderGauge)
+}
+
+// Add schedules run every interval under name. Intervals start at fixed
+// times, e.g. on the hour for an hourly task, so every replica agrees on
+// them. A run is cancelled when its interval is over.
+func (s *Scheduler) Add(name string, every time.Duration, run func(ctx context.Context) error) {
+	if every <= 0 {
+		panic(fmt.Sprintf("schedule: task %s needs a positive interval", name))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, Task{Name: name, Every: every, Run: run})
+}
+
+// Tasks lists the scheduled tasks
+func (s *Scheduler) Tasks() []Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Task(nil), s.tasks...)
+}
+
+// Leader reports whether this replica currently runs the tasks
+func (s *Scheduler) Leader() bool {
+	return s.leader.Load()
+}
+
+// Holder identifies this replica
+func (s *Scheduler) Holder() string {
+	return s.opts.Holder
+}
+
+// Store is where runs are recorded
+func (s *Scheduler) Store() Store {
+	return s.store
+}
+
+// Run campaigns for leadership and runs due tasks until ctx is done, then
+// gives up the lease so another replica takes over straight away
+func (s *Scheduler) Run(ctx context.Context) {
+	renew := time.NewTicker(s.opts.LeaseTTL / 3)
+	defer renew.Stop()
+	check := time.NewTicker(checkEvery)
+	defer check.Stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s.campaign(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			if s.leader.Swap(false) {
+				release, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := s.store.Release(release, s.opts.Holder); err != nil {
+					slog.Warn("releasing scheduler lease", "error", err)
+				}
+				cancel()
+			}
+			return
+		case <-renew.C:
+			s.campaign(ctx)
+		case now := <-check.C:
+			if s.leader.Load() {
+				s.runDue(ctx, now, &wg)
+			}
+		}
+	}
+}
+
+// campaign takes or renews the lease
+func (s *Scheduler) campaign(ctx context.Context) {
+	ok, err := s.store.Acquire(ctx, s.opts.Holder, s.opts.LeaseTTL)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		slog.Warn("acquiring scheduler lease", "error", err)
+	}
+	if was := s.leader.Swap(ok); was != ok {
+		slog.Info("scheduler leadership changed", "leader", ok, "holder", s.opts.Holder)
+	}
+}
+
+// runDue starts every task whose current interval hasn't been claimed yet
+func (s *Scheduler) runDue(ctx context.Context, now time.Time, wg *sync.WaitGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		slot := now.Truncate(t.Every).UTC()
+		if s.running[t.Name] || !s.last[t.Name].Before(slot) {
+			continue
+		}
+		s.last[t.Name] = slot
+		run := Run{Task: t.Name, Slot: slot, Holder: s.opts.Holder, Status: Running, StartedAt: time.Now().UTC()}
+		claimed, err := s.store.Claim(ctx, run)
+		if err != nil {
+			slog.Warn("claiming scheduled run", "task", t.Name, "error", err)
+			// try again on the next check
+			delete(s.last, t.Name)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		s.running[t.Name] = true
+		wg.Add(1)
+		go func(t Task, run Run) {
+			defer wg.Done()
+			s.execute(ctx, t, run)
+		}(t, run)
+	}
+}
+
+// execute runs t, bounded by its interval, and records the outcome
+func (s *Scheduler) execute(ctx context.Context, t Task, run Run) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, t.Name)
+		s.mu.Unlock()
+	}()
+	taskCtx, cancel := context.WithTimeout(ctx, t.Every)
+	err := runTask(taskCtx, t)
+	cancel()
+
+	run.FinishedAt = time.Now().UTC()
+	run.Status = Succeeded
+	if err != nil {
+		run.Status, run.Error = Failed, err.Error()
+		slog.Error("scheduled task failed", "task", t.Name, "error", err)
+	}
+	s.runs.WithLabelValues(t.Name, string(run.Status)).Inc()
+	finish, cancelFinish := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFinish()
+	if err := s.store.Finish(finish, run); err != nil {
+		slog.Warn("recording scheduled run", "task", t.Name, "error", err)
+	}
+}
+
+// runTask turns a panicking task into a failed run
+func runTask(ctx context.Context, t Task) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return t.Run(ctx)
+}
@@ -0,0 +1,175 @@
+package schedule
+
+import (
+	"context"
+	"embed"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/storage"
+)
+
+// keepRuns is how many runs of a task the memory store remembers
+const keepRuns = 100
+
+// MemoryStore coordinates the schedulers of a single process, so it only
+// suits a service running one replica
+type MemoryStore struct {
+	mu      sync.Mutex
+	holder  string
+	expires time.Time
+	runs    map[string][]Run
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{runs: make(map[string][]Run)}
+}
+
+func (s *MemoryStore) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.holder != holder && now.Before(s.expires) {
+		return false, nil
+	}
+	s.holder, s.expires = holder, now.Add(ttl)
+	return true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder == holder {
+		s.holder, s.expires = "", time.Time{}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, run Run) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runs[run.Task] {
+		if r.Slot.Equal(run.Slot) {
+			return false, nil
+		}
+	}
+	runs := append(s.runs[run.Task], run)
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Slot.After(runs[j].Slot) })
+	if len(runs) > keepRuns {
+		runs = runs[:keepRuns]
+	}
+	s.runs[run.Task] = runs
+	return true, nil
+}
+
+func (s *MemoryStore) Finish(ctx context.Context, run Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.runs[run.Task] {
+		if r.Slot.Equal(run.Slot) {
+			s.runs[run.Task][i] = run
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Runs(ctx context.Context, task string, limit int) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := s.runs[task]
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return append([]Run(nil), runs...), nil
+}
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// leaseName is the row of scheduler_leases the replicas compete for
+const leaseName = "scheduler"
+
+// SQLStore coordinates replicas through the shared database
+type SQLStore struct {
+	db *storage.DB
+}
+
+// NewSQLStore migrates the scheduler tables and returns a store using them
+func NewSQLStore(ctx context.Context, db *storage.DB) (*SQLStore, error) {
+	if err := db.Migrate(ctx, "scheduler", migrations, "migrations"); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	// the update only applies when holder already has the lease or it has
+	// expired, so exactly one replica gets a row changed
+	res, err := s.db.Exec(ctx, `INSERT INTO scheduler_leases (name, holder, expires_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			holder = excluded.holder,
+			expires_at = excluded.expires_at
+		WHERE scheduler_leases.holder = excluded.holder OR scheduler_leases.expires_at < ?`,
+		leaseName, holder, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *SQLStore) Release(ctx context.Context, holder string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM scheduler_leases WHERE name = ? AND holder = ?`, leaseName, holder)
+	return err
+}
+
+func (s *SQLStore) Claim(ctx context.Context, run Run) (bool, error) {
+	res, err := s.db.Exec(ctx, `INSERT INTO scheduler_runs (task, slot, holder, status, error, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (task, slot) DO NOTHING`,
+		run.Task, run.Slot.UnixMilli(), run.Holder, string(run.Status), run.Error, run.StartedAt, run.FinishedAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *SQLStore) Finish(ctx context.Context, run Run) error {
+	_, err := s.db.Exec(ctx, `UPDATE scheduler_runs SET status = ?, error = ?, finished_at = ?
+		WHERE task = ? AND slot = ?`,
+		string(run.Status), run.Error, run.FinishedAt, run.Task, run.Slot.UnixMilli())
+	return err
+}
+
+func (s *SQLStore) Runs(ctx context.Context, task string, limit int) ([]Run, error) {
+	query := `SELECT task, slot, holder, status, error, started_at, finished_at
+		FROM scheduler_runs WHERE task = ? ORDER BY slot DESC`
+	args := []any{task}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var runs []Run
+	for rows.Next() {
+		var r Run
+		var slot int64
+		var status string
+		if err := rows.Scan(&r.Task, &slot, &r.Holder, &status, &r.Error, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		r.Slot = time.UnixMilli(slot).UTC()
+		r.Status = Status(status)
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,226 @@
+// Package schema generates JSON Schemas from request structs and validates
+// request bodies against them before handlers run.
+//
+// Field names follow the json tags. Constraints go in a schema tag:
+//
+//	CardNumber string `json:"cardNumber" schema:"required,minLength=12,maxLength=19"`
+//	FoodType   int    `json:"foodType" schema:"enum=0|1|2|3"`
+//
+// Supported constraints are required, minimum, maximum, minLength,
+// maxLength and enum.
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schema is the subset of JSON Schema the generator produces
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"-"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+}
+
+// MarshalJSON writes nullable schemas with a type list, as JSON Schema
+// expects
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type plain Schema
+	if !s.Nullable || s.Type == "" {
+		return json.Marshal((*plain)(s))
+	}
+	return json.Marshal(struct {
+		*plain
+		Type []string `json:"type"`
+	}{(*plain)(s), []string{s.Type, "null"}})
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[reflect.Type]*Schema)
+)
+
+// For returns the schema of T. Schemas are generated once per type.
+func For[T any]() *Schema {
+	return Of(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// Of returns the schema of t
+func Of(t reflect.Type) *Schema {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if s, ok := cache[t]; ok {
+		return s
+	}
+	s := generate(t, make(map[reflect.Type]bool))
+	// a request body of null is never useful
+	s.Nullable = false
+	s.SchemaURI = "https://json-schema.org/draft/2020-12/schema"
+	cache[t] = s
+	return s
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	rawType         = reflect.TypeOf(json.RawMessage{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// generate builds the schema of t. seen guards against recursive types,
+// which are left unconstrained where they repeat.
+func generate(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+	s := &Schema{Nullable: nullable}
+	switch {
+	case t == timeType:
+		s.Type, s.Format = "string", "date-time"
+		return s
+	case t == rawType, reflect.PointerTo(t).Implements(unmarshalerType):
+		// custom decoders can accept anything
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		s.Type = "string"
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.Type = "integer"
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes byte slices as base64 strings
+			s.Type = "string"
+			break
+		}
+		s.Type = "array"
+		s.Items = generate(t.Elem(), seen)
+		// a nil slice encodes as null
+		s.Nullable = s.Nullable || t.Kind() == reflect.Slice
+	case reflect.Map:
+		s.Type = "object"
+		s.AdditionalProperties = generate(t.Elem(), seen)
+		s.Nullable = true
+	case reflect.Struct:
+		if seen[t] {
+			return &Schema{}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		s.Type = "object"
+		s.Properties = make(map[string]*Schema)
+		addFields(s, t, seen)
+	default:
+		// interfaces and anything else accept any value
+		return &Schema{}
+	}
+	return s
+}
+
+// addFields adds the fields of struct t to s, flattening embedded structs
+// the way encoding/json does
+func addFields(s *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			addFields(s, ft, seen)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := generate(f.Type, seen)
+		if applyTag(prop, f.Tag.Get("schema")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+}
+
+// jsonName returns the name in the json tag of f
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name
+}
+
+// applyTag sets the constraints of a schema tag on s and reports whether the
+// field is required
+func applyTag(s *Schema, tag string) bool {
+	required := false
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "required":
+			required = true
+		case "minimum":
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				s.Minimum = &f
+			}
+		case "maximum":
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				s.Maximum = &f
+			}
+		case "minLength":
+			if n, err := strconv.Atoi(value); err == nil {
+				s.MinLength = &n
+			}
+		case "maxLength":
+			if n, err := strconv.Atoi(value); err == nil {
+				s.MaxLength = &n
+			}
+		case "enum":
+			for _, v := range strings.Split(value, "|") {
+				s.Enum = append(s.Enum, enumValue(s.Type, v))
+			}
+		}
+	}
+	return required
+}
+
+// enumValue converts an enum tag value to the JSON type of the field, so
+// numbers compare as numbers
+func enumValue(typ, v string) any {
+	switch typ {
+	case "integer", "number":
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
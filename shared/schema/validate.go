@@ -0,0 +1,271 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ixmorrow/go-projects/shared/codec"
+)
+
+// FieldError is a validation failure at a JSON Pointer into the body
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Pointer + ": " + e.Message
+}
+
+// ErrorBody is the response for bodies failing validation
+type ErrorBody struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// Body returns middleware that validates request bodies against the schema
+// of T and answers 400 with every failing field, in the format the client
+// accepts. Bodies in formats other than JSON are decoded into a T first and
+// that is validated, see validateAs. Unsupported formats are left for the
+// handler to reject.
+func Body[T any]() func(http.Handler) http.Handler {
+	s := For[T]()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := codec.ForRequest(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, codec.MaxBodyBytes))
+			if err != nil {
+				codec.Error(w, r, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			var errs []FieldError
+			if c == codec.JSON || c == codec.Form && looksLikeJSON(data) {
+				errs = s.Validate(data)
+			} else {
+				errs = validateAs[T](s, c, data)
+			}
+			if len(errs) > 0 {
+				codec.Respond(w, r, http.StatusBadRequest, ErrorBody{Error: "invalid request body", Fields: errs})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(data))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// looksLikeJSON reports whether a form body holds a JSON object or array
+// instead of form fields
+func looksLikeJSON(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && (data[0] == '{' || data[0] == '[')
+}
+
+// validateAs checks a body in another format than JSON by decoding it with
+// c into a T and validating that as JSON. Decoding already enforces the
+// types; fields missing from the body are validated as their zero value.
+func validateAs[T any](s *Schema, c codec.Codec, data []byte) []FieldError {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return []FieldError{{Pointer: "", Message: "request body is required"}}
+	}
+	var v T
+	if err := c.Decode(bytes.NewReader(data), &v); err != nil {
+		return []FieldError{{Pointer: "", Message: "malformed " + c.ContentType() + ": " + err.Error()}}
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return []FieldError{{Pointer: "", Message: err.Error()}}
+	}
+	return s.Validate(encoded)
+}
+
+// Validate checks the JSON document data against s
+func (s *Schema) Validate(data []byte) []FieldError {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return []FieldError{{Pointer: "", Message: "request body is required"}}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return []FieldError{{Pointer: "", Message: "malformed JSON: " + err.Error()}}
+	}
+	if dec.More() {
+		return []FieldError{{Pointer: "", Message: "unexpected data after the JSON value"}}
+	}
+	var errs []FieldError
+	s.check(v, "", &errs)
+	return errs
+}
+
+func (s *Schema) check(v any, ptr string, errs *[]FieldError) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+	if v == nil {
+		if s.Type != "" && !s.Nullable {
+			fail("must be %s, not null", article(s.Type))
+		}
+		return
+	}
+
+	switch s.Type {
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("must be a string, not %s", kind(v))
+			return
+		}
+		n := utf8.RuneCountInString(str)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("must be a boolean, not %s", kind(v))
+			return
+		}
+	case "integer", "number":
+		num, ok := v.(json.Number)
+		if !ok {
+			fail("must be %s, not %s", article(s.Type), kind(v))
+			return
+		}
+		f, err := num.Float64()
+		if err != nil {
+			fail("must be %s", article(s.Type))
+			return
+		}
+		if s.Type == "integer" {
+			if _, err := strconv.ParseInt(num.String(), 10, 64); err != nil {
+				fail("must be an integer, not %s", num)
+				return
+			}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			fail("must be an array, not %s", kind(v))
+			return
+		}
+		for i, item := range items {
+			s.Items.check(item, ptr+"/"+strconv.Itoa(i), errs)
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			fail("must be an object, not %s", kind(v))
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				*errs = append(*errs, FieldError{Pointer: ptr + "/" + escape(name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop := s.Properties[name]
+			if prop == nil {
+				prop = s.lookupFold(name)
+			}
+			if prop == nil {
+				prop = s.AdditionalProperties
+			}
+			if prop != nil {
+				prop.check(obj[name], ptr+"/"+escape(name), errs)
+			}
+		}
+	}
+
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		fail("must be one of %s", s.enumList())
+	}
+}
+
+// lookupFold finds a property case-insensitively, since encoding/json
+// decodes keys that way
+func (s *Schema) lookupFold(name string) *Schema {
+	for key, prop := range s.Properties {
+		if strings.EqualFold(key, name) {
+			return prop
+		}
+	}
+	return nil
+}
+
+func (s *Schema) inEnum(v any) bool {
+	if num, ok := v.(json.Number); ok {
+		f, err := num.Float64()
+		if err != nil {
+			return false
+		}
+		v = f
+	}
+	for _, e := range s.Enum {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) enumList() string {
+	values := make([]string, len(s.Enum))
+	for i, e := range s.Enum {
+		values[i] = fmt.Sprint(e)
+	}
+	return strings.Join(values, ", ")
+}
+
+// escape encodes a property name as a JSON Pointer reference token
+func escape(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+func kind(v any) string {
+	switch v.(type) {
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	}
+	return "null"
+}
+
+func article(typ string) string {
+	switch typ {
+	case "integer", "array", "object":
+		return "an " + typ
+	}
+	return "a " + typ
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package server
+
+import "net"
+
+// activationListeners reports no sockets, socket activation is a systemd
+// feature
+func activationListeners() ([]net.Listener, error) {
+	return nil, nil
+}
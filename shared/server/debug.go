@@ -0,0 +1,35 @@
+package server
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// DebugHandler serves the net/http/pprof profiles under /debug/pprof/ and
+// the expvar variables at /debug/vars. It is meant for a separate listener
+// that isn't exposed with the API. With localOnly set, requests from
+// anywhere but a loopback address are refused.
+func DebugHandler(localOnly bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	if !localOnly {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			respond.Error(w, http.StatusForbidden, "debug endpoints are only served to localhost")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
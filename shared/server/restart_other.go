@@ -0,0 +1,31 @@
+//go:build !unix
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+)
+
+// restarts hand over file descriptors, which needs a unix system
+
+// WaitForPrevious returns at once, no process restarts this one here
+func WaitForPrevious(context.Context) error {
+	return nil
+}
+
+func restartSignal(bool) <-chan os.Signal {
+	return nil
+}
+
+func handOver([]net.Listener, []string) error {
+	return errors.New("restarts are not supported on this platform")
+}
+
+func inheritedListeners() (map[string]net.Listener, error) {
+	return nil, nil
+}
+
+func notifyReady() {}
@@ -0,0 +1,197 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// inheritEnv lists the keys of the listeners passed to a restarted
+	// process as a JSON array, in file descriptor order from 3
+	inheritEnv = "SERVER_INHERIT_LISTENERS"
+	// readyEnv is the descriptor a restarted process writes to once it is
+	// serving
+	readyEnv = "SERVER_READY_FD"
+	// readyTimeout bounds how long the new process may take to start
+	readyTimeout = time.Minute
+)
+
+// previous is the process that restarted this one, or 0. It's read before
+// inheritedListeners unsets inheritEnv.
+var previous = func() int {
+	if _, ok := os.LookupEnv(inheritEnv); !ok {
+		return 0
+	}
+	return os.Getppid()
+}()
+
+// WaitForPrevious returns once the process that restarted this one has
+// exited, at once when there's none, or with ctx's error when ctx is done
+// first. Only the listeners of the Restartable server are handed over, so
+// other servers of the process, like the debug listener, wait for it before
+// listening on addresses the previous process still holds.
+func WaitForPrevious(ctx context.Context) error {
+	if previous == 0 {
+		return nil
+	}
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	// the process is reparented once its parent exits
+	for os.Getppid() == previous {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return nil
+}
+
+func restartSignal(enabled bool) <-chan os.Signal {
+	if !enabled {
+		return nil
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
+	return c
+}
+
+// handOver starts the current binary with the same arguments, passing it
+// listeners, and waits until it is serving. The listeners stay open here
+// until shutdown, so connections queue up rather than being refused in
+// between.
+//
+// Under systemd the new process outlives the old main PID, so the unit
+// needs a socket unit or NotifyAccess=all with the restart done by the
+// deploy tooling.
+func handOver(listeners []net.Listener, keys []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range listeners {
+		fl, ok := l.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("can't pass a %T to a new process", l)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	files = append(files, readyW)
+	encoded, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		inheritEnv+"="+string(encoded),
+		readyEnv+"="+strconv.Itoa(3+len(listeners)),
+	)
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// only the new process holds the write end now, so reading sees EOF if
+	// it exits before it is ready
+	readyW.Close()
+	files = files[:len(files)-1]
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		readErr <- err
+	}()
+	select {
+	case err := <-readErr:
+		if err != nil {
+			cmd.Wait()
+			return fmt.Errorf("new process exited before it was ready: %s", cmd.ProcessState)
+		}
+	case <-time.After(readyTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return errors.New("new process wasn't ready in time")
+	}
+	go cmd.Wait()
+
+	// the new process serves the socket now, don't remove it on shutdown
+	for _, l := range listeners {
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	return nil
+}
+
+// inheritedListeners returns the listeners the previous process handed over
+// by key, or nil when it wasn't started by a restart
+func inheritedListeners() (map[string]net.Listener, error) {
+	encoded, ok := os.LookupEnv(inheritEnv)
+	if !ok {
+		return nil, nil
+	}
+	os.Unsetenv(inheritEnv)
+	var keys []string
+	if err := json.Unmarshal([]byte(encoded), &keys); err != nil {
+		return nil, fmt.Errorf("server: %s: %w", inheritEnv, err)
+	}
+	inherited := make(map[string]net.Listener, len(keys))
+	for i, key := range keys {
+		fd := 3 + i
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), key)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range inherited {
+				l.Close()
+			}
+			return nil, fmt.Errorf("server: listener %s from the previous process: %w", key, err)
+		}
+		// this process owns the socket file from now on
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(true)
+		}
+		inherited[key] = l
+	}
+	return inherited, nil
+}
+
+// notifyReady tells the process that restarted us that we're serving
+func notifyReady() {
+	fd, err := strconv.Atoi(os.Getenv(readyEnv))
+	if err != nil {
+		return
+	}
+	os.Unsetenv(readyEnv)
+	f := os.NewFile(uintptr(fd), "ready")
+	f.Write([]byte{1})
+	f.Close()
+}
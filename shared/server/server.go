@@ -0,0 +1,405 @@
+// Package server runs the HTTP servers of the services in this repo.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// DefaultShutdownTimeout is used when Config.ShutdownTimeout is zero
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Defaults for the connection timeouts left zero in Config
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+)
+
+// Config configures a server
+type Config struct {
+	// Addr is the TCP address to listen on, empty to only use Socket and
+	// Listeners
+	Addr string
+	// Socket is the path of a Unix domain socket to listen on as well, e.g.
+	// for a proxy running next to the service
+	Socket string
+	TLS    TLSConfig
+	// ShutdownTimeout bounds how long in-flight requests get to finish once
+	// shutdown starts
+	ShutdownTimeout time.Duration
+	// ReadHeaderTimeout bounds reading request headers, defaults to
+	// DefaultReadHeaderTimeout so idle clients can't hold connections open
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout and WriteTimeout bound reading a whole request and
+	// writing its response, none when zero. Streaming handlers lift them
+	// for their own requests.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// IdleTimeout bounds how long keep-alive connections wait for the next
+	// request, defaults to DefaultIdleTimeout
+	IdleTimeout time.Duration
+	// H2C serves cleartext HTTP/2 next to HTTP/1.1, for deployments behind a
+	// trusted load balancer that speaks HTTP/2 to its backends. With TLS,
+	// HTTP/2 is always offered.
+	H2C bool
+	// Restartable lets SIGUSR2 start the binary again and hand it the
+	// listening sockets, for deploys that don't drop connections. Only one
+	// server of a process may set it; the listeners of the others aren't
+	// handed over, see WaitForPrevious.
+	Restartable bool
+	// Activation serves on the sockets systemd passes with socket
+	// activation, when there are any, instead of Addr, Socket and
+	// Listeners. Only one server of a process may set it.
+	Activation bool
+	// Listeners are further addresses to serve on next to Addr and Socket,
+	// e.g. IPv4 and IPv6 separately or a second port with other TLS
+	// settings
+	Listeners []Listener
+}
+
+// Listener is an additional address a server listens on
+type Listener struct {
+	// Network is tcp, tcp4, tcp6 or unix, defaults to tcp. Listening on
+	// 0.0.0.0:8000 with tcp4 and on [::]:8000 with tcp6 serves both IP
+	// versions on systems that don't accept IPv4 on IPv6 sockets.
+	Network string
+	// Addr is the address to listen on, or the socket path for unix
+	Addr string
+	// TLS replaces the server's TLS settings on this listener
+	TLS *TLSConfig
+	// Plaintext serves without TLS even when the server has TLS, e.g. on a
+	// port only a sidecar can reach
+	Plaintext bool
+}
+
+// key identifies l when listeners are passed to a restarted process
+func (l Listener) key() string {
+	return l.Network + ":" + l.Addr
+}
+
+// Server is an http.Server that shuts down gracefully when its context ends
+type Server struct {
+	cfg  Config
+	http *http.Server
+	// extra serves each of Config.Listeners, by key
+	extra map[string]*http.Server
+	hooks []func(context.Context) error
+}
+
+// New creates a server for h. TLS settings are checked here so mistakes are
+// reported before anything starts listening.
+func New(cfg Config, h http.Handler) (*Server, error) {
+	tlsConfig, err := cfg.TLS.Build()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if cfg.ReadHeaderTimeout == 0 {
+		cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	// h2c only applies to the plaintext listeners
+	cleartext := h
+	if cfg.H2C {
+		if tlsConfig != nil {
+			return nil, errors.New("server: h2c is cleartext HTTP/2 and can't be combined with TLS")
+		}
+		cleartext = h2c.NewHandler(h, &http2.Server{})
+	}
+	s := &Server{cfg: cfg, extra: make(map[string]*http.Server)}
+	if tlsConfig == nil {
+		s.http = cfg.httpServer(cfg.Addr, cleartext, nil)
+	} else {
+		s.http = cfg.httpServer(cfg.Addr, h, tlsConfig)
+	}
+
+	seen := map[string]bool{"tcp:" + cfg.Addr: cfg.Addr != "", "unix:" + cfg.Socket: cfg.Socket != ""}
+	for i, l := range cfg.Listeners {
+		switch l.Network {
+		case "":
+			l.Network = "tcp"
+		case "tcp", "tcp4", "tcp6", "unix":
+		default:
+			return nil, fmt.Errorf("server: listener %s has unknown network %q", l.Addr, l.Network)
+		}
+		if l.Addr == "" {
+			return nil, errors.New("server: listener without an address")
+		}
+		if seen[l.key()] {
+			return nil, fmt.Errorf("server: listening on %s twice", l.Addr)
+		}
+		seen[l.key()] = true
+		cfg.Listeners[i] = l
+
+		listenerTLS := tlsConfig
+		switch {
+		case l.Plaintext:
+			listenerTLS = nil
+		case l.TLS != nil:
+			if listenerTLS, err = l.TLS.Build(); err != nil {
+				return nil, fmt.Errorf("server: listener %s: %w", l.Addr, err)
+			}
+		}
+		if listenerTLS == nil {
+			s.extra[l.key()] = cfg.httpServer(l.Addr, cleartext, nil)
+		} else {
+			s.extra[l.key()] = cfg.httpServer(l.Addr, h, listenerTLS)
+		}
+	}
+	return s, nil
+}
+
+func (cfg Config) httpServer(addr string, h http.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// servers lists the http.Servers serving the listeners
+func (s *Server) servers() []*http.Server {
+	servers := []*http.Server{s.http}
+	for _, l := range s.cfg.Listeners {
+		servers = append(servers, s.extra[l.key()])
+	}
+	return servers
+}
+
+// serverFor is the http.Server serving the listener with key
+func (s *Server) serverFor(key string) *http.Server {
+	if srv, ok := s.extra[key]; ok {
+		return srv
+	}
+	return s.http
+}
+
+// OnShutdown registers f to run after in-flight requests have drained, e.g.
+// to flush job state. Hooks run in registration order and share the
+// shutdown deadline.
+func (s *Server) OnShutdown(f func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, f)
+}
+
+// socketMode lets the socket's group, e.g. a local proxy, connect
+const socketMode = 0o660
+
+// listen opens the listeners Config asks for and returns them with the keys
+// a restarted process finds them by. Listeners handed over by the previous
+// process are reused, and when systemd started the process with socket
+// activation its sockets are used instead if Config.Activation is set, so
+// they stay open across restarts.
+func (s *Server) listen() ([]net.Listener, []string, error) {
+	var inherited map[string]net.Listener
+	if s.cfg.Restartable {
+		var err error
+		if inherited, err = inheritedListeners(); err != nil {
+			return nil, nil, err
+		}
+	}
+	// close what the previous process passed but the config no longer uses
+	defer func() {
+		for _, l := range inherited {
+			l.Close()
+		}
+	}()
+
+	var (
+		listeners []net.Listener
+		keys      []string
+		err       error
+	)
+	if s.cfg.Activation {
+		if listeners, err = activationListeners(); err != nil {
+			return nil, nil, err
+		}
+		for i := range listeners {
+			keys = append(keys, "systemd:"+strconv.Itoa(i))
+		}
+		// systemd's sockets may have reached us through a restart
+		for i := 0; len(keys) == i; i++ {
+			key := "systemd:" + strconv.Itoa(i)
+			if l, ok := inherited[key]; ok {
+				delete(inherited, key)
+				listeners, keys = append(listeners, l), append(keys, key)
+			}
+		}
+		if len(listeners) > 0 {
+			slog.Info("using sockets from systemd socket activation", "count", len(listeners))
+			return listeners, keys, nil
+		}
+	}
+
+	open := func(key string, listen func() (net.Listener, error)) error {
+		l, ok := inherited[key]
+		if ok {
+			delete(inherited, key)
+		} else if l, err = listen(); err != nil {
+			return err
+		}
+		listeners, keys = append(listeners, l), append(keys, key)
+		return nil
+	}
+	if s.cfg.Addr != "" {
+		if err := open("tcp:"+s.cfg.Addr, func() (net.Listener, error) { return net.Listen("tcp", s.cfg.Addr) }); err != nil {
+			return nil, nil, err
+		}
+	}
+	if s.cfg.Socket != "" {
+		if err := open("unix:"+s.cfg.Socket, func() (net.Listener, error) { return listenUnix(s.cfg.Socket) }); err != nil {
+			closeAll(listeners)
+			return nil, nil, err
+		}
+	}
+	for _, l := range s.cfg.Listeners {
+		listen := func() (net.Listener, error) { return net.Listen(l.Network, l.Addr) }
+		if l.Network == "unix" {
+			listen = func() (net.Listener, error) { return listenUnix(l.Addr) }
+		}
+		if err := open(l.key(), listen); err != nil {
+			closeAll(listeners)
+			return nil, nil, err
+		}
+	}
+	if len(listeners) == 0 {
+		return nil, nil, errors.New("server: no address, socket or listener to listen on")
+	}
+	return listeners, keys, nil
+}
+
+// listenUnix listens on the socket at path, replacing a socket left behind
+// by a previous run
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("server: %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// Run serves until ctx is done, then stops accepting connections, waits for
+// in-flight requests up to the shutdown timeout and runs the shutdown hooks.
+// A restartable server also hands its listeners to a new process on
+// SIGUSR2 and shuts down once that process is serving. The hooks run when
+// listening or serving fails too.
+func (s *Server) Run(ctx context.Context) error {
+	listeners, keys, err := s.listen()
+	if err != nil {
+		shutdownCtx, cancel := s.shutdownContext()
+		defer cancel()
+		return errors.Join(err, s.runHooks(shutdownCtx))
+	}
+	// decided up front since serving sets up a TLSConfig for HTTP/2
+	useTLS := make([]bool, len(listeners))
+	for i, key := range keys {
+		useTLS[i] = s.serverFor(key).TLSConfig != nil
+	}
+	errc := make(chan error, len(listeners))
+	for i, l := range listeners {
+		go func(l net.Listener, srv *http.Server, useTLS bool) {
+			addr := l.Addr().String()
+			if !useTLS {
+				slog.Info("starting server", "addr", addr)
+				errc <- srv.Serve(l)
+			} else {
+				slog.Info("starting server", "addr", addr, "tls", true)
+				errc <- srv.ServeTLS(l, "", "")
+			}
+		}(l, s.serverFor(keys[i]), useTLS[i])
+	}
+	restart := restartSignal(s.cfg.Restartable)
+	if s.cfg.Restartable {
+		notifyReady()
+	}
+
+wait:
+	for {
+		select {
+		case err := <-errc:
+			for _, srv := range s.servers() {
+				srv.Close()
+			}
+			for range listeners[1:] {
+				<-errc
+			}
+			shutdownCtx, cancel := s.shutdownContext()
+			defer cancel()
+			return errors.Join(err, s.runHooks(shutdownCtx))
+		case <-ctx.Done():
+			break wait
+		case <-restart:
+			if err := handOver(listeners, keys); err != nil {
+				slog.Error("restart failed, still serving", "error", err)
+				continue
+			}
+			slog.Info("new process is serving")
+			break wait
+		}
+	}
+
+	slog.Info("shutting down, draining in-flight requests", "timeout", s.cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := s.shutdownContext()
+	defer cancel()
+
+	for _, srv := range s.servers() {
+		err = errors.Join(err, srv.Shutdown(shutdownCtx))
+	}
+	for range listeners {
+		if serveErr := <-errc; !errors.Is(serveErr, http.ErrServerClosed) {
+			err = errors.Join(err, serveErr)
+		}
+	}
+	return errors.Join(err, s.runHooks(shutdownCtx))
+}
+
+// shutdownContext bounds a shutdown by the shutdown timeout
+func (s *Server) shutdownContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+}
+
+// runHooks runs the shutdown hooks, which share the deadline of ctx
+func (s *Server) runHooks(ctx context.Context) error {
+	var err error
+	for _, hook := range s.hooks {
+		err = errors.Join(err, hook(ctx))
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig configures how a server terminates TLS. Either a certificate and
+// key pair or a list of autocert hosts enables TLS; setting ClientCAFile turns
+// on mutual TLS.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+
+	// AutocertHosts obtains certificates from Let's Encrypt for these hosts
+	// using the TLS-ALPN-01 challenge, so the server must be reachable on 443
+	AutocertHosts []string
+	// AutocertCacheDir stores issued certificates between restarts, so they
+	// aren't issued again on every start and run into Let's Encrypt's rate
+	// limits. Defaults to autocert in the user's cache directory.
+	AutocertCacheDir string
+
+	// ClientCAFile is a PEM bundle used to verify client certificates
+	ClientCAFile string
+	// RequireClientCert rejects clients without a certificate signed by
+	// ClientCAFile. Otherwise client certificates are verified when sent.
+	RequireClientCert bool
+}
+
+// Enabled reports whether any TLS settings were given
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || len(c.AutocertHosts) > 0
+}
+
+// Build turns c into a *tls.Config. It returns nil when TLS is not enabled.
+func (c TLSConfig) Build() (*tls.Config, error) {
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		return nil, errors.New("tls: client certificates required without a client CA to verify them")
+	}
+	if !c.Enabled() {
+		if c.ClientCAFile != "" {
+			return nil, errors.New("tls: client CA configured without a server certificate")
+		}
+		return nil, nil
+	}
+
+	var cfg *tls.Config
+	switch {
+	case len(c.AutocertHosts) > 0:
+		if c.CertFile != "" {
+			return nil, errors.New("tls: use either a certificate file or autocert, not both")
+		}
+		dir := c.AutocertCacheDir
+		if dir == "" {
+			cache, err := os.UserCacheDir()
+			if err != nil {
+				return nil, fmt.Errorf("tls: no autocert cache directory configured or found: %w", err)
+			}
+			dir = filepath.Join(cache, "autocert")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.AutocertHosts...),
+			Cache:      autocert.DirCache(dir),
+		}
+		cfg = m.TLSConfig()
+	default:
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("tls: both a certificate and a key file are required")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: loading key pair: %w", err)
+		}
+		cfg = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	cfg.MinVersion = tls.VersionTLS12
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: reading client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("tls: no certificates found in client CA file")
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg, nil
+}
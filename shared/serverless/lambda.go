@@ -0,0 +1,286 @@
+package serverless
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// runtimeAPI is the version prefix of the Lambda runtime API
+const runtimeAPI = "/2018-06-01/runtime"
+
+// event is the union of the API Gateway REST (v1), HTTP API (v2) and ALB
+// request events
+type event struct {
+	Version string `json:"version"`
+
+	// v1 and ALB
+	HTTPMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+
+	// v2
+	RawPath        string   `json:"rawPath"`
+	RawQueryString string   `json:"rawQueryString"`
+	Cookies        []string `json:"cookies"`
+
+	RequestContext struct {
+		ELB *struct {
+			TargetGroupARN string `json:"targetGroupArn"`
+		} `json:"elb"`
+		Identity struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+		HTTP struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+	} `json:"requestContext"`
+
+	Body            string `json:"body"`
+	IsBase64Encoded bool   `json:"isBase64Encoded"`
+}
+
+// response is the union of the API Gateway and ALB response formats
+type response struct {
+	StatusCode        int                 `json:"statusCode"`
+	StatusDescription string              `json:"statusDescription,omitempty"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies           []string            `json:"cookies,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// StartLambda serves h to Lambda invocations until ctx is done
+func StartLambda(ctx context.Context, h http.Handler) error {
+	api := "http://" + os.Getenv("AWS_LAMBDA_RUNTIME_API") + runtimeAPI
+	// the runtime API blocks until the next invocation, so no timeout
+	client := &http.Client{}
+	slog.Info("serving AWS Lambda invocations")
+	for {
+		if err := invoke(ctx, client, api, h); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// invoke waits for the next invocation, serves it with h and posts the
+// response
+func invoke(ctx context.Context, client *http.Client, api string, h http.Handler) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api+"/invocation/next", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	payload, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("lambda: next invocation: %s", resp.Status)
+	}
+	id := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+	if trace := resp.Header.Get("Lambda-Runtime-Trace-Id"); trace != "" {
+		os.Setenv("_X_AMZN_TRACE_ID", trace)
+	}
+
+	invokeCtx := ctx
+	if ms, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+		var cancel context.CancelFunc
+		invokeCtx, cancel = context.WithDeadline(ctx, time.UnixMilli(ms))
+		defer cancel()
+	}
+
+	out, err := serve(invokeCtx, h, payload)
+	if err != nil {
+		return post(ctx, client, api+"/invocation/"+id+"/error", map[string]string{
+			"errorMessage": err.Error(),
+			"errorType":    "InvalidEvent",
+		})
+	}
+	return post(ctx, client, api+"/invocation/"+id+"/response", out)
+}
+
+// serve translates the event in payload to a request, serves it and
+// translates the response back in the event's format
+func serve(ctx context.Context, h http.Handler, payload []byte) (response, error) {
+	var ev event
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return response{}, err
+	}
+	req, err := ev.request(ctx)
+	if err != nil {
+		return response{}, err
+	}
+	w := &responseBuffer{header: make(http.Header)}
+	h.ServeHTTP(w, req)
+	return ev.response(w), nil
+}
+
+func (ev *event) request(ctx context.Context) (*http.Request, error) {
+	method, path, rawQuery := ev.HTTPMethod, ev.Path, ""
+	remote := ev.RequestContext.Identity.SourceIP
+	switch {
+	case ev.Version == "2.0":
+		method, path, rawQuery = ev.RequestContext.HTTP.Method, ev.RawPath, ev.RawQueryString
+		remote = ev.RequestContext.HTTP.SourceIP
+	case ev.MultiValueQueryStringParameters != nil:
+		rawQuery = encodeQuery(ev.MultiValueQueryStringParameters, ev.RequestContext.ELB != nil)
+	case ev.QueryStringParameters != nil:
+		multi := make(map[string][]string, len(ev.QueryStringParameters))
+		for k, v := range ev.QueryStringParameters {
+			multi[k] = []string{v}
+		}
+		rawQuery = encodeQuery(multi, ev.RequestContext.ELB != nil)
+	}
+	if method == "" {
+		return nil, errors.New("lambda: not an API Gateway or ALB event")
+	}
+
+	body := []byte(ev.Body)
+	if ev.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(ev.Body); err != nil {
+			return nil, err
+		}
+	}
+	u := &url.URL{Path: path, RawQuery: rawQuery}
+	req, err := http.NewRequestWithContext(ctx, method, u.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range ev.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, values := range ev.MultiValueHeaders {
+		req.Header.Del(k)
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	if len(ev.Cookies) > 0 {
+		req.Header.Set("Cookie", strings.Join(ev.Cookies, "; "))
+	}
+	req.Host = req.Header.Get("Host")
+	req.RemoteAddr = remote + ":0"
+	return req, nil
+}
+
+// encodeQuery builds a query string. ALB passes parameters the way the
+// client encoded them while API Gateway decodes them.
+func encodeQuery(params map[string][]string, encoded bool) string {
+	if !encoded {
+		return url.Values(params).Encode()
+	}
+	var parts []string
+	for k, values := range params {
+		for _, v := range values {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func (ev *event) response(w *responseBuffer) response {
+	out := response{StatusCode: w.status}
+	if out.StatusCode == 0 {
+		out.StatusCode = http.StatusOK
+	}
+	body := w.body.Bytes()
+	if utf8.Valid(body) {
+		out.Body = string(body)
+	} else {
+		out.Body, out.IsBase64Encoded = base64.StdEncoding.EncodeToString(body), true
+	}
+
+	switch {
+	case ev.Version == "2.0":
+		// HTTP APIs take cookies separately and join other repeated headers
+		out.Cookies = w.header.Values("Set-Cookie")
+		w.header.Del("Set-Cookie")
+		out.Headers = make(map[string]string, len(w.header))
+		for k, v := range w.header {
+			out.Headers[k] = strings.Join(v, ",")
+		}
+	case ev.RequestContext.ELB != nil && ev.MultiValueHeaders == nil:
+		// ALB only takes multi value headers when they're enabled, which
+		// shows in the request
+		out.StatusDescription = strconv.Itoa(out.StatusCode) + " " + http.StatusText(out.StatusCode)
+		out.Headers = make(map[string]string, len(w.header))
+		for k, v := range w.header {
+			out.Headers[k] = v[len(v)-1]
+		}
+	default:
+		if ev.RequestContext.ELB != nil {
+			out.StatusDescription = strconv.Itoa(out.StatusCode) + " " + http.StatusText(out.StatusCode)
+		}
+		out.MultiValueHeaders = w.header
+	}
+	return out
+}
+
+func post(ctx context.Context, client *http.Client, url string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("lambda: POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// responseBuffer collects a handler's response for the invocation result
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseBuffer) Header() http.Header {
+	return w.header
+}
+
+func (w *responseBuffer) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseBuffer) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
@@ -0,0 +1,23 @@
+// Package serverless runs the services' routers on function platforms
+// instead of as long-lived servers. On AWS Lambda, API Gateway and ALB
+// events are translated to HTTP requests for the same router and
+// middleware. Google Cloud Functions (2nd gen) and Cloud Run start the
+// service as a container, so there it only needs to listen on $PORT.
+package serverless
+
+import "os"
+
+// OnLambda reports whether the process was started by the AWS Lambda
+// runtime
+func OnLambda() bool {
+	return os.Getenv("AWS_LAMBDA_RUNTIME_API") != ""
+}
+
+// ListenAddr returns the address Google Cloud Functions or Cloud Run expect
+// the service on, or addr when not running there
+func ListenAddr(addr string) string {
+	if port := os.Getenv("PORT"); port != "" && os.Getenv("K_SERVICE") != "" {
+		return ":" + port
+	}
+	return addr
+}
@@ -0,0 +1,488 @@
+// Package service builds what the services of this repository have in
+// common: the database and the stores for API keys, jobs, schedules and
+// usage, the router with its middleware, the admin routes and dashboard,
+// and the background work that runs next to the server. A service creates
+// a Core, adds its own routes, components and background work, and lets
+// the Core run it.
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/auth"
+	"github.com/ixmorrow/go-projects/shared/breaker"
+	"github.com/ixmorrow/go-projects/shared/buildinfo"
+	"github.com/ixmorrow/go-projects/shared/cache"
+	"github.com/ixmorrow/go-projects/shared/chaos"
+	"github.com/ixmorrow/go-projects/shared/compress"
+	"github.com/ixmorrow/go-projects/shared/config"
+	"github.com/ixmorrow/go-projects/shared/cors"
+	"github.com/ixmorrow/go-projects/shared/dashboard"
+	"github.com/ixmorrow/go-projects/shared/flags"
+	"github.com/ixmorrow/go-projects/shared/health"
+	"github.com/ixmorrow/go-projects/shared/jobs"
+	"github.com/ixmorrow/go-projects/shared/logging"
+	"github.com/ixmorrow/go-projects/shared/metering"
+	"github.com/ixmorrow/go-projects/shared/metrics"
+	"github.com/ixmorrow/go-projects/shared/mirror"
+	"github.com/ixmorrow/go-projects/shared/ratelimit"
+	"github.com/ixmorrow/go-projects/shared/replay"
+	"github.com/ixmorrow/go-projects/shared/respond"
+	"github.com/ixmorrow/go-projects/shared/schedule"
+	"github.com/ixmorrow/go-projects/shared/server"
+	"github.com/ixmorrow/go-projects/shared/serverless"
+	"github.com/ixmorrow/go-projects/shared/storage"
+)
+
+// Options configures a Core
+type Options struct {
+	// Name is the service name used in logs, metrics and configuration
+	Name string
+	// Prefix namespaces the keys of the service in a cache shared with
+	// others, e.g. "ccv:"
+	Prefix string
+	// RateGroups are the route groups with a rate limiter of their own, see
+	// config.RateLimit.Groups
+	RateGroups []string
+	// Sanitize rewrites the request URIs and bodies recorded for replays or
+	// mirrored, e.g. to mask card numbers
+	Sanitize func([]byte) []byte
+	// Logger is used for request logs. It defaults to a JSON logger at
+	// Log.Level of the configuration.
+	Logger *slog.Logger
+	// Level is set to the new log level on reloads. The default Logger reads
+	// its level from it; a Logger of your own only does if you built it so.
+	Level *slog.LevelVar
+}
+
+// Reloader reloads the configuration of a service, it is a config.Reloader
+// of any configuration type
+type Reloader interface {
+	Watch(ctx context.Context)
+	Handler(w http.ResponseWriter, r *http.Request)
+}
+
+// Core is what a service is built around. Its fields are set by New for the
+// service to add its routes and background work to.
+type Core struct {
+	Name    string
+	Metrics *metrics.Metrics
+	// DB is the configured database, or nil without one
+	DB *storage.DB
+	// Cache is the cache of the service, counted in its metrics
+	Cache cache.Cache
+	Keys  auth.Store
+	Auth  *auth.Authenticator
+	Jobs  jobs.Store
+	// Runner runs the batch jobs. The service registers its job types and
+	// starts it.
+	Runner  *jobs.Runner
+	Sched   *schedule.Scheduler
+	Usage   metering.Store
+	Meter   *metering.Meter
+	Checker *health.Checker
+	// Router serves the metrics, health, version and admin routes, and the
+	// routes the service adds
+	Router *mux.Router
+	Dash   *dashboard.Dashboard
+	// Features are the feature flags, updated on reloads
+	Features *flags.Set
+	// Limiters are the rate limiters of Options.RateGroups by group
+	Limiters map[string]*ratelimit.Limiter
+	// Faults, Record and Mirror pass requests through unless fault
+	// injection, recording for replays or mirroring to a secondary backend
+	// is on
+	Faults, Record, Mirror func(http.Handler) http.Handler
+
+	cfg        config.Base
+	level      *slog.LevelVar
+	components buildinfo.Components
+	injector   *chaos.Injector
+	reloader   Reloader
+	background []func(context.Context)
+	shutdown   []func(context.Context) error
+	closers    []io.Closer
+}
+
+// New opens the database and stores described by cfg and builds the
+// router. Call Shutdown when done with the Core, unless Run was used, which
+// shuts it down itself.
+func New(cfg config.Base, opts Options) (*Core, error) {
+	level, logger := opts.Level, opts.Logger
+	if logger == nil {
+		if level == nil {
+			level = new(slog.LevelVar)
+			level.Set(logging.ParseLevel(cfg.Log.Level))
+		}
+		logger = logging.New(logging.Options{
+			Service:         opts.Name,
+			Level:           level,
+			SensitiveFields: cfg.Log.SensitiveFields,
+		})
+	}
+
+	c := &Core{
+		Name:       opts.Name,
+		Metrics:    metrics.New(opts.Name),
+		cfg:        cfg,
+		level:      level,
+		components: buildinfo.Components{},
+	}
+	if err := c.build(opts, logger); err != nil {
+		return nil, errors.Join(err, c.Shutdown(context.Background()))
+	}
+	return c, nil
+}
+
+// OpenKeyStore keeps API keys in the database when one is configured and in
+// a JSON file otherwise
+func OpenKeyStore(cfg config.Auth, db *storage.DB) (auth.Store, error) {
+	if db != nil {
+		return auth.NewSQLStore(context.Background(), db)
+	}
+	return auth.NewFileStore(cfg.KeysFile)
+}
+
+// OpenJobStore persists jobs in the database when one is configured and
+// keeps them in memory otherwise
+func OpenJobStore(db *storage.DB) (jobs.Store, error) {
+	if db != nil {
+		return jobs.NewSQLStore(context.Background(), db)
+	}
+	return jobs.NewMemoryStore(), nil
+}
+
+// OpenUsageStore keeps usage counts in the database when one is configured
+// and in memory otherwise
+func OpenUsageStore(db *storage.DB) (metering.Store, error) {
+	if db != nil {
+		return metering.NewSQLStore(context.Background(), db)
+	}
+	return metering.NewMemoryStore(), nil
+}
+
+// OpenScheduleStore coordinates the replicas' schedulers through the
+// database, or Redis under prefix when the cache uses it, and in memory
+// when the service runs alone
+func OpenScheduleStore(db *storage.DB, backend cache.Cache, prefix string) (schedule.Store, error) {
+	if db != nil {
+		return schedule.NewSQLStore(context.Background(), db)
+	}
+	if r, ok := backend.(*cache.Redis); ok {
+		return schedule.NewRedisStore(r.Client(), prefix), nil
+	}
+	return schedule.NewMemoryStore(), nil
+}
+
+// build opens the stores and builds the router, adding anything that needs
+// closing to c.closers as it goes
+func (c *Core) build(opts Options, logger *slog.Logger) error {
+	cfg, m := c.cfg, c.Metrics
+
+	if cfg.Database.URL != "" {
+		db, err := storage.Open(context.Background(), cfg.Database.URL)
+		if err != nil {
+			return err
+		}
+		c.DB = db
+		c.closers = append(c.closers, db)
+	}
+
+	var err error
+	if c.Keys, err = OpenKeyStore(cfg.Auth, c.DB); err != nil {
+		return err
+	}
+	if cfg.Auth.AdminKey != "" {
+		bootstrap := auth.KeyFromSecret("bootstrap-admin", cfg.Auth.AdminKey, []string{auth.ScopeAdmin})
+		if err := auth.Ensure(context.Background(), c.Keys, bootstrap); err != nil {
+			return err
+		}
+	}
+	c.Auth = auth.New(c.Keys)
+	if oidc, ok := cfg.OIDCConfig(); ok {
+		oidc.Breaker = breaker.New("oidc", breaker.Config{})
+		oidc.Breaker.Register(m.Registry())
+		tokens, err := auth.NewTokenVerifier(oidc)
+		if err != nil {
+			return err
+		}
+		c.Auth.WithTokens(tokens)
+	}
+
+	backend, err := cache.New(cfg.CacheConfig(opts.Prefix))
+	if err != nil {
+		return err
+	}
+	c.Cache = cache.WithMetrics(backend, "app", m.Registry())
+
+	if c.Jobs, err = OpenJobStore(c.DB); err != nil {
+		return err
+	}
+	c.Runner = jobs.NewRunner(c.Jobs, cfg.JobOptions())
+
+	scheduleStore, err := OpenScheduleStore(c.DB, backend, opts.Prefix)
+	if err != nil {
+		return err
+	}
+	c.Sched = schedule.New(scheduleStore, cfg.ScheduleOptions())
+	c.Sched.Register(m.Registry())
+	if retention := cfg.Jobs.Retention; retention > 0 {
+		c.Sched.Add("prune-jobs", time.Hour, func(ctx context.Context) error {
+			n, err := c.Jobs.Prune(ctx, time.Now().Add(-retention))
+			if n > 0 {
+				slog.InfoContext(ctx, "pruned finished jobs", "count", n)
+			}
+			return err
+		})
+	}
+
+	if c.Usage, err = OpenUsageStore(c.DB); err != nil {
+		return err
+	}
+	c.Meter = metering.New(c.Usage)
+	c.Meter.SetQuotas(cfg.Quotas())
+	// replicas sharing a Redis cache share their quota use too
+	if r, ok := backend.(*cache.Redis); ok {
+		c.Meter.ShareQuotas(metering.NewRedisQuotas(r.Client(), opts.Prefix))
+	}
+
+	c.Checker = health.New()
+	c.Checker.Add("cache", c.Cache.Ping)
+	if c.DB != nil {
+		c.Checker.Add("database", c.DB.PingContext)
+	}
+	c.Checker.Add("apikeys", func(ctx context.Context) error {
+		_, err := c.Keys.List(ctx)
+		return err
+	})
+
+	r := mux.NewRouter()
+	r.NotFoundHandler = respond.Unmatched(r)
+	r.MethodNotAllowedHandler = r.NotFoundHandler
+	c.Router = r
+	r.Use(logging.Middleware(logger), m.Middleware)
+	if cfg.AccessLog.File != "" {
+		accessFile, err := logging.OpenRotating(cfg.AccessLog.File, cfg.AccessLogRotation())
+		if err != nil {
+			return err
+		}
+		c.closers = append(c.closers, accessFile)
+		accessLog, err := logging.AccessLog(accessFile, cfg.AccessLog.Format)
+		if err != nil {
+			return err
+		}
+		r.Use(accessLog)
+	}
+	if cfg.Compression.Enabled {
+		r.Use(compress.Middleware(cfg.Compression.MinSize))
+	}
+	if corsCfg, ok := cfg.CORSConfig(); ok {
+		// Preflights come without credentials and only reach middleware
+		// through a matching route, so every OPTIONS request gets one here
+		// before the authenticated routes
+		r.Methods(http.MethodOptions).HandlerFunc(cors.Preflight)
+		r.Use(cors.Middleware(corsCfg))
+	}
+	r.Handle("/metrics", m.Handler()).Methods("GET")
+	r.HandleFunc("/healthz", c.Checker.Liveness).Methods("GET")
+	r.HandleFunc("/readyz", c.Checker.Readiness).Methods("GET")
+	r.HandleFunc("/version", buildinfo.Handler(c.Name, c.components)).Methods("GET")
+
+	// every route group has its own rate limits, see RateLimit.Groups
+	limitCfgs, err := cfg.RateLimitConfigs(opts.RateGroups...)
+	if err != nil {
+		return err
+	}
+	c.Limiters = make(map[string]*ratelimit.Limiter, len(limitCfgs))
+	for group, limitCfg := range limitCfgs {
+		c.Limiters[group] = ratelimit.New(limitCfg)
+		c.Limiters[group].SetTenantLimits(cfg.TenantLimits(group))
+	}
+	passThrough := func(next http.Handler) http.Handler { return next }
+	c.Faults, c.Record, c.Mirror = passThrough, passThrough, passThrough
+	if cfg.Record.File != "" {
+		recorder, err := replay.NewRecorder(cfg.Record.File, replay.Options{Sample: cfg.Record.Sample, Sanitize: opts.Sanitize})
+		if err != nil {
+			return err
+		}
+		c.closers = append(c.closers, recorder)
+		c.Record = recorder.Middleware
+	}
+	if cfg.Mirror.URL != "" {
+		mirrorOpts := cfg.MirrorOptions()
+		mirrorOpts.Sanitize = opts.Sanitize
+		mirrored, err := mirror.New(mirrorOpts, m.Registry())
+		if err != nil {
+			return err
+		}
+		c.closers = append(c.closers, mirrored)
+		c.Mirror = mirrored.Middleware
+	}
+	if cfg.Chaos.Enabled {
+		slog.Warn("fault injection is on, never use it in production")
+		c.injector = chaos.New(cfg.ChaosConfig(), m.Registry())
+		c.Faults = c.injector.Middleware
+	}
+	c.Features = flags.New(cfg.FeatureFlags())
+
+	c.Dash = dashboard.New(c.Name, m.Registry(), c.Jobs)
+	build := buildinfo.Read(c.Name, nil)
+	c.Dash.AddInfo("build", func() string { return build.Version + " " + build.Commit })
+	c.Dash.AddLink("Usage this month", "/admin/usage")
+	c.Dash.AddLink("API keys", "/admin/keys")
+	c.Dash.AddLink("Failed jobs", "/jobs?status=failed")
+	c.Dash.AddLink("Feature flags", "/admin/flags")
+	c.Dash.AddLink("Scheduled tasks", "/admin/schedule")
+	c.Dash.AddLink("Metrics", "/metrics")
+	return nil
+}
+
+// AddComponent reports the version of an algorithm or dataset the service
+// uses on /version and the dashboard
+func (c *Core) AddComponent(name string, version func() string) {
+	c.components[name] = version
+	c.Dash.AddInfo(name, version)
+}
+
+// AddCloser closes cl when the Core shuts down, after everything opened
+// before it
+func (c *Core) AddCloser(cl io.Closer) {
+	c.closers = append(c.closers, cl)
+}
+
+// Go runs f in Start until its context is done
+func (c *Core) Go(f func(ctx context.Context)) {
+	c.background = append(c.background, f)
+}
+
+// OnShutdown runs f in Shutdown once the jobs stopped and the usage counts
+// were flushed, before anything is closed
+func (c *Core) OnShutdown(f func(ctx context.Context) error) {
+	c.shutdown = append(c.shutdown, f)
+}
+
+// Admin registers the admin routes, behind the admin scope, with the API
+// keys, usage, schedule, dashboard, reload and feature flag routes, and
+// watches for SIGHUP with reloader. It returns the admin subrouter for the
+// service's own admin routes.
+func (c *Core) Admin(reloader Reloader) *mux.Router {
+	admin := c.Router.PathPrefix("/admin").Subrouter()
+	admin.Use(c.Auth.Require(auth.ScopeAdmin))
+	auth.RegisterKeyRoutes(admin, c.Keys)
+	metering.RegisterAdminRoutes(admin, c.Usage)
+	schedule.RegisterAdminRoutes(admin, c.Sched)
+	admin.Handle("/dashboard", c.Dash).Methods("GET")
+	// both act on the whole deployment, and the flags name tenants and keys
+	admin.Handle("/reload", auth.RequireOperator(http.HandlerFunc(reloader.Handler))).Methods("POST")
+	admin.Handle("/flags", auth.RequireOperator(http.HandlerFunc(c.Features.Handler))).Methods("GET")
+	c.reloader = reloader
+	return admin
+}
+
+// Reload applies the parts of a reloaded configuration that can change
+// while running: the log level, rate limits, quotas, feature flags and
+// injected faults
+func (c *Core) Reload(cfg config.Base) {
+	if c.level != nil {
+		c.level.Set(logging.ParseLevel(cfg.Log.Level))
+	}
+	for group, limiter := range c.Limiters {
+		limits := cfg.GroupLimits(group)
+		limiter.SetLimits(limits.Rate, limits.Burst)
+		limiter.SetTenantLimits(cfg.TenantLimits(group))
+	}
+	c.Meter.SetQuotas(cfg.Quotas())
+	c.Features.Update(cfg.FeatureFlags())
+	if c.injector != nil {
+		c.injector.SetConfig(cfg.ChaosConfig())
+	}
+}
+
+// Start runs the background work until ctx is done: flushing usage,
+// sampling the dashboard, running scheduled tasks while this replica leads,
+// reloading the configuration on SIGHUP, pushing to StatsD, serving the
+// debug listener when configured and what the service added with Go.
+// Readiness checks fail once ctx is done so load balancers stop sending
+// traffic.
+func (c *Core) Start(ctx context.Context) {
+	context.AfterFunc(ctx, c.Checker.Drain)
+	if c.reloader != nil {
+		go c.reloader.Watch(ctx)
+	}
+	go c.Meter.Run(ctx, 10*time.Second)
+	go c.Dash.Run(ctx)
+	go c.Sched.Run(ctx)
+	for _, f := range c.background {
+		go f(ctx)
+	}
+	if c.cfg.StatsD.Addr != "" {
+		go func() {
+			if err := c.Metrics.PushStatsD(ctx, c.cfg.StatsDConfig()); err != nil {
+				slog.Error("statsd push stopped", "error", err)
+			}
+		}()
+	}
+	if c.cfg.Debug.Listen != "" {
+		debug, err := server.New(server.Config{Addr: c.cfg.Debug.Listen}, server.DebugHandler(c.cfg.Debug.LocalOnly))
+		if err != nil {
+			slog.Error("debug listener not started", "error", err)
+			return
+		}
+		go func() {
+			// the debug listener isn't handed over on restarts, so it waits
+			// for the previous process to free its port
+			if server.WaitForPrevious(ctx) != nil {
+				return
+			}
+			if err := debug.Run(ctx); err != nil {
+				slog.Error("debug listener stopped", "error", err)
+			}
+		}()
+	}
+}
+
+// Shutdown waits for running batch jobs, flushes the usage counts, runs the
+// OnShutdown functions and closes the database and log files
+func (c *Core) Shutdown(ctx context.Context) error {
+	var err error
+	if c.Runner != nil {
+		err = errors.Join(err, c.Runner.Stop(ctx))
+	}
+	if c.Meter != nil {
+		err = errors.Join(err, c.Meter.Flush(ctx))
+	}
+	for _, f := range c.shutdown {
+		err = errors.Join(err, f(ctx))
+	}
+	// close what New opened, newest first
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		err = errors.Join(err, c.closers[i].Close())
+	}
+	c.closers = nil
+	return err
+}
+
+// Run starts the background work and serves the Router on the configured
+// listeners, or as an AWS Lambda function when running on Lambda, until ctx
+// is done. It shuts the Core down before returning.
+func (c *Core) Run(ctx context.Context) error {
+	if serverless.OnLambda() {
+		c.Start(ctx)
+		err := serverless.StartLambda(ctx, c.Router)
+		// there's no server whose shutdown would run the hooks
+		return errors.Join(err, c.Shutdown(context.Background()))
+	}
+	srv, err := server.New(c.cfg.ServerConfig(), c.Router)
+	if err != nil {
+		return errors.Join(err, c.Shutdown(context.Background()))
+	}
+	srv.OnShutdown(c.Shutdown)
+	c.Start(ctx)
+	return srv.Run(ctx)
+}
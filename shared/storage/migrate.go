@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrate applies the migrations in dir that haven't run yet for component.
+// Migration files are named NNN_description.sql and run in order, each in
+// its own transaction. Components keep separate histories so every feature
+// can embed its own schema. Replicas starting together take turns under a
+// lock, so each migration runs once.
+func (db *DB) Migrate(ctx context.Context, component string, migrations fs.FS, dir string) error {
+	err := db.locked(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			component TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			applied_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (component, version)
+		)`)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("storage: creating schema_migrations: %w", err)
+	}
+
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return err
+	}
+	type migration struct {
+		version int
+		name    string
+	}
+	var pending []migration
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("storage: migration %s has no numeric version", e.Name())
+		}
+		pending = append(pending, migration{version, e.Name()})
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].version < pending[j].version })
+
+	for _, m := range pending {
+		applied, err := db.applied(ctx, db.DB, component, m.version)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+		script, err := fs.ReadFile(migrations, path.Join(dir, m.name))
+		if err != nil {
+			return err
+		}
+		if err := db.apply(ctx, component, m.version, string(script)); err != nil {
+			return fmt.Errorf("storage: applying %s migration %s: %w", component, m.name, err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) apply(ctx context.Context, component string, version int, script string) error {
+	return db.locked(ctx, func(tx *sql.Tx) error {
+		// another replica may have applied it while we waited for the lock
+		applied, err := db.applied(ctx, tx, component, version)
+		if err != nil || applied {
+			return err
+		}
+		for _, stmt := range strings.Split(script, ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx,
+			db.Rebind(`INSERT INTO schema_migrations (component, version, applied_at) VALUES (?, ?, ?)`),
+			component, version, time.Now().UTC())
+		return err
+	})
+}
+
+// migrationLock is the Postgres advisory lock key migrations hold
+const migrationLock = 0x6d6967726174696f
+
+// locked runs fn in a transaction that holds the migration lock until it
+// ends. Postgres takes an advisory lock; SQLite transactions already hold
+// the database's write lock from the start.
+func (db *DB) locked(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if db.Dialect == Postgres {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(migrationLock)); err != nil {
+			return fmt.Errorf("taking the migration lock: %w", err)
+		}
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (db *DB) applied(ctx context.Context, q queryer, component string, version int) (bool, error) {
+	var n int
+	err := q.QueryRowContext(ctx,
+		db.Rebind(`SELECT COUNT(*) FROM schema_migrations WHERE component = ? AND version = ?`),
+		component, version).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,125 @@
+// Package storage opens the SQL database shared by the services' persistent
+// features and applies their embedded schema migrations. SQLite is meant for
+// local use and Postgres for production.
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Dialect identifies the SQL flavour of a database
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+func (d Dialect) String() string {
+	if d == Postgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// DB is a database handle that knows its dialect
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// Open connects to the database described by dsn. Postgres DSNs start with
+// postgres:// or postgresql://; anything else is treated as a SQLite file,
+// optionally prefixed with sqlite://.
+func Open(ctx context.Context, dsn string) (*DB, error) {
+	var db *DB
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		conn, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, err
+		}
+		db = &DB{DB: conn, Dialect: Postgres}
+	default:
+		path := strings.TrimPrefix(dsn, "sqlite://")
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		// transactions take the write lock up front, so one that read
+		// something can't fail on a concurrent writer once it writes
+		path += sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+		conn, err := sql.Open("sqlite", path)
+		if err != nil {
+			return nil, err
+		}
+		// SQLite only allows one writer at a time
+		conn.SetMaxOpenConns(1)
+		db = &DB{DB: conn, Dialect: SQLite}
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("storage: connecting to %s: %w", db.Dialect, err)
+	}
+	return db, nil
+}
+
+// Rebind rewrites the ? placeholders in query into the dialect's style.
+// Question marks in quoted strings, quoted identifiers and comments are left
+// alone.
+func (db *DB) Rebind(query string) string {
+	if db.Dialect != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		var start, end string
+		switch {
+		case query[i] == '\'' || query[i] == '"':
+			start, end = query[i:i+1], query[i:i+1]
+		case strings.HasPrefix(query[i:], "--"):
+			start, end = "--", "\n"
+		case strings.HasPrefix(query[i:], "/*"):
+			start, end = "/*", "*/"
+		case query[i] == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		default:
+			b.WriteByte(query[i])
+			continue
+		}
+		// a doubled quote inside a string just closes and reopens it, so
+		// copying up to the next one is enough
+		skip := len(query)
+		if j := strings.Index(query[i+len(start):], end); j >= 0 {
+			skip = i + len(start) + j + len(end)
+		}
+		b.WriteString(query[i:skip])
+		i = skip - 1
+	}
+	return b.String()
+}
+
+// Exec runs a query written with ? placeholders
+func (db *DB) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return db.ExecContext(ctx, db.Rebind(query), args...)
+}
+
+// Query runs a query written with ? placeholders
+func (db *DB) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return db.QueryContext(ctx, db.Rebind(query), args...)
+}
+
+// QueryRow runs a query written with ? placeholders
+func (db *DB) QueryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return db.QueryRowContext(ctx, db.Rebind(query), args...)
+}
@@ -0,0 +1,56 @@
+package versioning
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/metrics"
+	"github.com/ixmorrow/go-projects/shared/respond"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Deprecations marks single routes as deprecated, for changes that don't
+// warrant a new API version, and counts how often deprecated routes and
+// versions are still used so they can be removed once traffic stops
+type Deprecations struct {
+	used *prometheus.CounterVec
+	now  func() time.Time
+}
+
+// NewDeprecations creates Deprecations counting in the
+// deprecated_requests_total metric registered with reg
+func NewDeprecations(reg prometheus.Registerer) *Deprecations {
+	d := &Deprecations{
+		used: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "deprecated_requests_total",
+			Help: "Requests served by deprecated routes and API versions.",
+		}, []string{"route", "method"}),
+		now: time.Now,
+	}
+	reg.MustRegister(d.used)
+	return d
+}
+
+// Deprecate returns middleware that announces policy on the routes it wraps.
+// Successor is the path of the replacement route. Once the sunset passes the
+// routes answer 410 Gone.
+func (d *Deprecations) Deprecate(policy Policy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := d.now()
+			if !policy.Sunset.IsZero() && !now.Before(policy.Sunset) {
+				respond.Error(w, http.StatusGone, "this endpoint was retired on "+policy.Sunset.Format(time.DateOnly))
+				return
+			}
+			if announce(w, policy, policy.Successor, now) {
+				d.count(r)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (d *Deprecations) count(r *http.Request) {
+	d.used.WithLabelValues(metrics.Route(r), r.Method).Inc()
+}
@@ -0,0 +1,155 @@
+// Package versioning mounts API versions as route groups under a common
+// prefix, e.g. /api/v1 and /api/v2, and enforces each version's deprecation
+// policy so breaking changes ship as new versions instead of silently
+// changing existing ones.
+package versioning
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ixmorrow/go-projects/shared/respond"
+)
+
+// VersionHeader tells clients which API version served their request
+const VersionHeader = "API-Version"
+
+// Policy describes the lifecycle of a version. The zero Policy is a current,
+// supported version.
+type Policy struct {
+	// Deprecated is when the version was deprecated. Responses carry
+	// Deprecation and Link headers from then on.
+	Deprecated time.Time
+	// Sunset is when the version stops working. Responses carry a Sunset
+	// header before it and requests get 410 Gone after it.
+	Sunset time.Time
+	// Successor is the version clients should migrate to, or for routes
+	// passed to Deprecate the path of the replacement route
+	Successor string
+}
+
+// Router holds the versions mounted under one prefix
+type Router struct {
+	root         *mux.Router
+	prefix       string
+	versions     map[string]Policy
+	deprecations *Deprecations
+	now          func() time.Time
+}
+
+// New creates a Router mounting versions under prefix on root and serves the
+// list of versions at the prefix itself
+func New(root *mux.Router, prefix string) *Router {
+	v := &Router{root: root, prefix: prefix, versions: make(map[string]Policy), now: time.Now}
+	root.HandleFunc(prefix, v.list).Methods("GET")
+	return v
+}
+
+// WithDeprecations counts requests to deprecated versions in d
+func (v *Router) WithDeprecations(d *Deprecations) *Router {
+	v.deprecations = d
+	return v
+}
+
+// Version mounts version name, e.g. "v1", and returns its route group
+func (v *Router) Version(name string, policy Policy) *mux.Router {
+	v.versions[name] = policy
+	sub := v.root.PathPrefix(v.prefix + "/" + name).Subrouter()
+	sub.Use(v.enforce(name, policy))
+	return sub
+}
+
+// Alias returns a route group at path, e.g. "/v1", that serves the routes
+// of version name like its group under the prefix does. The group follows
+// the version's policy, so it's deprecated and retired together with it.
+// Version name must be mounted first.
+func (v *Router) Alias(path, name string) *mux.Router {
+	policy, ok := v.versions[name]
+	if !ok {
+		panic("versioning: alias of unknown version " + name)
+	}
+	sub := v.root.NewRoute().Subrouter()
+	if path != "" {
+		sub = v.root.PathPrefix(path).Subrouter()
+	}
+	sub.Use(v.enforce(name, policy))
+	return sub
+}
+
+// Unversioned returns a route group at the root of the router that serves
+// the routes of version name without any prefix, for clients from before
+// versions were introduced. It's an Alias with an empty path.
+func (v *Router) Unversioned(name string) *mux.Router {
+	return v.Alias("", name)
+}
+
+func (v *Router) enforce(name string, policy Policy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(VersionHeader, name)
+			now := v.now()
+			if !policy.Sunset.IsZero() && !now.Before(policy.Sunset) {
+				respond.Error(w, http.StatusGone, "API version "+name+" was retired on "+policy.Sunset.Format(time.DateOnly))
+				return
+			}
+			successor := ""
+			if policy.Successor != "" {
+				successor = v.prefix + "/" + policy.Successor
+			}
+			if announce(w, policy, successor, now) && v.deprecations != nil {
+				v.deprecations.count(r)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// announce sets the deprecation headers for policy, linking to successor
+// when it is set, and reports whether the policy is deprecated at now
+func announce(w http.ResponseWriter, policy Policy, successor string, now time.Time) bool {
+	deprecated := !policy.Deprecated.IsZero() && !now.Before(policy.Deprecated)
+	if deprecated {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(policy.Deprecated.Unix(), 10))
+		if successor != "" {
+			w.Header().Add("Link", "<"+successor+">; rel=\"successor-version\"")
+		}
+	}
+	if !policy.Sunset.IsZero() {
+		w.Header().Set("Sunset", policy.Sunset.UTC().Format(http.TimeFormat))
+	}
+	return deprecated
+}
+
+type versionInfo struct {
+	Version    string     `json:"version"`
+	Status     string     `json:"status"`
+	Deprecated *time.Time `json:"deprecated,omitempty"`
+	Sunset     *time.Time `json:"sunset,omitempty"`
+	Successor  string     `json:"successor,omitempty"`
+}
+
+func (v *Router) list(w http.ResponseWriter, r *http.Request) {
+	now := v.now()
+	infos := make([]versionInfo, 0, len(v.versions))
+	for name, p := range v.versions {
+		info := versionInfo{Version: name, Status: "current", Successor: p.Successor}
+		if !p.Deprecated.IsZero() {
+			info.Deprecated = &p.Deprecated
+			if !now.Before(p.Deprecated) {
+				info.Status = "deprecated"
+			}
+		}
+		if !p.Sunset.IsZero() {
+			info.Sunset = &p.Sunset
+			if !now.Before(p.Sunset) {
+				info.Status = "retired"
+			}
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Version < infos[j].Version })
+	respond.JSON(w, http.StatusOK, infos)
+}
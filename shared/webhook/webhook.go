@@ -0,0 +1,187 @@
+// Package webhook POSTs signed JSON events to URLs that callers hand in, such
+// as the callback of a batch job, so they learn about work finishing without
+// polling. Every delivery carries
+//
+//	Webhook-Id: the event's id, the same for every retry
+//	Webhook-Signature: t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+//
+// with the HMAC keyed by the secret shared with receivers. Receivers check
+// the signature with Verify and drop events whose time is too old.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ixmorrow/go-projects/shared/httpclient"
+)
+
+// Headers of a delivery
+const (
+	IDHeader        = "Webhook-Id"
+	SignatureHeader = "Webhook-Signature"
+)
+
+// ErrNoSecret is returned by New without a secret to sign with
+var ErrNoSecret = errors.New("webhook: a signing secret is required")
+
+// Options configures a Sender
+type Options struct {
+	// Secret keys the signatures
+	Secret string
+	// AllowPrivate lets events go to loopback and private addresses, for
+	// development. Otherwise callers could make the service probe the
+	// network it runs in.
+	AllowPrivate bool
+	// Timeout bounds a delivery including its retries, defaults to 1m
+	Timeout time.Duration
+}
+
+// Sender delivers events in the background
+type Sender struct {
+	opts   Options
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+// New creates a Sender signing with opts.Secret
+func New(opts Options) (*Sender, error) {
+	if opts.Secret == "" {
+		return nil, ErrNoSecret
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Minute
+	}
+	return &Sender{
+		opts: opts,
+		// the Webhook-Id doubles as the Idempotency-Key, which makes the
+		// POSTs retryable
+		client: httpclient.New(httpclient.Options{
+			Timeout:     opts.Timeout,
+			Retries:     4,
+			Backoff:     time.Second,
+			MaxBackoff:  15 * time.Second,
+			DenyPrivate: !opts.AllowPrivate,
+		}),
+	}, nil
+}
+
+// CheckURL reports why raw can't take events, so requests naming it can be
+// rejected up front. Names resolving to private addresses are only caught
+// when delivering.
+func (s *Sender) CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.New("a callback must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return errors.New("a callback can't hold credentials")
+	}
+	if s.opts.AllowPrivate {
+		return nil
+	}
+	if ip := net.ParseIP(u.Hostname()); (ip != nil && httpclient.Private(ip)) || strings.EqualFold(u.Hostname(), "localhost") {
+		return errors.New("a callback can't point to a private address")
+	}
+	return nil
+}
+
+// Deliver POSTs event as JSON to target in the background. id identifies
+// the event to the receiver; failures are logged.
+func (s *Sender) Deliver(target, id string, event any) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.Send(context.Background(), target, id, event); err != nil {
+			slog.Warn("delivering webhook", "id", id, "error", err)
+		}
+	}()
+}
+
+// Send POSTs event as JSON to target and waits for the answer, retrying
+// failures that may pass
+func (s *Sender) Send(ctx context.Context, target, id string, event any) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, id)
+	req.Header.Set("Idempotency-Key", id)
+	req.Header.Set(SignatureHeader, Sign([]byte(s.opts.Secret), time.Now(), body))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s answered %s", target, resp.Status)
+	}
+	return nil
+}
+
+// Close waits for the deliveries under way
+func (s *Sender) Close() error {
+	s.wg.Wait()
+	return nil
+}
+
+// Sign computes the Webhook-Signature of body sent at t
+func Sign(secret []byte, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+// Verify checks signature, a Webhook-Signature, against body and returns
+// the time it was signed at
+func Verify(secret []byte, signature string, body []byte) (time.Time, error) {
+	var ts, sig string
+	for _, part := range strings.Split(signature, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return time.Time{}, errors.New("webhook: malformed signature")
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, body))) {
+		return time.Time{}, errors.New("webhook: signature mismatch")
+	}
+	return time.Unix(unix, 0), nil
+}
+
+func mac(secret []byte, ts string, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(ts))
+	h.Write([]byte{'.'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}